@@ -0,0 +1,21 @@
+package grip
+
+import (
+	"context"
+
+	"github.com/mongodb/grip/message"
+)
+
+// ContextWithFields returns a copy of the context that carries the
+// fields, merged with any fields that the context already carries.
+// Journalers, and Senders wrapped with send.NewContextFieldsSender, add
+// the fields to every message sent with the context, so request, tenant
+// or user IDs only need to be attached once at the top of a request.
+func ContextWithFields(ctx context.Context, fields message.Fields) context.Context {
+	return message.ContextWithFields(ctx, fields)
+}
+
+// FieldsFromContext returns the fields that the context carries.
+func FieldsFromContext(ctx context.Context) message.Fields {
+	return message.FieldsFromContext(ctx)
+}
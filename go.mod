@@ -9,6 +9,8 @@ require (
 	github.com/coreos/go-systemd v0.0.0-20191104093116-d3cd4ed1dbcf
 	github.com/dghubble/oauth1 v0.7.2
 	github.com/fuyufjh/splunk-hec-go v0.3.4-0.20190414090710-10df423a9f36
+	github.com/go-logr/logr v1.2.4
+	github.com/golang/snappy v0.0.4
 	github.com/google/go-github/v79 v79.0.0
 	github.com/mattn/go-xmpp v0.0.0-20210723025538-3871461df959
 	github.com/montanaflynn/stats v0.0.0-20180911141734-db72e6cae808
@@ -27,7 +29,6 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/structs v1.1.0 // indirect
 	github.com/felixge/httpsnoop v1.0.3 // indirect
-	github.com/go-logr/logr v1.2.4 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.2 // indirect
@@ -58,5 +59,5 @@ require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/shirou/gopsutil/v3 v3.23.5
 	github.com/slack-go/slack v0.12.1
-	golang.org/x/sys v0.38.0 // indirect
+	golang.org/x/sys v0.38.0
 )
@@ -2,6 +2,7 @@ package grip
 
 import (
 	"github.com/mongodb/grip/logging"
+	"github.com/mongodb/grip/message"
 	"github.com/mongodb/grip/send"
 )
 
@@ -34,3 +35,9 @@ func SetName(name string) {
 func SetLevel(info send.LevelInfo) error {
 	return std.SetLevel(info)
 }
+
+// With returns a Journaler that shares the sender of the standard
+// logger but adds the fields to every message that it sends.
+func With(fields message.Fields) Journaler {
+	return std.With(fields)
+}
@@ -10,25 +10,28 @@ import (
 // instance. Calls the Close() method on the existing instance before
 // changing the implementation for the current instance. SetSender
 // will configure the incoming sender to have the same name as well as
-// default and threshold level as the outgoing sender.
+// default and threshold level as the outgoing sender. For a Grip
+// derived with With, SetSender swaps the sender of the Grip that it was
+// derived from.
 func (g *Grip) SetSender(s send.Sender) error {
 	if s == nil {
 		return errors.New("cannot set the sender to nil")
 	}
 
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	r := g.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	if err := s.SetLevel(g.impl.Level()); err != nil {
+	if err := s.SetLevel(r.impl.Level()); err != nil {
 		return err
 	}
 
-	if err := g.impl.Close(); err != nil {
+	if err := r.impl.Close(); err != nil {
 		return err
 	}
 
-	s.SetName(g.impl.Name())
-	g.impl = s
+	s.SetName(r.impl.Name())
+	r.impl = s
 
 	return nil
 }
@@ -37,7 +40,8 @@ func (g *Grip) SetSender(s send.Sender) error {
 // combination with SetSender() to have multiple Journaler instances
 // backed by the same send.Sender instance.
 func (g *Grip) GetSender() send.Sender {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.impl
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.impl
 }
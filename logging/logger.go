@@ -18,6 +18,11 @@ type Grip struct {
 	impl         send.Sender
 	defaultLevel level.Priority
 	mu           sync.RWMutex
+
+	// parent and fields are set for Grips derived with With, which
+	// use the sender of the parent and add the fields to messages.
+	parent *Grip
+	fields message.Fields
 }
 
 // MakeGrip builds a new logging interface from a sender implmementation
@@ -41,24 +46,37 @@ func NewGrip(name string) *Grip {
 	return &Grip{impl: sender}
 }
 
+// root returns the Grip that holds the sender: the Grip that a derived
+// Grip was derived from, or the Grip itself.
+func (g *Grip) root() *Grip {
+	if g.parent != nil {
+		return g.parent
+	}
+
+	return g
+}
+
 func (g *Grip) Name() string {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	return g.impl.Name()
+	return r.impl.Name()
 }
 
 func (g *Grip) SetName(n string) {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	g.impl.SetName(n)
+	r.impl.SetName(n)
 }
 
 func (g *Grip) SetLevel(info send.LevelInfo) error {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	sl := g.impl.Level()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sl := r.impl.Level()
 
 	if !info.Default.IsValid() {
 		info.Default = sl.Default
@@ -68,24 +86,55 @@ func (g *Grip) SetLevel(info send.LevelInfo) error {
 		info.Threshold = sl.Threshold
 	}
 
-	return g.impl.SetLevel(info)
+	return r.impl.SetLevel(info)
 }
 
-func (g *Grip) Send(ctx context.Context, m interface{}) {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+// With returns a derived Grip that sends messages with the Sender of
+// this Grip, or of the Grip that this Grip was derived from, and adds
+// the fields, merged with any fields of this Grip, to every message
+// that it sends. The derived Grip follows later calls to SetSender on
+// this Grip. Since the Sender is shared, calling SetName, SetLevel or
+// SetSender on the derived Grip changes the Sender of this Grip.
+func (g *Grip) With(fields message.Fields) Journaler {
+	merged := make(message.Fields, len(g.fields)+len(fields))
+	for k, v := range g.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
 
-	g.impl.Send(ctx, message.ConvertToComposer(g.defaultLevel, m))
+	return &Grip{
+		parent: g.root(),
+		fields: merged,
+	}
+}
+
+func (g *Grip) Send(ctx context.Context, m interface{}) {
+	g.send(ctx, message.ConvertToComposer(g.root().defaultLevel, m))
 }
 
 // Internal
 
 // send delivers a composer that already carries priority/level.
 func (g *Grip) send(ctx context.Context, m message.Composer) {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.impl.Level().ShouldLog(m) {
+		g.annotate(ctx, m)
+	}
+	r.impl.Send(ctx, m)
+}
 
-	g.impl.Send(ctx, m)
+// annotate adds the fields of the context and then the fields of the
+// Grip to the message, so that the message's own fields take
+// precedence over the context's, which take precedence over the
+// Grip's.
+func (g *Grip) annotate(ctx context.Context, m message.Composer) {
+	message.AnnotateFields(m, message.FieldsFromContext(ctx))
+	message.AnnotateFields(m, g.fields)
 }
 
 // For sending logging messages, in most cases, use the
@@ -94,11 +143,13 @@ func (g *Grip) send(ctx context.Context, m message.Composer) {
 func (g *Grip) sendPanic(ctx context.Context, m message.Composer) {
 	// the Send method in the Sender interface will perform this
 	// check but to add fatal methods we need to do this here.
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	if g.impl.Level().ShouldLog(m) {
-		g.impl.Send(ctx, m)
+	if r.impl.Level().ShouldLog(m) {
+		g.annotate(ctx, m)
+		r.impl.Send(ctx, m)
 		panic(m.String())
 	}
 }
@@ -106,11 +157,13 @@ func (g *Grip) sendPanic(ctx context.Context, m message.Composer) {
 func (g *Grip) sendFatal(ctx context.Context, m message.Composer) {
 	// the Send method in the Sender interface will perform this
 	// check but to add fatal methods we need to do this here.
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	r := g.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	if g.impl.Level().ShouldLog(m) {
-		g.impl.Send(ctx, m)
+	if r.impl.Level().ShouldLog(m) {
+		g.annotate(ctx, m)
+		r.impl.Send(ctx, m)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// LogrNameKey is the field that holds the name of the logr logger, as
+// built with WithName.
+const LogrNameKey = "logger"
+
+// LogrVerbosityToPriority converts a logr verbosity level to a
+// priority: V(0) is Info, V(1) is Debug, and higher verbosity levels
+// are Trace.
+func LogrVerbosityToPriority(v int) level.Priority {
+	switch {
+	case v <= 0:
+		return level.Info
+	case v == 1:
+		return level.Debug
+	default:
+		return level.Trace
+	}
+}
+
+type logrSink struct {
+	journaler Journaler
+	names     []string
+	values    message.Fields
+}
+
+// NewLogrSink returns a logr.LogSink that logs through the Journaler,
+// so that libraries that use logr, such as controller-runtime, write to
+// grip senders. Use logr.New to build a logr.Logger from the sink, and
+// MakeGrip to log to a send.Sender.
+//
+// Info messages have the priority of their verbosity level (see
+// LogrVerbosityToPriority), and Error messages wrap the error with
+// message.WrapError at the Error priority. The key/value pairs of
+// messages and of WithValues become fields. The names of WithName are
+// joined with ".", qualified by the name of the Journaler's sender, in
+// the "logger" field, since sinks share the sender and do not rename it.
+func NewLogrSink(j Journaler) logr.LogSink {
+	return &logrSink{journaler: j}
+}
+
+func (s *logrSink) Init(logr.RuntimeInfo) {}
+
+func (s *logrSink) Enabled(v int) bool {
+	return LogrVerbosityToPriority(v) >= s.journaler.GetSender().Level().Threshold
+}
+
+func (s *logrSink) Info(v int, msg string, keysAndValues ...interface{}) {
+	s.journaler.Log(context.Background(), LogrVerbosityToPriority(v), message.MakeFieldsMessage(msg, s.fields(keysAndValues)))
+}
+
+func (s *logrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	m := message.MakeFieldsMessage(msg, s.fields(keysAndValues))
+	if err != nil {
+		m = message.WrapError(err, m)
+	}
+
+	s.journaler.Log(context.Background(), level.Error, m)
+}
+
+func (s *logrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	values := make(message.Fields, len(s.values)+len(keysAndValues)/2)
+	for k, v := range s.values {
+		values[k] = v
+	}
+	addLogrValues(values, keysAndValues)
+
+	return &logrSink{
+		journaler: s.journaler,
+		names:     s.names,
+		values:    values,
+	}
+}
+
+func (s *logrSink) WithName(name string) logr.LogSink {
+	names := make([]string, len(s.names), len(s.names)+1)
+	copy(names, s.names)
+
+	return &logrSink{
+		journaler: s.journaler,
+		names:     append(names, name),
+		values:    s.values,
+	}
+}
+
+// fields returns the fields of a message: the values of the sink, the
+// name, and the key/value pairs of the message.
+func (s *logrSink) fields(keysAndValues []interface{}) message.Fields {
+	fields := make(message.Fields, len(s.values)+len(keysAndValues)/2+1)
+	for k, v := range s.values {
+		fields[k] = v
+	}
+	if len(s.names) > 0 {
+		fields[LogrNameKey] = strings.Join(append([]string{s.journaler.Name()}, s.names...), ".")
+	}
+	addLogrValues(fields, keysAndValues)
+
+	return fields
+}
+
+// addLogrValues adds key/value pairs to the fields. Keys that are not
+// strings are converted to strings, and a key without a value has a
+// nil value.
+func addLogrValues(fields message.Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		if marshaler, ok := value.(logr.Marshaler); ok {
+			value = marshaler.MarshalLog()
+		}
+
+		fields[key] = value
+	}
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/send"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type logrMarshaler struct{}
+
+func (logrMarshaler) MarshalLog() interface{} { return "marshaled" }
+
+func TestLogrSink(t *testing.T) {
+	newLogger := func(t *testing.T) (logr.Logger, *send.InternalSender) {
+		sink, err := send.NewInternalLogger("operator", send.LevelInfo{Default: level.Info, Threshold: level.Debug})
+		require.NoError(t, err)
+		return logr.New(NewLogrSink(MakeGrip(sink))), sink
+	}
+
+	t.Run("Verbosity", func(t *testing.T) {
+		logger, sink := newLogger(t)
+		assert.True(t, logger.V(0).Enabled())
+		assert.True(t, logger.V(1).Enabled())
+		assert.False(t, logger.V(2).Enabled())
+
+		logger.Info("info")
+		assert.Equal(t, level.Info, sink.GetMessage().Priority)
+		logger.V(1).Info("debug")
+		assert.Equal(t, level.Debug, sink.GetMessage().Priority)
+		logger.V(5).Info("trace")
+		assert.False(t, sink.HasMessage())
+	})
+	t.Run("ValuesAndNames", func(t *testing.T) {
+		logger, sink := newLogger(t)
+		derived := logger.WithName("controller").WithValues("kind", "Pod", "marshaled", logrMarshaler{}).WithName("reconciler")
+
+		derived.Info("reconciled", "name", "web", 42, "answer", "dangling")
+		fields := sink.GetMessage().Message.Raw().(message.Fields)
+		assert.Equal(t, "reconciled", fields[message.FieldsMsgName])
+		assert.Equal(t, "operator.controller.reconciler", fields[LogrNameKey])
+		assert.Equal(t, "Pod", fields["kind"])
+		assert.Equal(t, "marshaled", fields["marshaled"])
+		assert.Equal(t, "web", fields["name"])
+		assert.Equal(t, "answer", fields["42"])
+		assert.Contains(t, fields, "dangling")
+		assert.Nil(t, fields["dangling"])
+
+		logger.Info("root")
+		fields = sink.GetMessage().Message.Raw().(message.Fields)
+		assert.NotContains(t, fields, LogrNameKey)
+		assert.NotContains(t, fields, "kind")
+	})
+	t.Run("Error", func(t *testing.T) {
+		logger, sink := newLogger(t)
+
+		logger.Error(errors.New("boom"), "failed", "attempt", 2)
+		msg := sink.GetMessage()
+		assert.Equal(t, level.Error, msg.Priority)
+		_, ok := msg.Message.(message.ErrorComposer)
+		assert.True(t, ok)
+		fields := msg.Message.Raw().(message.Fields)
+		assert.Equal(t, "boom", fields["error"])
+		assert.Equal(t, 2, fields["attempt"])
+		assert.Contains(t, msg.Rendered, "boom")
+
+		logger.Error(nil, "no error")
+		msg = sink.GetMessage()
+		assert.Equal(t, level.Error, msg.Priority)
+		assert.True(t, msg.Logged)
+	})
+}
@@ -271,3 +271,90 @@ func TestSendFatalExits(t *testing.T) {
 		t.Errorf("sendFatal should have exited 0, instead: %+v", err)
 	}
 }
+
+func (s *GripInternalSuite) TestContextAndDerivedFields() {
+	sink, err := send.NewInternalLogger("sink", send.LevelInfo{Default: level.Trace, Threshold: level.Info})
+	s.NoError(err)
+	s.NoError(s.grip.SetSender(sink))
+	s.NoError(sink.SetLevel(send.LevelInfo{Default: level.Trace, Threshold: level.Info}))
+	defer func() { s.NoError(sink.SetLevel(send.LevelInfo{Default: level.Info, Threshold: level.Trace})) }()
+
+	derived := s.grip.With(message.Fields{"component": "db", "request": "fixed"})
+	s.Equal(sink, derived.GetSender())
+	nested := derived.With(message.Fields{"shard": 2})
+
+	ctx := message.ContextWithFields(s.T().Context(), message.Fields{"request": "abc"})
+	nested.Info(ctx, message.Fields{"message": "hello", "shard": 3})
+	fields := sink.GetMessage().Message.Raw().(message.Fields)
+	s.Equal("db", fields["component"])
+	s.Equal("abc", fields["request"], "context fields take precedence")
+	s.Equal(3, fields["shard"], "message fields take precedence")
+
+	s.grip.Info(ctx, message.Fields{"message": "parent"})
+	fields = sink.GetMessage().Message.Raw().(message.Fields)
+	s.Equal("abc", fields["request"])
+	s.NotContains(fields, "component", "the parent does not have derived fields")
+
+	s.grip.Debug(ctx, message.Fields{"message": "suppressed"})
+	msg := sink.GetMessage()
+	s.False(msg.Logged)
+	s.NotContains(msg.Message.Raw().(message.Fields), "request", "suppressed messages are not annotated")
+}
+
+func (s *GripInternalSuite) TestDerivedFollowsSetSender() {
+	first, err := send.NewInternalLogger("first", send.LevelInfo{Default: level.Info, Threshold: level.Info})
+	s.NoError(err)
+	s.NoError(s.grip.SetSender(first))
+	derived := s.grip.With(message.Fields{"component": "db"})
+
+	second, err := send.NewInternalLogger("second", send.LevelInfo{Default: level.Info, Threshold: level.Info})
+	s.NoError(err)
+	s.NoError(s.grip.SetSender(second))
+	s.Equal(second, derived.GetSender())
+
+	derived.Info(s.T().Context(), message.Fields{"message": "hello"})
+	s.False(first.HasMessage(), "the closed sender is not used")
+	s.Equal("db", second.GetMessage().Message.Raw().(message.Fields)["component"])
+
+	derived.SetName("renamed")
+	s.Equal("renamed", s.grip.Name())
+	third, err := send.NewInternalLogger("third", send.LevelInfo{Default: level.Info, Threshold: level.Info})
+	s.NoError(err)
+	s.NoError(derived.With(message.Fields{"shard": 1}).SetSender(third))
+	s.Equal(third, s.grip.GetSender(), "derived Grips set the sender of their parent")
+	s.Equal("renamed", third.Name())
+}
+
+func (s *GripInternalSuite) TestSharedRoutingSenderNames() {
+	newTarget := func(name string) *send.InternalSender {
+		target, err := send.NewInternalLogger(name, send.LevelInfo{Default: level.Trace, Threshold: level.Trace})
+		s.NoError(err)
+		return target
+	}
+	api, worker, other := newTarget("api"), newTarget("worker"), newTarget("other")
+	router, err := send.NewRoutingSender("router", send.LevelInfo{Default: level.Info, Threshold: level.Info}, send.RoutingOptions{
+		Rules: []send.RoutingRule{
+			{Names: []string{"api"}, Targets: []send.Sender{api}},
+			{
+				Fields:  map[string]func(interface{}) bool{"component": func(v interface{}) bool { return v == "worker" }},
+				Targets: []send.Sender{worker},
+			},
+		},
+		Default: []send.Sender{other},
+	})
+	s.NoError(err)
+
+	apiLogger, workerLogger := NewGrip("api"), NewGrip("worker")
+	s.NoError(apiLogger.SetSender(router))
+	apiLogger.Info(s.T().Context(), "first")
+	s.Equal("first", api.GetMessage().Rendered)
+
+	s.NoError(workerLogger.SetSender(router))
+	s.Equal("worker", router.Name(), "the shared sender has the name of the journaler that set it last")
+	apiLogger.Info(s.T().Context(), "second")
+	s.False(api.HasMessage())
+	s.Equal("second", other.GetMessage().Rendered)
+
+	workerLogger.With(message.Fields{"component": "worker"}).Info(s.T().Context(), message.Fields{"message": "third"})
+	s.Equal("third", worker.GetMessage().Message.Raw().(message.Fields)["message"])
+}
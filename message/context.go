@@ -0,0 +1,48 @@
+package message
+
+import "context"
+
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a copy of the context that carries the
+// fields, merged with any fields that the context already carries. The
+// new fields take precedence over the existing fields with the same
+// keys. Journalers and the context fields sender add the fields of the
+// context to every message that they send with it, which makes it
+// possible to attach request or tenant IDs once at the top of a request.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	existing := FieldsFromContext(ctx)
+	merged := make(Fields, len(existing)+len(fields))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the fields that the context carries, or nil
+// if it carries none. Callers must not modify the returned fields.
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(contextFieldsKey{}).(Fields)
+
+	return fields
+}
+
+// AnnotateFields annotates the message with each of the fields. Fields
+// that the message already has keep their values.
+func AnnotateFields(m Composer, fields Fields) {
+	for k, v := range fields {
+		_ = m.Annotate(k, v)
+	}
+}
@@ -0,0 +1,25 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/mongodb/grip/level"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextWithFields(t *testing.T) {
+	assert.Nil(t, FieldsFromContext(t.Context()))
+
+	ctx := ContextWithFields(t.Context(), Fields{"request": "a", "tenant": "t"})
+	child := ContextWithFields(ctx, Fields{"request": "b", "user": "u"})
+	assert.Equal(t, Fields{"request": "a", "tenant": "t"}, FieldsFromContext(ctx))
+	assert.Equal(t, Fields{"request": "b", "tenant": "t", "user": "u"}, FieldsFromContext(child))
+	assert.Equal(t, ctx, ContextWithFields(ctx, nil))
+
+	m := NewFields(level.Info, Fields{"request": "own"})
+	AnnotateFields(m, FieldsFromContext(child))
+	fields := m.Raw().(Fields)
+	assert.Equal(t, "own", fields["request"])
+	assert.Equal(t, "t", fields["tenant"])
+	assert.Equal(t, "u", fields["user"])
+}
@@ -0,0 +1,377 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// AlertRule defines an alert that fires when the number of matching
+// messages in a sliding window reaches a threshold.
+type AlertRule struct {
+	// Name identifies the alert in the alert messages.
+	Name string
+	// MinPriority is the lowest priority of the messages to count.
+	// Defaults to counting messages of any priority.
+	MinPriority level.Priority
+	// Field and Value, if Field is set, restrict the count to
+	// messages with the field set to the value, compared by their
+	// string forms.
+	Field string
+	Value interface{}
+	// Threshold is the number of matching messages in the Window
+	// at which the alert fires.
+	Threshold int
+	// ResolveThreshold is the number of matching messages in the
+	// Window at or below which a firing alert resolves. Keeping it
+	// below Threshold prevents alerts from flapping when the rate
+	// hovers around the threshold. Defaults to half the Threshold.
+	ResolveThreshold int
+	// Window is the duration of the sliding window in which
+	// messages are counted. Messages are counted in buckets of a
+	// twentieth of the window, so they leave the window up to a
+	// twentieth of it early.
+	Window time.Duration
+	// Cooldown is the minimum time between two alerts for the
+	// rule, so that a rate that resolves and crosses the threshold
+	// again soon after only alerts once.
+	Cooldown time.Duration
+}
+
+func (r *AlertRule) validate() error {
+	catcher := []string{}
+	if r.Name == "" {
+		catcher = append(catcher, "must specify a name")
+	}
+	if r.MinPriority != level.Invalid && !r.MinPriority.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid minimum priority '%d'", r.MinPriority))
+	}
+	if r.Threshold <= 0 {
+		catcher = append(catcher, "threshold must be positive")
+	}
+	if r.ResolveThreshold < 0 || (r.Threshold > 0 && r.ResolveThreshold >= r.Threshold) {
+		catcher = append(catcher, "resolve threshold must be less than the threshold")
+	}
+	if r.Window <= 0 {
+		catcher = append(catcher, "window must be positive")
+	}
+	if r.Cooldown < 0 {
+		catcher = append(catcher, "cooldown cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if r.ResolveThreshold == 0 {
+		r.ResolveThreshold = r.Threshold / 2
+	}
+
+	return nil
+}
+
+// AlertOptions configure the alerting sender.
+type AlertOptions struct {
+	// Rules are the alerts to watch for.
+	Rules []AlertRule
+	// AlertPriority is the priority of the alert messages.
+	// Defaults to Alert.
+	AlertPriority level.Priority
+	// ResolvePriority is the priority of the resolution messages.
+	// Defaults to Notice.
+	ResolvePriority level.Priority
+	// CheckInterval is how often firing alerts are checked for
+	// resolution when no messages arrive. Defaults to a tenth of
+	// the shortest window, and is at least a millisecond.
+	CheckInterval time.Duration
+}
+
+func (opts *AlertOptions) validate() error {
+	catcher := []string{}
+	if len(opts.Rules) == 0 {
+		catcher = append(catcher, "must specify at least one rule")
+	}
+	for idx := range opts.Rules {
+		if err := opts.Rules[idx].validate(); err != nil {
+			catcher = append(catcher, fmt.Sprintf("rule %d: %s", idx, err))
+		}
+	}
+	if opts.AlertPriority != level.Invalid && !opts.AlertPriority.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid alert priority '%d'", opts.AlertPriority))
+	}
+	if opts.ResolvePriority != level.Invalid && !opts.ResolvePriority.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid resolve priority '%d'", opts.ResolvePriority))
+	}
+	if opts.CheckInterval < 0 {
+		catcher = append(catcher, "check interval cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.AlertPriority == level.Invalid {
+		opts.AlertPriority = level.Alert
+	}
+	if opts.ResolvePriority == level.Invalid {
+		opts.ResolvePriority = level.Notice
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = opts.Rules[0].Window
+		for _, rule := range opts.Rules {
+			if rule.Window < opts.CheckInterval {
+				opts.CheckInterval = rule.Window
+			}
+		}
+		opts.CheckInterval /= 10
+	}
+	if opts.CheckInterval < minAlertCheckInterval {
+		opts.CheckInterval = minAlertCheckInterval
+	}
+
+	return nil
+}
+
+const (
+	// alertBuckets is the number of buckets in which the matching
+	// messages in the window of an alert rule are counted, so that
+	// counting them does not take memory for each message.
+	alertBuckets = 20
+	// minAlertCheckInterval is the shortest interval at which
+	// firing alerts are checked for resolution.
+	minAlertCheckInterval = time.Millisecond
+)
+
+// alertState is the state of an alert rule.
+type alertState struct {
+	rule AlertRule
+	// width is the duration of the buckets. Each bucket counts the
+	// matching messages in a period of that duration, and epochs
+	// are the indexes of those periods.
+	width     time.Duration
+	counts    [alertBuckets]int
+	epochs    [alertBuckets]int64
+	firing    bool
+	firedAt   time.Time
+	lastAlert time.Time
+	last      string
+}
+
+func newAlertState(rule AlertRule) *alertState {
+	width := rule.Window / alertBuckets
+	if width <= 0 {
+		width = 1
+	}
+
+	return &alertState{rule: rule, width: width}
+}
+
+func (a *alertState) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(a.width)
+}
+
+// add counts a matching message, reusing the bucket of a period that
+// is outside of the window.
+func (a *alertState) add(now time.Time) {
+	epoch := a.epoch(now)
+	idx := epoch % alertBuckets
+	if a.epochs[idx] != epoch {
+		a.epochs[idx] = epoch
+		a.counts[idx] = 0
+	}
+	a.counts[idx]++
+}
+
+// count returns the number of matching messages in the window.
+func (a *alertState) count(now time.Time) int {
+	epoch := a.epoch(now)
+	total := 0
+	for idx := range a.counts {
+		if a.epochs[idx] > epoch-alertBuckets && a.epochs[idx] <= epoch {
+			total += a.counts[idx]
+		}
+	}
+
+	return total
+}
+
+func (a *alertState) matches(m message.Composer) bool {
+	if a.rule.MinPriority != level.Invalid && m.Priority() < a.rule.MinPriority {
+		return false
+	}
+	if a.rule.Field != "" {
+		value, ok := messageAttributes(m)[a.rule.Field]
+		if !ok || fmt.Sprint(value) != fmt.Sprint(a.rule.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type alertingSender struct {
+	opts   AlertOptions
+	alerts Sender
+	mu     sync.Mutex
+	states []*alertState
+	cancel context.CancelFunc
+	closed bool
+
+	Sender
+}
+
+// NewAlertingSender provides a Sender implementation that wraps an
+// existing Sender, passing all messages through to it, and watches the
+// messages for the alert rules. When the number of messages matching a
+// rule in its window reaches the threshold, the alerting sender sends
+// an alert message to the alerts Sender, such as a Slack or email
+// sender, and when the number falls back to the resolve threshold, a
+// resolution message. The alert messages are Fields with the name of
+// the rule ("alert"), its "state" ("firing" or "resolved"), the
+// "count" and "threshold", the "window", and the string form of the
+// last matching message ("last_message").
+//
+// This Sender does not own the underlying Sender or the alerts Sender,
+// so users are responsible for closing them if/when it is appropriate
+// to release their resources. Close stops watching for the resolution
+// of alerts.
+func NewAlertingSender(ctx context.Context, sender, alerts Sender, opts AlertOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		return nil, errors.New("must specify a sender for alerts")
+	}
+
+	s := &alertingSender{
+		opts:   opts,
+		alerts: alerts,
+		Sender: sender,
+	}
+	for _, rule := range opts.Rules {
+		s.states = append(s.states, newAlertState(rule))
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.watch(ctx)
+
+	return s, nil
+}
+
+func (s *alertingSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	s.Sender.Send(ctx, m)
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	for _, c := range msgs {
+		if !s.Level().ShouldLog(c) {
+			continue
+		}
+		for _, state := range s.states {
+			if state.matches(c) {
+				state.add(now)
+				state.last = c.String()
+			}
+		}
+	}
+	out := s.check(now, nil)
+	s.mu.Unlock()
+
+	for _, alert := range out {
+		s.alerts.Send(ctx, alert)
+	}
+}
+
+// check updates the state of the alerts, appending any alert and
+// resolution messages to out. The caller must hold the lock.
+func (s *alertingSender) check(now time.Time, out []message.Composer) []message.Composer {
+	for _, state := range s.states {
+		count := state.count(now)
+		switch {
+		case !state.firing && count >= state.rule.Threshold:
+			if !state.lastAlert.IsZero() && now.Sub(state.lastAlert) < state.rule.Cooldown {
+				continue
+			}
+			state.firing = true
+			state.firedAt = now
+			state.lastAlert = now
+			out = append(out, s.alertMessage(state, s.opts.AlertPriority, "firing", count,
+				fmt.Sprintf("alert '%s' is firing: %d matching messages in %s", state.rule.Name, count, state.rule.Window)))
+		case state.firing && count <= state.rule.ResolveThreshold:
+			state.firing = false
+			out = append(out, s.alertMessage(state, s.opts.ResolvePriority, "resolved", count,
+				fmt.Sprintf("alert '%s' resolved after %s: %d matching messages in %s", state.rule.Name, now.Sub(state.firedAt).Round(time.Millisecond), count, state.rule.Window)))
+		}
+	}
+
+	return out
+}
+
+func (s *alertingSender) alertMessage(state *alertState, p level.Priority, status string, count int, msg string) message.Composer {
+	return message.NewFields(p, message.Fields{
+		message.FieldsMsgName: msg,
+		"alert":               state.rule.Name,
+		"state":               status,
+		"count":               count,
+		"threshold":           state.rule.Threshold,
+		"window":              state.rule.Window.String(),
+		"last_message":        state.last,
+	})
+}
+
+// watch checks firing alerts for resolution until the context is
+// canceled.
+func (s *alertingSender) watch(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				return
+			}
+			out := s.check(now, nil)
+			s.mu.Unlock()
+
+			for _, alert := range out {
+				s.alerts.Send(ctx, alert)
+			}
+		}
+	}
+}
+
+// Close stops watching for the resolution of alerts. This does not
+// close the underlying sender or the alerts sender.
+func (s *alertingSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.cancel()
+
+	return nil
+}
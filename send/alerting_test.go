@@ -0,0 +1,192 @@
+package send
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertingSender(t *testing.T) {
+	newAlertingSender := func(t *testing.T, opts AlertOptions) (Sender, *InternalSender, *InternalSender) {
+		logs, err := NewInternalLogger("logs", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+		alerts, err := NewInternalLogger("alerts", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+
+		s, err := NewAlertingSender(t.Context(), logs, alerts, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+
+		return s, logs, alerts
+	}
+	alertState := func(t *testing.T, m *InternalMessage) string {
+		fields, ok := m.Message.Raw().(message.Fields)
+		require.True(t, ok)
+		return fields["state"].(string)
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []AlertOptions{
+			{},
+			{Rules: []AlertRule{{Threshold: 1, Window: time.Second}}},
+			{Rules: []AlertRule{{Name: "errors", Window: time.Second}}},
+			{Rules: []AlertRule{{Name: "errors", Threshold: 2, ResolveThreshold: 2, Window: time.Second}}},
+			{Rules: []AlertRule{{Name: "errors", Threshold: 2}}},
+		} {
+			s, err := NewAlertingSender(t.Context(), nil, nil, opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("FiresAndResolves", func(t *testing.T) {
+		s, logs, alerts := newAlertingSender(t, AlertOptions{
+			Rules: []AlertRule{{
+				Name:        "errors",
+				MinPriority: level.Error,
+				Threshold:   3,
+				Window:      100 * time.Millisecond,
+			}},
+			CheckInterval: 5 * time.Millisecond,
+		})
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "first"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "not counted"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Critical, "second"))
+		assert.False(t, alerts.HasMessage())
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Error, "third"),
+			message.NewDefaultMessage(level.Error, "fourth"),
+		))
+		assert.Equal(t, 4, logs.Len(), "all messages are passed through")
+
+		alert := alerts.GetMessage()
+		assert.Equal(t, level.Alert, alert.Message.Priority())
+		assert.Equal(t, "firing", alertState(t, alert))
+		fields := alert.Message.Raw().(message.Fields)
+		assert.Equal(t, "errors", fields["alert"])
+		assert.Equal(t, 4, fields["count"])
+		assert.Equal(t, "fourth", fields["last_message"])
+		assert.False(t, alerts.HasMessage(), "firing alerts are not repeated")
+
+		require.Eventually(t, alerts.HasMessage, time.Second, time.Millisecond)
+		resolved := alerts.GetMessage()
+		assert.Equal(t, level.Notice, resolved.Message.Priority())
+		assert.Equal(t, "resolved", alertState(t, resolved))
+	})
+	t.Run("Hysteresis", func(t *testing.T) {
+		s, _, alerts := newAlertingSender(t, AlertOptions{
+			Rules: []AlertRule{{
+				Name:             "errors",
+				Threshold:        3,
+				ResolveThreshold: 1,
+				Window:           time.Hour,
+			}},
+			CheckInterval: time.Millisecond,
+		})
+		for i := 0; i < 3; i++ {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed"))
+		}
+		assert.Equal(t, "firing", alertState(t, alerts.GetMessage()))
+
+		// Dropping below the threshold does not resolve the alert
+		// until the count reaches the resolve threshold.
+		as := s.(*alertingSender)
+		drop := func() {
+			as.mu.Lock()
+			defer as.mu.Unlock()
+			state := as.states[0]
+			for idx := range state.counts {
+				if state.counts[idx] > 0 {
+					state.counts[idx]--
+					return
+				}
+			}
+		}
+		drop()
+		time.Sleep(20 * time.Millisecond)
+		assert.False(t, alerts.HasMessage())
+
+		drop()
+		require.Eventually(t, alerts.HasMessage, time.Second, time.Millisecond)
+		assert.Equal(t, "resolved", alertState(t, alerts.GetMessage()))
+	})
+	t.Run("Cooldown", func(t *testing.T) {
+		s, _, alerts := newAlertingSender(t, AlertOptions{
+			Rules: []AlertRule{{
+				Name:      "errors",
+				Threshold: 1,
+				Window:    20 * time.Millisecond,
+				Cooldown:  time.Hour,
+			}},
+			CheckInterval: time.Millisecond,
+		})
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed"))
+		assert.Equal(t, "firing", alertState(t, alerts.GetMessage()))
+		require.Eventually(t, alerts.HasMessage, time.Second, time.Millisecond)
+		assert.Equal(t, "resolved", alertState(t, alerts.GetMessage()))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed again"))
+		time.Sleep(10 * time.Millisecond)
+		assert.False(t, alerts.HasMessage())
+	})
+	t.Run("FieldValue", func(t *testing.T) {
+		s, _, alerts := newAlertingSender(t, AlertOptions{
+			Rules: []AlertRule{{
+				Name:      "unavailable",
+				Field:     "status",
+				Value:     503,
+				Threshold: 2,
+				Window:    time.Hour,
+			}},
+			AlertPriority: level.Emergency,
+		})
+
+		s.Send(t.Context(), message.NewFields(level.Info, message.Fields{"status": 503}))
+		s.Send(t.Context(), message.NewFields(level.Info, message.Fields{"status": 200}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "no status"))
+		assert.False(t, alerts.HasMessage())
+
+		s.Send(t.Context(), message.NewFields(level.Info, message.Fields{"status": 503}))
+		alert := alerts.GetMessage()
+		assert.Equal(t, level.Emergency, alert.Message.Priority())
+		assert.Equal(t, "unavailable", alert.Message.Raw().(message.Fields)["alert"])
+	})
+	t.Run("DefaultCheckInterval", func(t *testing.T) {
+		opts := AlertOptions{Rules: []AlertRule{
+			{Name: "slow", Threshold: 1, Window: time.Minute},
+			{Name: "fast", Threshold: 1, Window: 5 * time.Nanosecond},
+		}}
+		s, _, _ := newAlertingSender(t, opts)
+		assert.Equal(t, minAlertCheckInterval, s.(*alertingSender).opts.CheckInterval)
+	})
+	t.Run("BucketedWindow", func(t *testing.T) {
+		state := newAlertState(AlertRule{Name: "errors", Threshold: 1, Window: 20 * time.Second})
+		start := time.Unix(1000, 0)
+		for i := 0; i < 1000; i++ {
+			state.add(start.Add(time.Duration(i) * time.Millisecond))
+		}
+		state.add(start.Add(10 * time.Second))
+		assert.Equal(t, 1001, state.count(start.Add(10*time.Second)))
+		assert.Equal(t, 1, state.count(start.Add(25*time.Second)), "buckets outside of the window are not counted")
+		assert.Equal(t, 0, state.count(start.Add(31*time.Second)))
+	})
+	t.Run("CloseStopsWatching", func(t *testing.T) {
+		s, logs, alerts := newAlertingSender(t, AlertOptions{
+			Rules:         []AlertRule{{Name: "errors", Threshold: 1, Window: 10 * time.Millisecond}},
+			CheckInterval: time.Millisecond,
+		})
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed"))
+		require.NoError(t, s.Close())
+		assert.Equal(t, "firing", alertState(t, alerts.GetMessage()))
+		time.Sleep(30 * time.Millisecond)
+		assert.False(t, alerts.HasMessage())
+		assert.Equal(t, 1, logs.Len())
+	})
+}
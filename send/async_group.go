@@ -10,41 +10,90 @@ import (
 )
 
 type asyncGroupSender struct {
-	pipes   []chan message.Composer
-	senders []Sender
-	cancel  context.CancelFunc
+	ctx      context.Context
+	pipes    []chan message.Composer
+	senders  []Sender
+	cancel   context.CancelFunc
+	overflow OverflowOptions
+	counters asyncCounters
 	*Base
 }
 
+// AsyncGroupSenderOptions configure the asynchronous group sender.
+type AsyncGroupSenderOptions struct {
+	// BufferSize is the number of messages that each of the
+	// underlying senders can hold in waiting.
+	BufferSize int
+	// Overflow configures what to do with messages for an
+	// underlying sender whose buffer is full. By default, Send
+	// blocks until there is room in the buffer.
+	Overflow OverflowOptions
+}
+
+func (opts *AsyncGroupSenderOptions) validate() error {
+	if opts.BufferSize < 0 {
+		return errors.New("BufferSize cannot be negative")
+	}
+
+	return opts.Overflow.validate(OverflowBlock, opts.BufferSize)
+}
+
 // NewAsyncGroupSender produces an implementation of the Sender interface that,
 // like the MultiSender, distributes a single message to a group of underlying
 // sender implementations.
 //
 // This sender does not guarantee ordering of messages, and Send operations may
-// if the underlying senders fall behind the buffer size.
+// block if the underlying senders fall behind the buffer size. Use
+// NewAsyncGroupSenderWithOptions to configure what happens when a buffer is
+// full.
 //
 // The sender takes ownership of the underlying Senders, so closing this sender
 // closes all underlying Senders.
 func NewAsyncGroupSender(ctx context.Context, bufferSize int, senders ...Sender) Sender {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	s, _ := NewAsyncGroupSenderWithOptions(ctx, AsyncGroupSenderOptions{BufferSize: bufferSize}, senders...)
+
+	return s
+}
+
+// NewAsyncGroupSenderWithOptions is the same as NewAsyncGroupSender, but
+// configures the overflow policy of the buffers of the underlying senders.
+// With the OverflowSpill policy, the fallback sender receives a message once
+// for each of the underlying senders whose buffer is full. Use
+// GetAsyncStats to get the counters of the sender.
+//
+// When messages remain in the buffers, Close returns an *AsyncBacklogError.
+//
+// The sender takes ownership of the underlying Senders, so closing this sender
+// closes all underlying Senders.
+func NewAsyncGroupSenderWithOptions(ctx context.Context, opts AsyncGroupSenderOptions, senders ...Sender) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
 	s := &asyncGroupSender{
-		senders: senders,
-		Base:    NewBase(""),
+		senders:  senders,
+		overflow: opts.Overflow,
+		Base:     NewBase(""),
 	}
-	ctx, s.cancel = context.WithCancel(ctx)
+	s.ctx, s.cancel = context.WithCancel(ctx)
 
 	for i := 0; i < len(senders); i++ {
-		p := make(chan message.Composer, bufferSize)
+		p := make(chan message.Composer, opts.BufferSize)
 		s.pipes = append(s.pipes, p)
 		go func(pipe chan message.Composer, sender Sender) {
 			for {
 				select {
-				case <-ctx.Done():
+				case <-s.ctx.Done():
 					return
 				case m := <-pipe:
 					if m == nil {
 						continue
 					}
-					sender.Send(ctx, m)
+					sender.Send(s.ctx, m)
+					s.counters.delivered.Add(1)
 				}
 			}
 		}(p, senders[i])
@@ -59,22 +108,23 @@ func NewAsyncGroupSender(ctx context.Context, bufferSize int, senders ...Sender)
 				errs = append(errs, err.Error())
 			}
 		}
-
-		for idx, pipe := range s.pipes {
-			if len(pipe) > 0 {
-				errs = append(errs, fmt.Sprintf("buffer for sender #%d has %d items remaining", idx, len(pipe)))
-
-			}
-			close(pipe)
+		var err error
+		if len(errs) > 0 {
+			err = errors.New(strings.Join(errs, "\n"))
 		}
 
-		if len(errs) > 0 {
-			return errors.New(strings.Join(errs, "\n"))
+		backlog := &AsyncBacklogError{Err: err}
+		for _, pipe := range s.pipes {
+			backlog.Remaining = append(backlog.Remaining, len(pipe))
+		}
+		if backlog.Backlog() > 0 {
+			backlog.Stats = s.counters.stats()
+			return backlog
 		}
 
-		return nil
+		return err
 	}
-	return s
+	return s, nil
 }
 
 func (s *asyncGroupSender) SetLevel(l LevelInfo) error {
@@ -101,8 +151,16 @@ func (s *asyncGroupSender) Send(ctx context.Context, m message.Composer) {
 		return
 	}
 
+	if err := s.ctx.Err(); err != nil {
+		s.ErrorHandler()(ctx, fmt.Errorf("sending message: %w", err), m)
+		return
+	}
+
 	for _, p := range s.pipes {
-		p <- m
+		dropped, err := s.counters.enqueue(ctx, s.ctx, s.overflow, p, m)
+		for _, msg := range dropped {
+			s.ErrorHandler()(ctx, err, msg)
+		}
 	}
 }
 
@@ -2,11 +2,17 @@ package send
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mongodb/grip/level"
 	"github.com/mongodb/grip/message"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAsyncGroupSender(t *testing.T) {
@@ -42,3 +48,194 @@ func TestAsyncGroupSender(t *testing.T) {
 	assert.NoError(s.Flush(t.Context()))
 	assert.NoError(s.Close())
 }
+
+// blockingSender holds each message in Send until it is released.
+type blockingSender struct {
+	started chan message.Composer
+	release chan struct{}
+	*InternalSender
+}
+
+func newBlockingSender(t *testing.T) *blockingSender {
+	s, err := NewInternalLogger("blocking", LevelInfo{level.Debug, level.Debug})
+	require.NoError(t, err)
+	return &blockingSender{
+		started:        make(chan message.Composer, 100),
+		release:        make(chan struct{}),
+		InternalSender: s,
+	}
+}
+
+func (s *blockingSender) Send(ctx context.Context, m message.Composer) {
+	s.started <- m
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+	s.InternalSender.Send(ctx, m)
+}
+
+func TestAsyncGroupSenderOverflow(t *testing.T) {
+	// newFullSender returns a sender whose underlying sender is
+	// blocked on the first message and whose buffer holds the
+	// second.
+	newFullSender := func(t *testing.T, overflow OverflowOptions) (Sender, *blockingSender, *[]error) {
+		blocking := newBlockingSender(t)
+		s, err := NewAsyncGroupSenderWithOptions(t.Context(), AsyncGroupSenderOptions{BufferSize: 1, Overflow: overflow}, blocking)
+		require.NoError(t, err)
+		require.NoError(t, s.SetLevel(LevelInfo{level.Debug, level.Debug}))
+		errs := &[]error{}
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, m message.Composer) {
+			*errs = append(*errs, fmt.Errorf("%s: %w", m.String(), err))
+		}))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+		assert.Equal(t, "first", (<-blocking.started).String())
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+
+		return s, blocking, errs
+	}
+	waitDelivered := func(t *testing.T, s Sender, n int64) {
+		require.Eventually(t, func() bool {
+			stats, err := GetAsyncStats(s)
+			return err == nil && stats.Delivered == n
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []AsyncGroupSenderOptions{
+			{BufferSize: -1},
+			{Overflow: OverflowOptions{Policy: "explode"}},
+			{Overflow: OverflowOptions{Policy: OverflowSpill}},
+			{Overflow: OverflowOptions{Timeout: -1}},
+			{Overflow: OverflowOptions{Policy: OverflowDropOldest}},
+		} {
+			s, err := NewAsyncGroupSenderWithOptions(t.Context(), opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("DropNewest", func(t *testing.T) {
+		s, blocking, errs := newFullSender(t, OverflowOptions{Policy: OverflowDropNewest})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+		require.Len(t, *errs, 1)
+		assert.Equal(t, "third: the message was dropped because the buffer was full", (*errs)[0].Error())
+
+		close(blocking.release)
+		assert.Equal(t, "second", (<-blocking.started).String())
+		require.Eventually(t, func() bool { return blocking.Len() == 2 }, time.Second, time.Millisecond)
+
+		stats, err := GetAsyncStats(s)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, stats.Queued)
+		assert.EqualValues(t, 1, stats.Dropped)
+		waitDelivered(t, s, 2)
+		assert.NoError(t, s.Close())
+	})
+	t.Run("DropOldest", func(t *testing.T) {
+		s, blocking, errs := newFullSender(t, OverflowOptions{Policy: OverflowDropOldest})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+		require.Len(t, *errs, 1)
+		assert.Equal(t, "second: the oldest message was dropped because the buffer was full", (*errs)[0].Error())
+
+		close(blocking.release)
+		assert.Equal(t, "third", (<-blocking.started).String())
+
+		stats, err := GetAsyncStats(s)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, stats.Queued)
+		assert.EqualValues(t, 1, stats.Dropped)
+		waitDelivered(t, s, 2)
+		assert.NoError(t, s.Close())
+	})
+	t.Run("DropOldestReportsEveryMessage", func(t *testing.T) {
+		blocking := newBlockingSender(t)
+		s, err := NewAsyncGroupSenderWithOptions(t.Context(), AsyncGroupSenderOptions{
+			BufferSize: 1,
+			Overflow:   OverflowOptions{Policy: OverflowDropOldest},
+		}, blocking)
+		require.NoError(t, err)
+		require.NoError(t, s.SetLevel(LevelInfo{level.Debug, level.Debug}))
+		var reported atomic.Int64
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, _ error, _ message.Composer) {
+			reported.Add(1)
+		}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+		<-blocking.started
+
+		// Concurrent senders can drop several messages to make
+		// room for one.
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					s.Send(t.Context(), message.NewDefaultMessage(level.Info, "message"))
+				}
+			}()
+		}
+		wg.Wait()
+
+		stats, err := GetAsyncStats(s)
+		require.NoError(t, err)
+		assert.EqualValues(t, 799, stats.Dropped)
+		assert.EqualValues(t, stats.Dropped, reported.Load())
+		close(blocking.release)
+		waitDelivered(t, s, 2)
+		assert.NoError(t, s.Close())
+	})
+	t.Run("Spill", func(t *testing.T) {
+		fallback, err := NewInternalLogger("fallback", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+		s, blocking, errs := newFullSender(t, OverflowOptions{Policy: OverflowSpill, Fallback: fallback})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+		assert.Empty(t, *errs)
+		assert.Equal(t, "third", fallback.GetMessage().Message.String())
+
+		stats, err := GetAsyncStats(s)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, stats.Spilled)
+		close(blocking.release)
+		waitDelivered(t, s, 2)
+		assert.NoError(t, s.Close())
+	})
+	t.Run("BlockWithTimeout", func(t *testing.T) {
+		s, blocking, errs := newFullSender(t, OverflowOptions{Policy: OverflowBlock, Timeout: 20 * time.Millisecond})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+		require.Len(t, *errs, 1)
+		assert.Contains(t, (*errs)[0].Error(), "third: the message was dropped after blocking for 20ms")
+
+		stats, err := GetAsyncStats(s)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, stats.BlockedTime, 20*time.Millisecond)
+		assert.EqualValues(t, 1, stats.Dropped)
+
+		// A blocked message is queued when there is room.
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			blocking.release <- struct{}{}
+		}()
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "fourth"))
+		assert.Len(t, *errs, 1)
+		close(blocking.release)
+		waitDelivered(t, s, 3)
+		assert.NoError(t, s.Close())
+	})
+	t.Run("CloseReportsBacklog", func(t *testing.T) {
+		s, _, _ := newFullSender(t, OverflowOptions{})
+
+		err := s.Close()
+		require.Error(t, err)
+		var backlog *AsyncBacklogError
+		require.True(t, errors.As(err, &backlog))
+		assert.Equal(t, []int{1}, backlog.Remaining)
+		assert.Equal(t, 1, backlog.Backlog())
+		assert.EqualValues(t, 2, backlog.Stats.Queued)
+		assert.Contains(t, err.Error(), "buffer for sender #0 has 1 items remaining")
+	})
+	t.Run("StatsRequireAsyncSender", func(t *testing.T) {
+		_, err := GetAsyncStats(newBlockingSender(t))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,239 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/grip/message"
+)
+
+// OverflowPolicy is what an asynchronous sender does with messages
+// when its buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock blocks Send until there is room in the buffer,
+	// the Timeout passes, or the sender is closed, and drops the
+	// message if there is no room.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest drops the message being sent.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDropOldest drops the oldest message in the buffer to
+	// make room for the message being sent. The buffer must have
+	// room for at least one message.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowSpill sends the message to the Fallback sender
+	// instead.
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// OverflowOptions configure what an asynchronous sender does when its
+// buffer is full.
+type OverflowOptions struct {
+	// Policy is the overflow policy. The default depends on the
+	// sender.
+	Policy OverflowPolicy
+	// Timeout is how long Send blocks with the OverflowBlock
+	// policy. Zero blocks until there is room in the buffer or the
+	// sender is closed.
+	Timeout time.Duration
+	// Fallback is the sender of the messages that overflow with the
+	// OverflowSpill policy. The asynchronous sender does not own the
+	// fallback sender.
+	Fallback Sender
+}
+
+// validate checks the options for a buffer with room for capacity
+// messages.
+func (opts *OverflowOptions) validate(defaultPolicy OverflowPolicy, capacity int) error {
+	catcher := []string{}
+	switch opts.Policy {
+	case "":
+		opts.Policy = defaultPolicy
+	case OverflowBlock, OverflowDropNewest:
+	case OverflowDropOldest:
+		if capacity <= 0 {
+			catcher = append(catcher, "the drop-oldest overflow policy requires a buffer")
+		}
+	case OverflowSpill:
+		if opts.Fallback == nil {
+			catcher = append(catcher, "must specify a fallback sender to spill to")
+		}
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid overflow policy '%s'", opts.Policy))
+	}
+	if opts.Timeout < 0 {
+		catcher = append(catcher, "overflow timeout cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+// AsyncStats are the counters of an asynchronous sender.
+type AsyncStats struct {
+	// Queued is the number of messages added to the buffer.
+	Queued int64 `bson:"queued" json:"queued" yaml:"queued"`
+	// Delivered is the number of messages passed from the buffer to
+	// the underlying senders.
+	Delivered int64 `bson:"delivered" json:"delivered" yaml:"delivered"`
+	// Dropped is the number of messages dropped because the buffer
+	// was full.
+	Dropped int64 `bson:"dropped" json:"dropped" yaml:"dropped"`
+	// Spilled is the number of messages sent to the fallback sender
+	// because the buffer was full.
+	Spilled int64 `bson:"spilled" json:"spilled" yaml:"spilled"`
+	// BlockedTime is the total time that Send blocked waiting for
+	// room in the buffer.
+	BlockedTime time.Duration `bson:"blocked_time" json:"blocked_time" yaml:"blocked_time"`
+}
+
+// GetAsyncStats returns the counters of an asynchronous sender, as
+// constructed by NewAsyncGroupSender or NewBufferedAsyncSender.
+//
+// Returns an error if the Sender is not an asynchronous sender.
+func GetAsyncStats(s Sender) (AsyncStats, error) {
+	switch sender := s.(type) {
+	case *asyncGroupSender:
+		return sender.counters.stats(), nil
+	case *bufferedAsyncSender:
+		return sender.counters.stats(), nil
+	default:
+		return AsyncStats{}, fmt.Errorf("%s is not an asynchronous sender", s.Name())
+	}
+}
+
+// AsyncBacklogError is the error that asynchronous senders return from
+// Close when messages remain undelivered in their buffers.
+type AsyncBacklogError struct {
+	// Remaining is the number of undelivered messages in the buffer
+	// of each underlying sender, in order.
+	Remaining []int
+	// Stats are the counters of the sender when it was closed.
+	Stats AsyncStats
+	// Err is any other error that occurred while closing.
+	Err error
+}
+
+// Backlog returns the total number of undelivered messages.
+func (e *AsyncBacklogError) Backlog() int {
+	total := 0
+	for _, n := range e.Remaining {
+		total += n
+	}
+
+	return total
+}
+
+func (e *AsyncBacklogError) Error() string {
+	errs := []string{}
+	if e.Err != nil {
+		errs = append(errs, e.Err.Error())
+	}
+	for idx, n := range e.Remaining {
+		if n > 0 {
+			errs = append(errs, fmt.Sprintf("buffer for sender #%d has %d items remaining", idx, n))
+		}
+	}
+
+	return strings.Join(errs, "\n")
+}
+
+func (e *AsyncBacklogError) Unwrap() error { return e.Err }
+
+// asyncCounters are the counters of an asynchronous sender.
+type asyncCounters struct {
+	queued    atomic.Int64
+	delivered atomic.Int64
+	dropped   atomic.Int64
+	spilled   atomic.Int64
+	blocked   atomic.Int64
+}
+
+func (c *asyncCounters) stats() AsyncStats {
+	return AsyncStats{
+		Queued:      c.queued.Load(),
+		Delivered:   c.delivered.Load(),
+		Dropped:     c.dropped.Load(),
+		Spilled:     c.spilled.Load(),
+		BlockedTime: time.Duration(c.blocked.Load()),
+	}
+}
+
+// enqueue adds a message to a buffer, applying the overflow policy if
+// the buffer is full. If messages are dropped, it returns the dropped
+// messages, which are not m with the OverflowDropOldest policy, and an
+// error for the caller to report for each of them. With the
+// OverflowDropOldest policy, more than one message is dropped when
+// other senders fill the buffer first. Blocking stops when either
+// context is done.
+func (c *asyncCounters) enqueue(ctx, senderCtx context.Context, opts OverflowOptions, pipe chan message.Composer, m message.Composer) ([]message.Composer, error) {
+	select {
+	case pipe <- m:
+		c.queued.Add(1)
+		return nil, nil
+	default:
+	}
+
+	switch opts.Policy {
+	case OverflowDropOldest:
+		var dropped []message.Composer
+		for {
+			select {
+			case pipe <- m:
+				c.queued.Add(1)
+				if len(dropped) > 0 {
+					return dropped, errors.New("the oldest message was dropped because the buffer was full")
+				}
+				return nil, nil
+			default:
+			}
+
+			select {
+			case old := <-pipe:
+				c.dropped.Add(1)
+				dropped = append(dropped, old)
+			default:
+			}
+		}
+	case OverflowSpill:
+		opts.Fallback.Send(ctx, m)
+		c.spilled.Add(1)
+		return nil, nil
+	case OverflowBlock:
+		var timeout <-chan time.Time
+		if opts.Timeout > 0 {
+			timer := time.NewTimer(opts.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		start := time.Now()
+		defer func() { c.blocked.Add(int64(time.Since(start))) }()
+
+		select {
+		case pipe <- m:
+			c.queued.Add(1)
+			return nil, nil
+		case <-timeout:
+			c.dropped.Add(1)
+			return []message.Composer{m}, fmt.Errorf("the message was dropped after blocking for %s because the buffer was full", opts.Timeout)
+		case <-ctx.Done():
+			c.dropped.Add(1)
+			return []message.Composer{m}, fmt.Errorf("the message was dropped while blocked on a full buffer: %w", ctx.Err())
+		case <-senderCtx.Done():
+			c.dropped.Add(1)
+			return []message.Composer{m}, fmt.Errorf("the message was dropped while blocked on a full buffer: %w", senderCtx.Err())
+		}
+	default:
+		c.dropped.Add(1)
+		return []message.Composer{m}, errors.New("the message was dropped because the buffer was full")
+	}
+}
@@ -0,0 +1,160 @@
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// messageDocument returns the Raw form of a message as a document,
+// normalized through JSON, so numbers are json.Number values, and
+// nested documents and arrays are map[string]interface{} and
+// []interface{} values. Raw forms that are not documents are stored
+// in the "message" field.
+func messageDocument(m message.Composer) (map[string]interface{}, error) {
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok {
+		raw = c.Raw()
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if doc, ok := value.(map[string]interface{}); ok {
+		return doc, nil
+	}
+
+	return map[string]interface{}{message.FieldsMsgName: value}, nil
+}
+
+// messageAttributes returns the structured data of a message for
+// senders that map messages onto key-value attributes: the fields of
+// the message's document (see messageDocument) and the annotations
+// stored in the message's metadata. The message's "message" field and
+// the remaining metadata are omitted.
+func messageAttributes(m message.Composer) map[string]interface{} {
+	doc, err := messageDocument(m)
+	if err != nil {
+		return nil
+	}
+
+	attrs := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		switch k {
+		case "metadata":
+			if md, ok := v.(map[string]interface{}); ok {
+				if annotations, ok := md["context"].(map[string]interface{}); ok {
+					for ak, av := range annotations {
+						attrs[ak] = av
+					}
+				}
+			}
+		case message.FieldsMsgName:
+		default:
+			attrs[k] = v
+		}
+	}
+
+	return attrs
+}
+
+// messageTime returns the time recorded in the metadata of a message
+// (see messageBase), or the current time for messages without one.
+func messageTime(m message.Composer) time.Time {
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok {
+		raw = c.Raw()
+	}
+	if b := messageBase(raw); b != nil && !b.Time.IsZero() {
+		return b.Time
+	}
+
+	return time.Now()
+}
+
+// stackFramesKey is the field that holds the stack trace of
+// message.Fields payloads wrapped by the message.Stack composers.
+const stackFramesKey = "stack.frames"
+
+// messageStack returns the stack trace captured by the message.Stack
+// composers, if any, and the attributes of the message (see
+// messageAttributes) without the trace.
+func messageStack(m message.Composer) ([]message.StackFrame, map[string]interface{}) {
+	attrs := messageAttributes(m)
+
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok {
+		raw = c.Raw()
+	}
+
+	var frames []message.StackFrame
+	switch payload := raw.(type) {
+	case message.StackTrace:
+		frames = payload.Frames
+		delete(attrs, "frames")
+		delete(attrs, "context")
+	case message.Fields:
+		if trace, ok := payload[stackFramesKey]; ok {
+			if data, err := json.Marshal(trace); err == nil {
+				_ = json.Unmarshal(data, &frames)
+			}
+			delete(attrs, stackFramesKey)
+		}
+	}
+
+	return frames, attrs
+}
+
+// documentMessage is a message rebuilt from its string form and a Raw
+// form, such as a message read back from storage or a copy of a
+// recorded message.
+type documentMessage struct {
+	message string
+	raw     interface{}
+	message.Base
+}
+
+func newDocumentMessage(p level.Priority, msg string, raw interface{}) message.Composer {
+	m := &documentMessage{message: msg, raw: raw}
+	_ = m.SetPriority(p)
+
+	return m
+}
+
+func (m *documentMessage) String() string { return m.message }
+
+func (m *documentMessage) Loggable() bool { return m.message != "" || m.raw != nil }
+
+func (m *documentMessage) Raw() interface{} {
+	if m.raw == nil {
+		return m.message
+	}
+
+	return m.raw
+}
+
+func (m *documentMessage) Annotate(key string, value interface{}) error {
+	doc, ok := m.raw.(map[string]interface{})
+	if !ok {
+		return m.Base.Annotate(key, value)
+	}
+	if _, ok := doc[key]; ok {
+		return fmt.Errorf("key '%s' already exists", key)
+	}
+	doc[key] = value
+
+	return nil
+}
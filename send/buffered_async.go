@@ -22,6 +22,8 @@ type bufferedAsyncSender struct {
 	flushTimer *time.Timer
 	incoming   chan message.Composer
 	needsFlush chan bool
+	counters   asyncCounters
+	done       chan struct{}
 
 	Sender
 }
@@ -49,6 +51,7 @@ func NewBufferedAsyncSender(ctx context.Context, sender Sender, opts BufferedAsy
 		buffer:     make([]message.Composer, 0, opts.BufferSize),
 		needsFlush: make(chan bool, 1),
 		incoming:   make(chan message.Composer, opts.IncomingBufferFactor*opts.BufferSize),
+		done:       make(chan struct{}),
 	}
 
 	fallback := log.New(os.Stdout, "", log.LstdFlags)
@@ -69,6 +72,14 @@ type BufferedAsyncSenderOptions struct {
 	// while the number of messages waiting to be written to the buffer exceeds
 	// BufferSize * IncomingBufferFactor.
 	IncomingBufferFactor int
+	// Overflow configures what to do with messages that are sent
+	// when the number of messages waiting to be written to the
+	// buffer is at the limit. By default, they are dropped.
+	Overflow OverflowOptions
+	// CloseTimeout bounds the final flush when the sender is
+	// closed: the underlying sender receives a context that expires
+	// after this duration. Defaults to FlushInterval.
+	CloseTimeout time.Duration
 }
 
 func (opts *BufferedAsyncSenderOptions) validate() error {
@@ -84,14 +95,23 @@ func (opts *BufferedAsyncSenderOptions) validate() error {
 		opts.IncomingBufferFactor = defaultIncomingBufferFactor
 	}
 
-	return nil
+	if opts.CloseTimeout < 0 {
+		return errors.New("CloseTimeout cannot be negative")
+	}
+
+	if opts.CloseTimeout == 0 {
+		opts.CloseTimeout = opts.FlushInterval
+	}
+
+	return opts.Overflow.validate(OverflowDropNewest, opts.IncomingBufferFactor*opts.BufferSize)
 }
 
 // Send puts the message in the buffer to be flushed on the next flush interval
 // or when the buffer threshold is surpassed. It will return immediately and not block
 // on the underlying sender sending the messages.
 // If the number of messages being currently processed exceeds the processing limit,
-// any new messages will be dropped until the number of messages is below the limit.
+// the overflow policy applies to new messages until the number of messages is
+// below the limit.
 func (s *bufferedAsyncSender) Send(ctx context.Context, msg message.Composer) {
 	if err := s.ctx.Err(); err != nil {
 		s.ErrorHandler()(ctx, errors.Wrap(err, "sending message"), msg)
@@ -101,10 +121,9 @@ func (s *bufferedAsyncSender) Send(ctx context.Context, msg message.Composer) {
 		return
 	}
 
-	select {
-	case s.incoming <- msg:
-	default:
-		s.ErrorHandler()(ctx, errors.New("the message was dropped because the buffer was full"), msg)
+	dropped, err := s.counters.enqueue(ctx, s.ctx, s.opts.Overflow, s.incoming, msg)
+	for _, m := range dropped {
+		s.ErrorHandler()(ctx, err, m)
 	}
 }
 
@@ -121,15 +140,28 @@ func (s *bufferedAsyncSender) Flush(_ context.Context) error {
 	return nil
 }
 
-// Close flushes any buffered messages asynchronously
-// and signals that the sender should stop processing additional messages.
+// Close signals that the sender should stop processing additional messages,
+// and blocks until the buffered messages are flushed to the underlying
+// sender. The final flush is not canceled with the sender's context, but
+// the context passed to the underlying sender expires after the
+// CloseTimeout. If messages remain unflushed, Close returns an
+// *AsyncBacklogError.
 func (s *bufferedAsyncSender) Close() error {
 	s.cancel()
+	<-s.done
+
+	if remaining := len(s.incoming) + len(s.buffer); remaining > 0 {
+		return &AsyncBacklogError{
+			Remaining: []int{remaining},
+			Stats:     s.counters.stats(),
+		}
+	}
 
 	return nil
 }
 
 func (s *bufferedAsyncSender) processMessages() {
+	defer close(s.done)
 	defer func() {
 		if r := recover(); r != nil {
 			s.ErrorHandler()(s.ctx, errors.New("panic in processMessages loop"), message.NewString(""))
@@ -142,40 +174,46 @@ func (s *bufferedAsyncSender) processMessages() {
 	for {
 		select {
 		case <-s.ctx.Done():
-			s.flushAll()
+			// The context is canceled when the sender is
+			// closed, but the remaining messages must still
+			// be sent.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), s.opts.CloseTimeout)
+			s.flushAll(ctx)
+			cancel()
 			return
 		case msg := <-s.incoming:
-			s.addToBuffer(msg)
+			s.addToBuffer(s.ctx, msg)
 		case <-s.needsFlush:
-			s.flushAll()
+			s.flushAll(s.ctx)
 		case <-s.flushTimer.C:
-			s.flush()
+			s.flush(s.ctx)
 		}
 	}
 }
 
-func (s *bufferedAsyncSender) flushAll() {
+func (s *bufferedAsyncSender) flushAll(ctx context.Context) {
 	lenIncoming := len(s.incoming)
 	for x := 0; x < lenIncoming; x++ {
-		s.addToBuffer(<-s.incoming)
+		s.addToBuffer(ctx, <-s.incoming)
 	}
 
-	s.flush()
+	s.flush(ctx)
 }
 
-func (s *bufferedAsyncSender) addToBuffer(msg message.Composer) {
+func (s *bufferedAsyncSender) addToBuffer(ctx context.Context, msg message.Composer) {
 	s.buffer = append(s.buffer, msg)
 	if len(s.buffer) == cap(s.buffer) {
-		s.flush()
+		s.flush(ctx)
 	}
 }
 
-func (s *bufferedAsyncSender) flush() {
+func (s *bufferedAsyncSender) flush(ctx context.Context) {
 	if len(s.buffer) == 1 {
-		s.Sender.Send(s.ctx, s.buffer[0])
+		s.Sender.Send(ctx, s.buffer[0])
 	} else if len(s.buffer) > 1 {
-		s.Sender.Send(s.ctx, message.NewGroupComposer(s.buffer))
+		s.Sender.Send(ctx, message.NewGroupComposer(s.buffer))
 	}
+	s.counters.delivered.Add(int64(len(s.buffer)))
 
 	s.flushTimer.Reset(s.opts.FlushInterval)
 	s.buffer = s.buffer[:0]
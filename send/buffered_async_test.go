@@ -34,6 +34,7 @@ func TestBufferedAsyncSend(t *testing.T) {
 			buffer:     make([]message.Composer, 0, size),
 			needsFlush: make(chan bool, 1),
 			incoming:   make(chan message.Composer, defaultIncomingBufferFactor*size),
+			done:       make(chan struct{}),
 		}
 		return bs
 	}
@@ -127,13 +128,15 @@ func TestBufferedAsyncSend(t *testing.T) {
 				bs.Send(t.Context(), msg)
 			}
 
+			go bs.processMessages()
 			assert.NoError(t, bs.Close())
-			require.True(t, checkMessageSent(bs, s))
+			require.True(t, s.HasMessage())
 			msgs := s.GetMessage()
 			assert.Equal(t, "message1\nmessage2\nmessage3", msgs.Message.String())
 		},
 		"CloseIsIdempotent": func(t *testing.T) {
 			bs := newBufferedAsyncSender(time.Minute, 10)
+			go bs.processMessages()
 
 			assert.NoError(t, bs.Close())
 			assert.NoError(t, bs.Close())
@@ -142,6 +145,7 @@ func TestBufferedAsyncSend(t *testing.T) {
 			bs := newBufferedAsyncSender(time.Minute, 10)
 			var capturedErr error
 			assert.NoError(t, bs.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { capturedErr = err }))
+			go bs.processMessages()
 
 			assert.NoError(t, bs.Close())
 			bs.Send(t.Context(), message.ConvertToComposer(level.Debug, "message"))
@@ -183,3 +187,105 @@ FOR:
 
 	return s.HasMessage()
 }
+
+func TestBufferedAsyncSenderOverflow(t *testing.T) {
+	blocking := newBlockingSender(t)
+	s, err := NewBufferedAsyncSender(t.Context(), blocking, BufferedAsyncSenderOptions{
+		BufferedSenderOptions: BufferedSenderOptions{BufferSize: 1},
+		IncomingBufferFactor:  1,
+		Overflow:              OverflowOptions{Policy: OverflowDropOldest},
+	})
+	require.NoError(t, err)
+	var dropped []string
+	require.NoError(t, s.SetErrorHandler(func(_ context.Context, _ error, m message.Composer) {
+		dropped = append(dropped, m.String())
+	}))
+
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+	assert.Equal(t, "first", (<-blocking.started).String())
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+	assert.Equal(t, []string{"second"}, dropped)
+
+	_, err = NewBufferedAsyncSender(t.Context(), blocking, BufferedAsyncSenderOptions{
+		Overflow: OverflowOptions{Policy: OverflowSpill},
+	})
+	assert.Error(t, err)
+
+	close(blocking.release)
+	require.NoError(t, s.Close())
+	assert.Equal(t, 2, blocking.Len())
+
+	stats, err := GetAsyncStats(s)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, stats.Queued)
+	assert.EqualValues(t, 2, stats.Delivered)
+	assert.EqualValues(t, 1, stats.Dropped)
+}
+
+// contextRecordingSender records the errors of the contexts of the
+// messages it sends.
+type contextRecordingSender struct {
+	errs []error
+	*InternalSender
+}
+
+func (s *contextRecordingSender) Send(ctx context.Context, m message.Composer) {
+	s.errs = append(s.errs, ctx.Err())
+	s.InternalSender.Send(ctx, m)
+}
+
+func TestBufferedAsyncSenderCloseFlushes(t *testing.T) {
+	internal, err := NewInternalLogger("buffered", LevelInfo{level.Debug, level.Debug})
+	require.NoError(t, err)
+	recording := &contextRecordingSender{InternalSender: internal}
+	s, err := NewBufferedAsyncSender(t.Context(), recording, BufferedAsyncSenderOptions{
+		BufferedSenderOptions: BufferedSenderOptions{BufferSize: 10, FlushInterval: time.Hour},
+	})
+	require.NoError(t, err)
+
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+	require.NoError(t, s.Close())
+
+	require.Len(t, recording.errs, 1)
+	assert.NoError(t, recording.errs[0], "the final flush is not canceled")
+	assert.Len(t, internal.GetMessage().Message.(*message.GroupComposer).Messages(), 2)
+}
+
+// contextWaitingSender waits for the contexts of the messages it sends
+// to expire and records their errors.
+type contextWaitingSender struct {
+	errs []error
+	*InternalSender
+}
+
+func (s *contextWaitingSender) Send(ctx context.Context, m message.Composer) {
+	<-ctx.Done()
+	s.errs = append(s.errs, ctx.Err())
+	s.InternalSender.Send(ctx, m)
+}
+
+func TestBufferedAsyncSenderCloseTimeout(t *testing.T) {
+	internal, err := NewInternalLogger("buffered", LevelInfo{level.Debug, level.Debug})
+	require.NoError(t, err)
+	waiting := &contextWaitingSender{InternalSender: internal}
+
+	_, err = NewBufferedAsyncSender(t.Context(), waiting, BufferedAsyncSenderOptions{CloseTimeout: -time.Second})
+	assert.Error(t, err)
+
+	s, err := NewBufferedAsyncSender(t.Context(), waiting, BufferedAsyncSenderOptions{
+		BufferedSenderOptions: BufferedSenderOptions{BufferSize: 10, FlushInterval: time.Hour},
+		CloseTimeout:          10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "slow"))
+	start := time.Now()
+	require.NoError(t, s.Close())
+	assert.Less(t, time.Since(start), time.Minute, "the final flush is bounded by the close timeout")
+
+	require.Len(t, waiting.errs, 1)
+	assert.Equal(t, context.DeadlineExceeded, waiting.errs[0])
+	assert.Equal(t, "slow", internal.GetMessage().Message.String())
+}
@@ -0,0 +1,225 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// CommandOptions configure the capture of a command's output.
+type CommandOptions struct {
+	// Name is the name of the command in messages. Defaults to the
+	// base name of the command's path.
+	Name string
+	// StdoutPriority is the priority of lines from standard output.
+	// Defaults to Info.
+	StdoutPriority level.Priority
+	// StderrPriority is the priority of lines from standard error.
+	// Defaults to Warning.
+	StderrPriority level.Priority
+	// SummaryPriority is the priority of the summary of a command
+	// that succeeds. Defaults to Info.
+	SummaryPriority level.Priority
+	// FailurePriority is the priority of the summary of a command
+	// that fails. Defaults to Error.
+	FailurePriority level.Priority
+	// DetectLevels, if set, detects the level of each line, as the
+	// standard library log bridge does, and parses logfmt and JSON
+	// lines into fields. Lines without a level have the priority of
+	// their stream.
+	DetectLevels bool
+	// IdleFlush, if positive, is how long a partial line waits for
+	// the rest of the line before it is sent on its own.
+	IdleFlush time.Duration
+}
+
+func (opts *CommandOptions) validate() error {
+	catcher := []string{}
+	for name, p := range map[string]level.Priority{
+		"stdout":  opts.StdoutPriority,
+		"stderr":  opts.StderrPriority,
+		"summary": opts.SummaryPriority,
+		"failure": opts.FailurePriority,
+	} {
+		if p != level.Invalid && !p.IsValid() {
+			catcher = append(catcher, fmt.Sprintf("invalid %s priority '%d'", name, p))
+		}
+	}
+	if opts.IdleFlush < 0 {
+		catcher = append(catcher, "idle flush duration cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.StdoutPriority == level.Invalid {
+		opts.StdoutPriority = level.Info
+	}
+	if opts.StderrPriority == level.Invalid {
+		opts.StderrPriority = level.Warning
+	}
+	if opts.SummaryPriority == level.Invalid {
+		opts.SummaryPriority = level.Info
+	}
+	if opts.FailurePriority == level.Invalid {
+		opts.FailurePriority = level.Error
+	}
+
+	return nil
+}
+
+// AttachedCommand is a command whose output is sent to a Sender. Use its
+// Start, Wait and Run methods rather than the command's, so that the
+// output is flushed and the summary is sent when the command exits.
+type AttachedCommand struct {
+	cmd    *exec.Cmd
+	sender Sender
+	opts   CommandOptions
+	stdout *lineWriter
+	stderr *lineWriter
+	start  time.Time
+
+	stdoutLines atomic.Int64
+	stderrLines atomic.Int64
+}
+
+// AttachCommand sets the standard output and standard error of a
+// command, which must not be set, to line-splitting writers that send
+// each line to the Sender. The messages are annotated with the "pid"
+// and name ("command") of the command and the "stream" that the line
+// came from, "stdout" or "stderr", and have the priority of the
+// stream.
+//
+// When the command exits, Wait sends a summary message with the exit
+// status ("exit_code"), the duration and the number of lines of each
+// stream. Since lines are sent as they are written, the exit status is
+// only available in the summary.
+//
+// The attached command does not own the Sender.
+func AttachCommand(cmd *exec.Cmd, sender Sender, opts CommandOptions) (*AttachedCommand, error) {
+	if cmd == nil {
+		return nil, errors.New("must specify a command")
+	}
+	if sender == nil {
+		return nil, errors.New("must specify a sender")
+	}
+	if cmd.Stdout != nil || cmd.Stderr != nil {
+		return nil, errors.New("command output is already set")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Name == "" {
+		opts.Name = filepath.Base(cmd.Path)
+	}
+
+	c := &AttachedCommand{
+		cmd:    cmd,
+		sender: sender,
+		opts:   opts,
+	}
+	c.stdout = newLineWriter(opts.IdleFlush, c.emitter("stdout", opts.StdoutPriority, &c.stdoutLines))
+	c.stderr = newLineWriter(opts.IdleFlush, c.emitter("stderr", opts.StderrPriority, &c.stderrLines))
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	return c, nil
+}
+
+func (c *AttachedCommand) emitter(stream string, p level.Priority, count *atomic.Int64) func([]byte) {
+	return func(line []byte) {
+		count.Add(1)
+
+		var m message.Composer
+		if c.opts.DetectLevels {
+			m = parseLogLine(p, line)
+		} else {
+			m = message.NewBytesMessage(p, line)
+		}
+		message.AnnotateFields(m, message.Fields{
+			"pid":     c.pid(),
+			"command": c.opts.Name,
+			"stream":  stream,
+		})
+
+		c.sender.Send(context.Background(), m)
+	}
+}
+
+func (c *AttachedCommand) pid() int {
+	if c.cmd.Process == nil {
+		return 0
+	}
+
+	return c.cmd.Process.Pid
+}
+
+// Start starts the command.
+func (c *AttachedCommand) Start() error {
+	c.start = time.Now()
+	return c.cmd.Start()
+}
+
+// Wait waits for the command to exit and for its output to be sent,
+// then sends and returns the summary message along with the error from
+// the command's Wait.
+func (c *AttachedCommand) Wait() (message.Composer, error) {
+	err := c.cmd.Wait()
+	c.stdout.Close()
+	c.stderr.Close()
+
+	summary := c.summary(err)
+	c.sender.Send(context.Background(), summary)
+
+	return summary, err
+}
+
+// Run starts the command and waits for it to exit (see Start and
+// Wait).
+func (c *AttachedCommand) Run() (message.Composer, error) {
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	return c.Wait()
+}
+
+func (c *AttachedCommand) summary(err error) message.Composer {
+	exitCode := -1
+	if c.cmd.ProcessState != nil {
+		exitCode = c.cmd.ProcessState.ExitCode()
+	}
+
+	p := c.opts.SummaryPriority
+	msg := fmt.Sprintf("command '%s' exited with status %d", c.opts.Name, exitCode)
+	if err != nil {
+		p = c.opts.FailurePriority
+		msg = fmt.Sprintf("command '%s' failed: %s", c.opts.Name, err)
+	}
+
+	fields := message.Fields{
+		message.FieldsMsgName: msg,
+		"pid":                 c.pid(),
+		"command":             c.opts.Name,
+		"exit_code":           exitCode,
+		"stdout_lines":        c.stdoutLines.Load(),
+		"stderr_lines":        c.stderrLines.Load(),
+	}
+	if !c.start.IsZero() {
+		fields["duration"] = time.Since(c.start).String()
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	return message.NewFields(p, fields)
+}
@@ -0,0 +1,125 @@
+package send
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tests use sh")
+	}
+	newSink := func(t *testing.T) *InternalSender {
+		sink, err := NewInternalLogger("sink", LevelInfo{level.Trace, level.Trace})
+		require.NoError(t, err)
+		return sink
+	}
+	drain := func(sink *InternalSender) []*InternalMessage {
+		out := []*InternalMessage{}
+		for {
+			msg, ok := sink.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg)
+		}
+	}
+
+	t.Run("InvalidArguments", func(t *testing.T) {
+		sink := newSink(t)
+		for _, test := range []struct {
+			cmd  *exec.Cmd
+			opts CommandOptions
+		}{
+			{cmd: nil},
+			{cmd: &exec.Cmd{Stdout: &bytes.Buffer{}}},
+			{cmd: exec.Command("true"), opts: CommandOptions{StderrPriority: 1}},
+		} {
+			c, err := AttachCommand(test.cmd, sink, test.opts)
+			assert.Error(t, err)
+			assert.Nil(t, c)
+		}
+		c, err := AttachCommand(exec.Command("true"), nil, CommandOptions{})
+		assert.Error(t, err)
+		assert.Nil(t, c)
+	})
+	t.Run("CapturesStreams", func(t *testing.T) {
+		sink := newSink(t)
+		cmd := exec.CommandContext(t.Context(), "sh", "-c", "echo out one; echo err one >&2; printf 'out two'")
+		c, err := AttachCommand(cmd, sink, CommandOptions{Name: "tool"})
+		require.NoError(t, err)
+
+		summary, err := c.Run()
+		require.NoError(t, err)
+		msgs := drain(sink)
+		require.Len(t, msgs, 4)
+
+		stdout, stderr := []string{}, []string{}
+		for _, msg := range msgs[:3] {
+			attrs := messageAttributes(msg.Message)
+			assert.Equal(t, "tool", attrs["command"])
+			assert.Equal(t, strconv.Itoa(cmd.Process.Pid), fmt.Sprint(attrs["pid"]))
+			switch attrs["stream"] {
+			case "stdout":
+				assert.Equal(t, level.Info, msg.Priority)
+				stdout = append(stdout, msg.Rendered)
+			case "stderr":
+				assert.Equal(t, level.Warning, msg.Priority)
+				stderr = append(stderr, msg.Rendered)
+			}
+		}
+		assert.Equal(t, []string{"out one", "out two"}, stdout, "partial lines are flushed at exit")
+		assert.Equal(t, []string{"err one"}, stderr)
+
+		assert.Equal(t, summary, msgs[3].Message)
+		assert.Equal(t, level.Info, summary.Priority())
+		fields := summary.Raw().(message.Fields)
+		assert.Equal(t, 0, fields["exit_code"])
+		assert.EqualValues(t, 2, fields["stdout_lines"])
+		assert.EqualValues(t, 1, fields["stderr_lines"])
+		assert.Contains(t, fields, "duration")
+	})
+	t.Run("Failure", func(t *testing.T) {
+		sink := newSink(t)
+		c, err := AttachCommand(exec.CommandContext(t.Context(), "sh", "-c", "exit 3"), sink, CommandOptions{FailurePriority: level.Critical})
+		require.NoError(t, err)
+
+		summary, err := c.Run()
+		require.Error(t, err)
+		assert.Equal(t, level.Critical, summary.Priority())
+		fields := summary.Raw().(message.Fields)
+		assert.Equal(t, 3, fields["exit_code"])
+		assert.Equal(t, "sh", fields["command"])
+		assert.Contains(t, fields, "error")
+		assert.Equal(t, summary, sink.GetMessage().Message)
+	})
+	t.Run("DetectLevels", func(t *testing.T) {
+		sink := newSink(t)
+		c, err := AttachCommand(exec.CommandContext(t.Context(), "sh", "-c", `echo "[DEBUG] details"; echo 'level=error msg="bad input"' >&2`), sink, CommandOptions{DetectLevels: true})
+		require.NoError(t, err)
+
+		_, err = c.Run()
+		require.NoError(t, err)
+		msgs := drain(sink)
+		require.Len(t, msgs, 3)
+		for _, msg := range msgs[:2] {
+			switch messageAttributes(msg.Message)["stream"] {
+			case "stdout":
+				assert.Equal(t, level.Debug, msg.Priority)
+				assert.Equal(t, "details", msg.Message.String())
+			case "stderr":
+				assert.Equal(t, level.Error, msg.Priority)
+				assert.Equal(t, "bad input", msg.Message.Raw().(message.Fields)[message.FieldsMsgName])
+			}
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package send
+
+import (
+	"io"
+	"net"
+)
+
+// peerWatchedConn is a stream connection that a sender only writes
+// to. Writes to such a connection succeed until the peer resets it, so
+// messages would be lost when the remote end closes the connection;
+// the connection reads in the background to notice the close before
+// the next write.
+type peerWatchedConn struct {
+	net.Conn
+	done chan struct{}
+}
+
+// watchPeer starts reading from a connection that the sender only
+// writes to, discarding anything the peer sends, until the connection
+// is closed by either end. The connection must not have a read
+// deadline.
+func watchPeer(conn net.Conn) net.Conn {
+	c := &peerWatchedConn{Conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	return c
+}
+
+// streamClosedByPeer reports, without blocking, whether the remote end
+// closed a connection returned by watchPeer. Other connections are
+// never reported as closed.
+func streamClosedByPeer(conn net.Conn) bool {
+	c, ok := conn.(*peerWatchedConn)
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
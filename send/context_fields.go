@@ -0,0 +1,31 @@
+package send
+
+import (
+	"context"
+
+	"github.com/mongodb/grip/message"
+)
+
+type contextFieldsSender struct {
+	Sender
+}
+
+// NewContextFieldsSender wraps a Sender so that it adds the fields of
+// the context passed to Send, as set with message.ContextWithFields, to
+// every message. Fields that a message already has keep their values.
+//
+// Since it owns the sender, calling Close on this sender will close the
+// underlying sender.
+func NewContextFieldsSender(s Sender) Sender {
+	return &contextFieldsSender{Sender: s}
+}
+
+func (s *contextFieldsSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Sender.Level().ShouldLog(m) {
+		return
+	}
+
+	message.AnnotateFields(m, message.FieldsFromContext(ctx))
+
+	s.Sender.Send(ctx, m)
+}
@@ -0,0 +1,34 @@
+package send
+
+import (
+	"testing"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextFieldsSender(t *testing.T) {
+	internal, err := NewInternalLogger("internal", LevelInfo{level.Info, level.Info})
+	require.NoError(t, err)
+	s := NewContextFieldsSender(internal)
+	ctx := message.ContextWithFields(t.Context(), message.Fields{"request": "abc"})
+
+	s.Send(ctx, message.NewDefaultMessage(level.Info, "hello"))
+	assert.Equal(t, "abc", messageAttributes(internal.GetMessage().Message)["request"])
+
+	s.Send(ctx, message.MakeGroupComposer(
+		message.NewDefaultMessage(level.Info, "one"),
+		message.NewFields(level.Info, message.Fields{"request": "own"}),
+	))
+	group := internal.GetMessage().Message.(*message.GroupComposer)
+	assert.Equal(t, "abc", messageAttributes(group.Messages()[0])["request"])
+	assert.Equal(t, "own", messageAttributes(group.Messages()[1])["request"])
+
+	s.Send(t.Context(), message.NewDefaultMessage(level.Info, "no fields"))
+	assert.NotContains(t, messageAttributes(internal.GetMessage().Message), "request")
+
+	s.Send(ctx, message.NewDefaultMessage(level.Debug, "filtered"))
+	assert.False(t, internal.HasMessage())
+}
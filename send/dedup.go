@@ -0,0 +1,259 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/message"
+)
+
+const defaultDedupWindow = 30 * time.Second
+
+// DedupOptions configure the duplicate suppressing sender.
+type DedupOptions struct {
+	// Window is how long repeats of a message are suppressed after
+	// the message or its last repeat, so that the window slides
+	// forward with each repeat. Defaults to 30 seconds.
+	Window time.Duration
+	// MaxFlushInterval is the longest time that repeats are
+	// suppressed without a summary: while a message keeps
+	// repeating, a summary of its repeats is sent this long after
+	// the first repeat that was not summarized. Defaults to the
+	// Window.
+	MaxFlushInterval time.Duration
+	// FieldKeys are the fields of messages that, in addition to
+	// the string form and priority of messages, distinguish
+	// messages from each other.
+	FieldKeys []string
+	// Normalize, if set, normalizes the string form of messages
+	// before they are compared, e.g. to ignore IDs or durations
+	// that vary between repeats. By default, runs of whitespace
+	// are collapsed.
+	Normalize func(string) string
+}
+
+func (opts *DedupOptions) validate() error {
+	if opts.Window < 0 {
+		return errors.New("Window cannot be negative")
+	}
+	if opts.MaxFlushInterval < 0 {
+		return errors.New("MaxFlushInterval cannot be negative")
+	}
+
+	if opts.Window == 0 {
+		opts.Window = defaultDedupWindow
+	}
+	if opts.MaxFlushInterval == 0 {
+		opts.MaxFlushInterval = opts.Window
+	}
+	if opts.Normalize == nil {
+		opts.Normalize = func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	}
+
+	return nil
+}
+
+type dedupSender struct {
+	opts   DedupOptions
+	mu     sync.Mutex
+	closed bool
+
+	// last is the last message sent, and fingerprint identifies it.
+	last        message.Composer
+	fingerprint string
+	firstSeen   time.Time
+	lastSeen    time.Time
+	repeats     int
+	// pendingSince is the time of the first repeat that is not
+	// summarized yet.
+	pendingSince time.Time
+	timer        *time.Timer
+
+	Sender
+}
+
+// NewDedupSender provides a Sender implementation that wraps an
+// existing Sender and suppresses repeats of the last message, like
+// syslogd's "last message repeated N times". Messages repeat if they
+// have the same priority, normalized string form and values for the
+// configured field keys. When repeats of a message were suppressed, a
+// summary with the number of repeats and the times the message was
+// first and last seen is sent when the window closes, when a different
+// message arrives or when the Sender is closed, and while the message
+// keeps repeating, at least every MaxFlushInterval. Messages in a group are
+// compared individually. Messages and summaries are sent to the
+// underlying Sender in order, one at a time.
+//
+// This Sender does not own the underlying Sender, so users are responsible for
+// closing the underlying Sender if/when it is appropriate to release its
+// resources.
+func NewDedupSender(sender Sender, opts DedupOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &dedupSender{opts: opts, Sender: sender}, nil
+}
+
+func (s *dedupSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	out := []message.Composer{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	now := time.Now()
+	for _, c := range msgs {
+		if !s.Level().ShouldLog(c) {
+			continue
+		}
+
+		fingerprint := s.fingerprintOf(c)
+		if s.last != nil && fingerprint == s.fingerprint && now.Sub(s.lastSeen) < s.opts.Window {
+			if s.repeats == 0 {
+				s.pendingSince = now
+			}
+			s.repeats++
+			s.lastSeen = now
+			s.schedule(now)
+			continue
+		}
+
+		if summary := s.summary(); summary != nil {
+			out = append(out, summary)
+		}
+		s.start(c, fingerprint, now)
+		out = append(out, c)
+	}
+
+	// the lock is held while sending, so that summaries sent when
+	// windows close are not reordered with other messages.
+	switch len(out) {
+	case 0:
+	case 1:
+		s.Sender.Send(ctx, out[0])
+	default:
+		s.Sender.Send(ctx, message.NewGroupComposer(out))
+	}
+}
+
+// Close sends the summary of any suppressed repeats to the underlying
+// Sender. This does not close the underlying sender.
+func (s *dedupSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	if summary := s.summary(); summary != nil {
+		s.Sender.Send(context.Background(), summary)
+	}
+
+	return nil
+}
+
+func (s *dedupSender) fingerprintOf(m message.Composer) string {
+	var out strings.Builder
+	out.WriteString(m.Priority().String())
+	out.WriteByte(0)
+	out.WriteString(s.opts.Normalize(m.String()))
+
+	if len(s.opts.FieldKeys) > 0 {
+		attrs := messageAttributes(m)
+		for _, key := range s.opts.FieldKeys {
+			out.WriteByte(0)
+			if value, ok := attrs[key]; ok {
+				fmt.Fprint(&out, value)
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// start makes a message the last message, and starts its window. The
+// caller must hold the lock.
+func (s *dedupSender) start(m message.Composer, fingerprint string, now time.Time) {
+	s.last = m
+	s.fingerprint = fingerprint
+	s.firstSeen = now
+	s.lastSeen = now
+	s.repeats = 0
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(s.opts.Window, func() { s.expire(m) })
+}
+
+// schedule sets the timer for the end of the window of the last
+// message or, if repeats are pending, the time their summary is due,
+// whichever comes first. The caller must hold the lock.
+func (s *dedupSender) schedule(now time.Time) {
+	deadline := s.lastSeen.Add(s.opts.Window)
+	if s.repeats > 0 {
+		if due := s.pendingSince.Add(s.opts.MaxFlushInterval); due.Before(deadline) {
+			deadline = due
+		}
+	}
+	s.timer.Reset(deadline.Sub(now))
+}
+
+// expire sends the summary of a message when its window closes or when
+// the summary of its pending repeats is due, unless another message was
+// sent since.
+func (s *dedupSender) expire(m message.Composer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.last != m {
+		return
+	}
+
+	now := time.Now()
+	closed := now.Sub(s.lastSeen) >= s.opts.Window
+	if closed || (s.repeats > 0 && now.Sub(s.pendingSince) >= s.opts.MaxFlushInterval) {
+		if summary := s.summary(); summary != nil {
+			s.Sender.Send(context.Background(), summary)
+		}
+	}
+	if !closed {
+		s.schedule(now)
+	}
+}
+
+// summary returns a message describing the suppressed repeats of the
+// last message, or nil if there are none, and resets the count. The
+// caller must hold the lock.
+func (s *dedupSender) summary() message.Composer {
+	if s.last == nil || s.repeats == 0 {
+		return nil
+	}
+
+	summary := message.NewFields(s.last.Priority(), message.Fields{
+		message.FieldsMsgName: fmt.Sprintf("last message repeated %d times: %s", s.repeats, s.last.String()),
+		"count":               s.repeats,
+		"first_seen":          s.firstSeen,
+		"last_seen":           s.lastSeen,
+	})
+	s.repeats = 0
+
+	return summary
+}
@@ -0,0 +1,177 @@
+package send
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupSender(t *testing.T) {
+	newDedupSender := func(t *testing.T, opts DedupOptions) (Sender, *InternalSender) {
+		s, err := NewInternalLogger("dedup", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+
+		ds, err := NewDedupSender(s, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = ds.Close() })
+
+		return ds, s
+	}
+	drain := func(s *InternalSender) []message.Composer {
+		out := []message.Composer{}
+		for {
+			msg, ok := s.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg.Message)
+		}
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		ds, err := NewDedupSender(nil, DedupOptions{Window: -1})
+		assert.Error(t, err)
+		assert.Nil(t, ds)
+		ds, err = NewDedupSender(nil, DedupOptions{MaxFlushInterval: -1})
+		assert.Error(t, err)
+		assert.Nil(t, ds)
+	})
+	t.Run("SummarizesOnDifferentMessage", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: time.Minute})
+
+		for i := 0; i < 4; i++ {
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "connection  refused"))
+		}
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "connection refused "))
+		assert.Len(t, drain(s), 1)
+
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Info, "recovered"))
+		msgs := drain(s)
+		require.Len(t, msgs, 1)
+		group, ok := msgs[0].(*message.GroupComposer)
+		require.True(t, ok)
+		require.Len(t, group.Messages(), 2)
+
+		summary := group.Messages()[0]
+		assert.Equal(t, level.Error, summary.Priority())
+		fields := summary.Raw().(message.Fields)
+		assert.Equal(t, "last message repeated 4 times: connection  refused", fields[message.FieldsMsgName])
+		assert.Equal(t, 4, fields["count"])
+		assert.False(t, fields["last_seen"].(time.Time).Before(fields["first_seen"].(time.Time)))
+		assert.Equal(t, "recovered", group.Messages()[1].String())
+	})
+	t.Run("PriorityAndFieldsDistinguishMessages", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{
+			Window:    time.Minute,
+			FieldKeys: []string{"host"},
+			// Ignore the string form, which includes all fields.
+			Normalize: func(string) string { return "" },
+		})
+
+		ds.Send(t.Context(), message.NewFields(level.Error, message.Fields{"host": "a", "attempt": 1}))
+		ds.Send(t.Context(), message.NewFields(level.Warning, message.Fields{"host": "a", "attempt": 2}))
+		ds.Send(t.Context(), message.NewFields(level.Warning, message.Fields{"host": "b", "attempt": 3}))
+		ds.Send(t.Context(), message.NewFields(level.Warning, message.Fields{"host": "b", "attempt": 4}))
+		msgs := drain(s)
+		require.Len(t, msgs, 3)
+		assert.Equal(t, 3, msgs[2].Raw().(message.Fields)["attempt"])
+	})
+	t.Run("SummarizesWhenWindowCloses", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: 20 * time.Millisecond})
+
+		for i := 0; i < 3; i++ {
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "flood"))
+		}
+		require.Eventually(t, func() bool { return s.Len() == 2 }, time.Second, time.Millisecond)
+		msgs := drain(s)
+		assert.Equal(t, "flood", msgs[0].String())
+		assert.Equal(t, 2, msgs[1].Raw().(message.Fields)["count"])
+
+		// The next repeat starts a new window.
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "flood"))
+		msgs = drain(s)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "flood", msgs[0].String())
+	})
+	t.Run("RepeatsExtendWindow", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: 100 * time.Millisecond, MaxFlushInterval: time.Hour})
+
+		start := time.Now()
+		for time.Since(start) < 250*time.Millisecond {
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "flood"))
+			time.Sleep(10 * time.Millisecond)
+		}
+		msgs := drain(s)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "flood", msgs[0].String())
+
+		require.Eventually(t, func() bool { return s.Len() == 1 }, time.Second, time.Millisecond)
+		assert.Greater(t, drain(s)[0].Raw().(message.Fields)["count"], 1)
+	})
+	t.Run("ContinuousRepeatsAreSummarized", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: 100 * time.Millisecond})
+
+		// a retry loop that logs more often than the window
+		// closes still produces summaries while it runs.
+		start := time.Now()
+		for time.Since(start) < 350*time.Millisecond {
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "retrying"))
+			time.Sleep(10 * time.Millisecond)
+		}
+		msgs := drain(s)
+		require.GreaterOrEqual(t, len(msgs), 3)
+		assert.Equal(t, "retrying", msgs[0].String())
+		total := 0
+		for _, msg := range msgs[1:] {
+			fields := msg.Raw().(message.Fields)
+			assert.Contains(t, fields[message.FieldsMsgName], "last message repeated")
+			total += fields["count"].(int)
+		}
+		assert.Greater(t, total, 10)
+	})
+	t.Run("SummaryPrecedesNextMessage", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: time.Millisecond, MaxFlushInterval: time.Hour})
+
+		for i := 0; i < 100; i++ {
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "flood"))
+			ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "flood"))
+			time.Sleep(time.Duration(i%3) * time.Millisecond)
+		}
+		require.NoError(t, ds.Close())
+
+		// each summary follows the message that it summarizes.
+		var previous message.Composer
+		for _, msg := range drain(s) {
+			msgs := []message.Composer{msg}
+			if g, ok := msg.(*message.GroupComposer); ok {
+				msgs = g.Messages()
+			}
+			for _, c := range msgs {
+				_, summary := c.Raw().(message.Fields)
+				if summary {
+					require.NotNil(t, previous)
+					_, previousSummary := previous.Raw().(message.Fields)
+					assert.False(t, previousSummary)
+				}
+				previous = c
+			}
+		}
+	})
+	t.Run("CloseSendsSummary", func(t *testing.T) {
+		ds, s := newDedupSender(t, DedupOptions{Window: time.Minute})
+
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "once"))
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "once"))
+		require.NoError(t, ds.Close())
+		msgs := drain(s)
+		require.Len(t, msgs, 2)
+		assert.Equal(t, 1, msgs[1].Raw().(message.Fields)["count"])
+
+		ds.Send(t.Context(), message.NewDefaultMessage(level.Error, "closed"))
+		assert.Empty(t, drain(s))
+	})
+}
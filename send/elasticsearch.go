@@ -0,0 +1,302 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const elasticsearchBulkPath = "/_bulk"
+
+// ElasticsearchOptions configures the Elasticsearch/OpenSearch
+// sender.
+type ElasticsearchOptions struct {
+	// URL is the base URL of the cluster
+	// (e.g. "https://opensearch:9200").
+	URL string `bson:"url" json:"url" yaml:"url"`
+	// Index is the name of the index that documents are written
+	// to. The name may contain the following date directives,
+	// which are replaced with the current UTC time when the
+	// message is sent:
+	//
+	//	%Y  four-digit year
+	//	%m  two-digit month
+	//	%d  two-digit day of the month
+	//	%H  two-digit hour
+	//	%%  a literal percent sign
+	//
+	// For example, "logs-%Y.%m.%d" writes to a new index every
+	// day.
+	Index string `bson:"index" json:"index" yaml:"index"`
+
+	Username string `bson:"username" json:"username" yaml:"username"`
+	Password string `bson:"password" json:"password" yaml:"password" secret:"true"`
+	// APIKey is the base64 encoded API key, sent in the
+	// Authorization header. Cannot be combined with basic
+	// authentication.
+	APIKey string `bson:"api_key" json:"api_key" yaml:"api_key" secret:"true"`
+
+	// Client is the HTTP client used for requests. Defaults to a
+	// client with a 10 second timeout.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+
+	HTTPRetryOptions `bson:"retry" json:"retry" yaml:"retry"`
+}
+
+// Validate checks the options for required and conflicting values and
+// populates defaults.
+func (opts *ElasticsearchOptions) Validate() error {
+	catcher := []string{}
+	if opts.URL == "" {
+		catcher = append(catcher, "must specify a URL")
+	}
+	if opts.Index == "" {
+		catcher = append(catcher, "must specify an index")
+	} else if _, err := expandIndexPattern(opts.Index, time.Now()); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+	if opts.APIKey != "" && opts.Username != "" {
+		catcher = append(catcher, "cannot specify both basic authentication and an API key")
+	}
+	if err := opts.HTTPRetryOptions.validate(); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return nil
+}
+
+type elasticsearchSender struct {
+	opts ElasticsearchOptions
+	*Base
+}
+
+// NewElasticsearchSender constructs a Sender that indexes messages in
+// Elasticsearch or OpenSearch using the bulk API. See
+// MakeElasticsearchSender for more information.
+func NewElasticsearchSender(name string, opts ElasticsearchOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeElasticsearchSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeElasticsearchSender constructs an unconfigured Elasticsearch
+// Sender. Pass to Journaler.SetSender or call SetName before using.
+//
+// The document indexed for each message is the JSON form of the
+// message's Raw method; values that are not JSON objects are stored
+// in the "message" field of a document. Groups of messages (e.g. from
+// the buffered senders) are written in a single bulk request. When
+// the cluster rejects some of the documents in a request, the error
+// handler is called once for each rejected message.
+func MakeElasticsearchSender(opts ElasticsearchOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Elasticsearch options")
+	}
+
+	s := &elasticsearchSender{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	return s, nil
+}
+
+func (s *elasticsearchSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	index, err := expandIndexPattern(s.opts.Index, time.Now().UTC())
+	if err != nil {
+		s.ErrorHandler()(ctx, err, m)
+		return
+	}
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": index}})
+	if err != nil {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "encoding bulk action"), m)
+		return
+	}
+
+	body := &bytes.Buffer{}
+	batch := []message.Composer{}
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		doc, err := elasticsearchDocument(c)
+		if err != nil {
+			s.ErrorHandler()(ctx, errors.Wrap(err, "encoding document"), c)
+			continue
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+		batch = append(batch, c)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	resp, err := doHTTPWithRetry(ctx, s.opts.Client, s.opts.HTTPRetryOptions, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.opts.URL, "/")+elasticsearchBulkPath, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		switch {
+		case s.opts.APIKey != "":
+			req.Header.Set("Authorization", "ApiKey "+s.opts.APIKey)
+		case s.opts.Username != "":
+			req.SetBasicAuth(s.opts.Username, s.opts.Password)
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "sending bulk request"), m)
+		return
+	}
+	defer resp.Body.Close()
+
+	out := elasticsearchBulkResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "decoding bulk response"), m)
+		return
+	}
+
+	if !out.Errors {
+		return
+	}
+
+	for idx, item := range out.Items {
+		if idx >= len(batch) {
+			break
+		}
+
+		for _, result := range item {
+			if err := result.err(); err != nil {
+				s.ErrorHandler()(ctx, err, batch[idx])
+			}
+		}
+	}
+}
+
+func (s *elasticsearchSender) Flush(_ context.Context) error { return nil }
+
+func elasticsearchDocument(m message.Composer) ([]byte, error) {
+	doc, err := json.Marshal(m.Raw())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc) > 0 && doc[0] == '{' {
+		return doc, nil
+	}
+
+	return json.Marshal(map[string]json.RawMessage{message.FieldsMsgName: doc})
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                                   `json:"errors"`
+	Items  []map[string]elasticsearchBulkItemInfo `json:"items"`
+}
+
+type elasticsearchBulkItemInfo struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (i elasticsearchBulkItemInfo) err() error {
+	if i.Error == nil && i.Status < 300 {
+		return nil
+	}
+
+	if i.Error == nil {
+		return errors.Errorf("indexing document in '%s' failed with status '%d'", i.Index, i.Status)
+	}
+
+	return errors.Errorf("indexing document in '%s' failed with status '%d': %s: %s", i.Index, i.Status, i.Error.Type, i.Error.Reason)
+}
+
+// expandIndexPattern replaces the date directives in an index name
+// pattern with the values from the given time.
+func expandIndexPattern(pattern string, ts time.Time) (string, error) {
+	if !strings.Contains(pattern, "%") {
+		return pattern, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			out.WriteByte(pattern[i])
+			continue
+		}
+
+		i++
+		if i >= len(pattern) {
+			return "", errors.Errorf("index pattern '%s' ends with an incomplete directive", pattern)
+		}
+
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&out, "%04d", ts.Year())
+		case 'm':
+			fmt.Fprintf(&out, "%02d", int(ts.Month()))
+		case 'd':
+			fmt.Fprintf(&out, "%02d", ts.Day())
+		case 'H':
+			fmt.Fprintf(&out, "%02d", ts.Hour())
+		case '%':
+			out.WriteByte('%')
+		default:
+			return "", errors.Errorf("index pattern '%s' has unknown directive '%%%c'", pattern, pattern[i])
+		}
+	}
+
+	return out.String(), nil
+}
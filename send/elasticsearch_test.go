@@ -0,0 +1,142 @@
+package send
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type elasticsearchServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	lines    []map[string]interface{}
+	header   http.Header
+	response string
+}
+
+func newElasticsearchServer(t *testing.T, response string) *elasticsearchServer {
+	srv := &elasticsearchServer{response: response}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, elasticsearchBulkPath, r.URL.Path)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.header = r.Header
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			srv.lines = append(srv.lines, line)
+		}
+
+		_, _ = w.Write([]byte(srv.response))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestElasticsearchSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+	retry := HTTPRetryOptions{MinRetryDelay: time.Millisecond}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]ElasticsearchOptions{
+			"MissingURL":       {Index: "logs"},
+			"MissingIndex":     {URL: "http://localhost"},
+			"InvalidDirective": {URL: "http://localhost", Index: "logs-%q"},
+			"ConflictingAuth":  {URL: "http://localhost", Index: "logs", Username: "user", APIKey: "key"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := MakeElasticsearchSender(opts)
+				assert.Error(t, err)
+				assert.Nil(t, s)
+			})
+		}
+	})
+	t.Run("IndexesDocuments", func(t *testing.T) {
+		srv := newElasticsearchServer(t, `{"errors": false, "items": [{"index": {"status": 201}}, {"index": {"status": 201}}]}`)
+		s, err := NewElasticsearchSender("es", ElasticsearchOptions{
+			URL:              srv.URL,
+			Index:            "logs-%Y",
+			APIKey:           "key",
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+		var handled error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = err }))
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewSimpleFields(level.Info, message.Fields{"a": "b"}),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+			message.NewBytesMessage(level.Error, []byte("bytes")),
+		))
+		require.NoError(t, handled)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Equal(t, "ApiKey key", srv.header.Get("Authorization"))
+		assert.Equal(t, "application/x-ndjson", srv.header.Get("Content-Type"))
+		require.Len(t, srv.lines, 4)
+		index := "logs-" + time.Now().UTC().Format("2006")
+		assert.Equal(t, map[string]interface{}{"index": map[string]interface{}{"_index": index}}, srv.lines[0])
+		assert.Equal(t, map[string]interface{}{"a": "b"}, srv.lines[1])
+		assert.Equal(t, srv.lines[0], srv.lines[2])
+		assert.Contains(t, srv.lines[3], message.FieldsMsgName)
+	})
+	t.Run("RoutesPartialFailures", func(t *testing.T) {
+		srv := newElasticsearchServer(t, `{"errors": true, "items": [
+			{"index": {"_index": "logs", "status": 201}},
+			{"index": {"_index": "logs", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "bad field"}}}
+		]}`)
+		s, err := NewElasticsearchSender("es", ElasticsearchOptions{URL: srv.URL, Index: "logs", HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		var errs []error
+		var msgs []message.Composer
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, m message.Composer) {
+			errs = append(errs, err)
+			msgs = append(msgs, m)
+		}))
+
+		good := message.NewDefaultMessage(level.Info, "good")
+		bad := message.NewDefaultMessage(level.Info, "bad")
+		s.Send(t.Context(), message.MakeGroupComposer(good, bad))
+
+		require.Len(t, errs, 1)
+		assert.Contains(t, errs[0].Error(), "mapper_parsing_exception")
+		assert.Contains(t, errs[0].Error(), "bad field")
+		assert.Equal(t, bad, msgs[0])
+	})
+}
+
+func TestExpandIndexPattern(t *testing.T) {
+	ts := time.Date(2024, time.March, 5, 7, 0, 0, 0, time.UTC)
+
+	for pattern, expected := range map[string]string{
+		"logs":             "logs",
+		"logs-%Y.%m.%d":    "logs-2024.03.05",
+		"logs-%Y.%m.%d.%H": "logs-2024.03.05.07",
+		"logs-100%%":       "logs-100%",
+	} {
+		out, err := expandIndexPattern(pattern, ts)
+		require.NoError(t, err)
+		assert.Equal(t, expected, out)
+	}
+
+	_, err := expandIndexPattern("logs-%", ts)
+	assert.Error(t, err)
+	_, err = expandIndexPattern("logs-%x", ts)
+	assert.Error(t, err)
+}
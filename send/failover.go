@@ -0,0 +1,249 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/grip/message"
+)
+
+const defaultFailoverProbeInterval = 30 * time.Second
+
+// FailoverStatus describes the health of one of the senders of a
+// failover sender.
+type FailoverStatus struct {
+	Name    string `bson:"name" json:"name" yaml:"name"`
+	Active  bool   `bson:"active" json:"active" yaml:"active"`
+	Healthy bool   `bson:"healthy" json:"healthy" yaml:"healthy"`
+	// Failures is the total number of failed sends.
+	Failures    int64     `bson:"failures" json:"failures" yaml:"failures"`
+	LastFailure time.Time `bson:"last_failure,omitempty" json:"last_failure,omitempty" yaml:"last_failure,omitempty"`
+	LastError   string    `bson:"last_error,omitempty" json:"last_error,omitempty" yaml:"last_error,omitempty"`
+}
+
+type failoverTarget struct {
+	sender Sender
+
+	// The remaining fields are protected by the failover sender's
+	// lock.
+	healthy     bool
+	failures    int64
+	lastFailure time.Time
+	lastError   error
+}
+
+// failoverAttemptKey is the context key of the flag that a target's
+// error handler sets when the target fails to send the message that
+// the failover sender passed it with the context.
+type failoverAttemptKey struct{ target *failoverTarget }
+
+// FailoverSender is a Sender that sends each message to the first
+// healthy sender of a list of senders. Use NewFailoverSender to
+// construct one.
+type FailoverSender struct {
+	targets       []*failoverTarget
+	mu            sync.Mutex
+	active        int
+	probeInterval time.Duration
+	*Base
+}
+
+// NewFailoverSender constructs a Sender that sends messages to the
+// primary Sender and, when it fails, to the secondary Senders in order.
+//
+// Failures are detected with the error handlers of the senders, which
+// the failover sender replaces: a sender fails when its error handler
+// is called with the context of a message that it was sent (or one
+// derived from it), in which case the message is sent to the next
+// sender, or with another context, for senders that report errors
+// asynchronously, in which case later messages are sent to the next
+// sender. Errors are attributed to the messages that they are
+// reported with, so concurrent calls to Send do not fail each other. Senders that report errors for some of the messages in a
+// group fail the whole group, so the next sender may receive
+// duplicates of some messages. The errors of the senders, and an error
+// for messages that every sender failed to send, are passed to the
+// error handler of the failover sender.
+//
+// Failed senders are probed with the next message after the probe
+// interval (30 seconds by default, see SetProbeInterval), so that
+// messages go back to the primary sender when it recovers.
+//
+// The Sender takes ownership of the underlying Senders, so closing this Sender
+// closes all underlying Senders.
+func NewFailoverSender(primary Sender, secondaries ...Sender) (*FailoverSender, error) {
+	senders := append([]Sender{primary}, secondaries...)
+	for idx, sender := range senders {
+		if sender == nil {
+			return nil, fmt.Errorf("sender %d is nil", idx)
+		}
+	}
+
+	s := &FailoverSender{
+		probeInterval: defaultFailoverProbeInterval,
+		Base:          NewBase(primary.Name()),
+	}
+	if err := s.Base.SetLevel(primary.Level()); err != nil {
+		return nil, fmt.Errorf("invalid level of primary sender: %w", err)
+	}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+	s.reset()
+
+	for _, sender := range senders {
+		target := &failoverTarget{sender: sender, healthy: true}
+		if err := sender.SetErrorHandler(func(ctx context.Context, err error, m message.Composer) {
+			if err == nil {
+				return
+			}
+			if failed, ok := ctx.Value(failoverAttemptKey{target}).(*atomic.Bool); ok {
+				failed.Store(true)
+			}
+			s.recordFailure(target, err)
+			s.ErrorHandler()(ctx, fmt.Errorf("sender '%s' failed: %w", target.sender.Name(), err), m)
+		}); err != nil {
+			return nil, fmt.Errorf("wrapping error handler of sender '%s': %w", sender.Name(), err)
+		}
+		s.targets = append(s.targets, target)
+	}
+
+	return s, nil
+}
+
+// SetProbeInterval sets how long after a sender fails it is tried
+// again.
+func (s *FailoverSender) SetProbeInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("probe interval must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probeInterval = interval
+	return nil
+}
+
+// Active returns the sender that most recently received a message
+// successfully, initially the primary sender.
+func (s *FailoverSender) Active() Sender {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.targets[s.active].sender
+}
+
+// Status returns the health of each of the senders, in failover order.
+func (s *FailoverSender) Status() []FailoverStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]FailoverStatus, 0, len(s.targets))
+	for idx, target := range s.targets {
+		status := FailoverStatus{
+			Name:        target.sender.Name(),
+			Active:      idx == s.active,
+			Healthy:     target.healthy,
+			Failures:    target.failures,
+			LastFailure: target.lastFailure,
+		}
+		if target.lastError != nil {
+			status.LastError = target.lastError.Error()
+		}
+		out = append(out, status)
+	}
+
+	return out
+}
+
+func (s *FailoverSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	for _, idx := range s.order() {
+		target := s.targets[idx]
+		failed := &atomic.Bool{}
+		target.sender.Send(context.WithValue(ctx, failoverAttemptKey{target}, failed), m)
+		if failed.Load() {
+			continue
+		}
+
+		s.mu.Lock()
+		target.healthy = true
+		s.active = idx
+		s.mu.Unlock()
+		return
+	}
+
+	s.ErrorHandler()(ctx, errors.New("all failover senders failed to send the message"), m)
+}
+
+// order returns the order in which to try the senders: the healthy
+// senders and the failed senders that are due to be probed, followed
+// by the remaining failed senders as a last resort.
+func (s *FailoverSender) order() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	first := make([]int, 0, len(s.targets))
+	last := []int{}
+	for idx, target := range s.targets {
+		if target.healthy || now.Sub(target.lastFailure) >= s.probeInterval {
+			first = append(first, idx)
+		} else {
+			last = append(last, idx)
+		}
+	}
+
+	return append(first, last...)
+}
+
+func (s *FailoverSender) recordFailure(target *failoverTarget, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target.healthy = false
+	target.failures++
+	target.lastFailure = time.Now()
+	target.lastError = err
+}
+
+func (s *FailoverSender) Flush(ctx context.Context) error {
+	errs := []string{}
+	for _, target := range s.targets {
+		if err := target.sender.Flush(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+func (s *FailoverSender) Close() error {
+	errs := []string{}
+	for _, target := range s.targets {
+		if err := target.sender.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
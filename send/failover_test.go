@@ -0,0 +1,173 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySender sends messages to an internal sender unless it is
+// failing, in which case it reports an error to its error handler.
+type flakySender struct {
+	failing atomic.Bool
+	closed  atomic.Bool
+	*InternalSender
+}
+
+func newFlakySender(t *testing.T, name string) *flakySender {
+	s, err := NewInternalLogger(name, LevelInfo{level.Debug, level.Debug})
+	require.NoError(t, err)
+	fs := &flakySender{InternalSender: s}
+	fs.closer = func() error {
+		fs.closed.Store(true)
+		return nil
+	}
+	return fs
+}
+
+func (s *flakySender) Send(ctx context.Context, m message.Composer) {
+	if s.failing.Load() {
+		s.ErrorHandler()(ctx, errors.New("unavailable"), m)
+		return
+	}
+	s.InternalSender.Send(ctx, m)
+}
+
+// rejectingSender sends messages to an internal sender, except for
+// those with the rejected text, for which it reports an error to its
+// error handler. It is slow, so that concurrent sends overlap.
+type rejectingSender struct {
+	rejected string
+	*InternalSender
+}
+
+func (s *rejectingSender) Send(ctx context.Context, m message.Composer) {
+	time.Sleep(time.Millisecond)
+	if m.String() == s.rejected {
+		s.ErrorHandler()(ctx, errors.New("rejected"), m)
+		return
+	}
+	s.InternalSender.Send(ctx, m)
+}
+
+func TestFailoverSender(t *testing.T) {
+	t.Run("RequiresSenders", func(t *testing.T) {
+		fs, err := NewFailoverSender(nil)
+		assert.Error(t, err)
+		assert.Nil(t, fs)
+	})
+	t.Run("SendsToPrimary", func(t *testing.T) {
+		primary, secondary := newFlakySender(t, "primary"), newFlakySender(t, "secondary")
+		fs, err := NewFailoverSender(primary, secondary)
+		require.NoError(t, err)
+
+		fs.Send(t.Context(), message.NewDefaultMessage(level.Info, "hello"))
+		assert.Equal(t, 1, primary.Len())
+		assert.Zero(t, secondary.Len())
+		assert.Equal(t, primary, fs.Active())
+		assert.Equal(t, "primary", fs.Name())
+	})
+	t.Run("FailsOverAndBack", func(t *testing.T) {
+		primary, secondary := newFlakySender(t, "primary"), newFlakySender(t, "secondary")
+		fs, err := NewFailoverSender(primary, secondary)
+		require.NoError(t, err)
+		require.NoError(t, fs.SetProbeInterval(20*time.Millisecond))
+		reported := []error{}
+		require.NoError(t, fs.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+			reported = append(reported, err)
+		}))
+
+		primary.failing.Store(true)
+		fs.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+		fs.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+		assert.Zero(t, primary.Len())
+		assert.Equal(t, 2, secondary.Len())
+		assert.Equal(t, secondary, fs.Active())
+		require.Len(t, reported, 1, "the failed primary is not retried before the probe interval")
+		assert.Contains(t, reported[0].Error(), "sender 'primary' failed: unavailable")
+
+		status := fs.Status()
+		require.Len(t, status, 2)
+		assert.False(t, status[0].Healthy)
+		assert.False(t, status[0].Active)
+		assert.EqualValues(t, 1, status[0].Failures)
+		assert.Equal(t, "unavailable", status[0].LastError)
+		assert.True(t, status[1].Healthy)
+		assert.True(t, status[1].Active)
+
+		primary.failing.Store(false)
+		time.Sleep(30 * time.Millisecond)
+		fs.Send(t.Context(), message.NewDefaultMessage(level.Info, "third"))
+		assert.Equal(t, 1, primary.Len())
+		assert.Equal(t, primary, fs.Active())
+		assert.True(t, fs.Status()[0].Healthy)
+	})
+	t.Run("AllSendersFail", func(t *testing.T) {
+		primary, secondary := newFlakySender(t, "primary"), newFlakySender(t, "secondary")
+		fs, err := NewFailoverSender(primary, secondary)
+		require.NoError(t, err)
+		reported := []error{}
+		require.NoError(t, fs.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+			reported = append(reported, err)
+		}))
+
+		primary.failing.Store(true)
+		secondary.failing.Store(true)
+		fs.Send(t.Context(), message.NewDefaultMessage(level.Info, "lost"))
+		require.Len(t, reported, 3)
+		assert.Contains(t, reported[2].Error(), "all failover senders failed")
+	})
+	t.Run("ConcurrentSendsFailIndependently", func(t *testing.T) {
+		internal, err := NewInternalLogger("primary", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+		primary := &rejectingSender{rejected: "bad", InternalSender: internal}
+		secondary := newFlakySender(t, "secondary")
+		fs, err := NewFailoverSender(primary, secondary)
+		require.NoError(t, err)
+		// Probe the primary with every message, so that only the
+		// rejected messages go to the secondary.
+		require.NoError(t, fs.SetProbeInterval(time.Nanosecond))
+		require.NoError(t, fs.SetErrorHandler(func(context.Context, error, message.Composer) {}))
+
+		const senders, messages = 8, 20
+		var wg sync.WaitGroup
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < messages; j++ {
+					text := "good"
+					if j%2 == 0 {
+						text = "bad"
+					}
+					fs.Send(t.Context(), message.NewDefaultMessage(level.Info, text))
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, senders*messages/2, primary.Len())
+		require.Equal(t, senders*messages/2, secondary.Len(), "messages that the primary sent are not sent again")
+		for secondary.HasMessage() {
+			assert.Equal(t, "bad", secondary.GetMessage().Rendered)
+		}
+		assert.EqualValues(t, senders*messages/2, fs.Status()[0].Failures)
+	})
+	t.Run("CloseClosesAllSenders", func(t *testing.T) {
+		primary, secondary := newFlakySender(t, "primary"), newFlakySender(t, "secondary")
+		fs, err := NewFailoverSender(primary, secondary)
+		require.NoError(t, err)
+
+		require.NoError(t, fs.Close())
+		assert.True(t, primary.closed.Load())
+		assert.True(t, secondary.closed.Load())
+	})
+}
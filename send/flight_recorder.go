@@ -0,0 +1,281 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+const (
+	defaultFlightRecorderCapacity = 100
+	defaultFlightRecorderMaxKeys  = 1000
+
+	// RecordedPriorityKey is the annotation that the flight
+	// recorder adds to the copies of the messages that it flushes:
+	// the original priority of the message, which is raised so
+	// that the underlying sender logs it.
+	RecordedPriorityKey = "recorded_priority"
+)
+
+// FlightRecorderOptions configure the flight recorder sender.
+type FlightRecorderOptions struct {
+	// Capacity is the maximum number of messages to keep for each
+	// key. Defaults to 100.
+	Capacity int
+	// MaxAge, if set, is the maximum age of the messages that are
+	// flushed.
+	MaxAge time.Duration
+	// Trigger is the lowest priority of the messages that flush
+	// the recorded messages for their key. Defaults to Error.
+	Trigger level.Priority
+
+	// KeyField, ContextKey and Key determine the key of messages,
+	// such as a request ID, so that only the messages related to a
+	// triggering message are flushed with it. Key takes precedence
+	// over ContextKey, which takes precedence over KeyField.
+	// KeyField is a field of the messages; ContextKey is the key
+	// of a value in the context passed to Send. Messages without a
+	// key share a single buffer.
+	KeyField   string
+	ContextKey interface{}
+	Key        func(context.Context, message.Composer) string
+	// MaxKeys is the maximum number of keys to keep messages for.
+	// The least recently used keys are dropped first. Defaults to
+	// 1000.
+	MaxKeys int
+}
+
+func (opts *FlightRecorderOptions) validate() error {
+	catcher := []string{}
+	if opts.Capacity < 0 {
+		catcher = append(catcher, "capacity cannot be negative")
+	}
+	if opts.MaxAge < 0 {
+		catcher = append(catcher, "max age cannot be negative")
+	}
+	if opts.Trigger != level.Invalid && !opts.Trigger.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid trigger priority '%d'", opts.Trigger))
+	}
+	if opts.MaxKeys < 0 {
+		catcher = append(catcher, "max keys cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Capacity == 0 {
+		opts.Capacity = defaultFlightRecorderCapacity
+	}
+	if opts.Trigger == level.Invalid {
+		opts.Trigger = level.Error
+	}
+	if opts.MaxKeys == 0 {
+		opts.MaxKeys = defaultFlightRecorderMaxKeys
+	}
+
+	return nil
+}
+
+// recordedMessage is a message in a flight recorder buffer, with the
+// time that it was recorded.
+type recordedMessage struct {
+	message.Composer
+	recorded time.Time
+}
+
+// flightRecording is the ring buffer of the messages for a key.
+type flightRecording struct {
+	buffer   *InMemorySender
+	lastUsed time.Time
+}
+
+type flightRecorderSender struct {
+	opts       FlightRecorderOptions
+	mu         sync.Mutex
+	recordings map[string]*flightRecording
+
+	Sender
+}
+
+// NewFlightRecorderSender provides a Sender implementation that wraps
+// an existing Sender and keeps the most recent messages that are below
+// the threshold of the underlying Sender in a ring buffer for each key,
+// such as a request ID. When a message at or above the trigger priority
+// arrives, the recorded messages for its key are flushed to the
+// underlying Sender ahead of it, in a group, to provide debugging
+// context for the failure. The flushed messages are copies of the
+// recorded messages, whose priority is raised to the threshold of the
+// underlying Sender so that it logs them, and which are annotated with
+// their original priority (see RecordedPriorityKey) if their payloads
+// are message.Fields or documents. Payloads of other types, such as
+// *message.Slack, keep their types and are not annotated. The recorded
+// messages are not modified.
+//
+// Since the flight recorder owns the underlying Sender, calling Close
+// on this sender will close the underlying sender.
+func NewFlightRecorderSender(sender Sender, opts FlightRecorderOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &flightRecorderSender{
+		opts:       opts,
+		recordings: map[string]*flightRecording{},
+		Sender:     sender,
+	}, nil
+}
+
+func (s *flightRecorderSender) Send(ctx context.Context, m message.Composer) {
+	msgs := []message.Composer{m}
+	g, isGroup := m.(*message.GroupComposer)
+	if isGroup {
+		msgs = g.Messages()
+	}
+
+	lvl := s.Level()
+	out := []message.Composer{}
+	flushed := false
+	for _, c := range msgs {
+		if !c.Loggable() {
+			continue
+		}
+		if !lvl.ShouldLog(c) {
+			s.record(s.key(ctx, c), c)
+			continue
+		}
+		if c.Priority() >= s.opts.Trigger {
+			if recorded := s.flush(s.key(ctx, c), lvl.Threshold); len(recorded) > 0 {
+				out = append(out, recorded...)
+				flushed = true
+			}
+		}
+		out = append(out, c)
+	}
+
+	switch {
+	case len(out) == 0:
+	case !flushed && isGroup && len(out) == len(msgs):
+		s.Sender.Send(ctx, m)
+	case len(out) == 1:
+		s.Sender.Send(ctx, out[0])
+	default:
+		s.Sender.Send(ctx, message.NewGroupComposer(out))
+	}
+}
+
+func (s *flightRecorderSender) key(ctx context.Context, m message.Composer) string {
+	switch {
+	case s.opts.Key != nil:
+		return s.opts.Key(ctx, m)
+	case s.opts.ContextKey != nil:
+		if value := ctx.Value(s.opts.ContextKey); value != nil {
+			return fmt.Sprint(value)
+		}
+	case s.opts.KeyField != "":
+		if value, ok := messageAttributes(m)[s.opts.KeyField]; ok {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return ""
+}
+
+func (s *flightRecorderSender) record(key string, m message.Composer) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recording, ok := s.recordings[key]
+	if !ok {
+		if len(s.recordings) >= s.opts.MaxKeys {
+			s.evict()
+		}
+		buffer, err := NewInMemorySender(key, LevelInfo{level.Trace, level.Trace}, s.opts.Capacity)
+		if err != nil {
+			return
+		}
+		recording = &flightRecording{buffer: buffer.(*InMemorySender)}
+		s.recordings[key] = recording
+	}
+
+	recording.lastUsed = now
+	recording.buffer.Send(context.Background(), &recordedMessage{Composer: m, recorded: now})
+}
+
+// evict drops the least recently used recording. The caller must hold
+// the lock.
+func (s *flightRecorderSender) evict() {
+	oldestKey := ""
+	var oldest *flightRecording
+	for key, recording := range s.recordings {
+		if oldest == nil || recording.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, recording
+		}
+	}
+	delete(s.recordings, oldestKey)
+}
+
+// flush removes the recording for a key and returns copies of its
+// messages that are within the maximum age, raised to the threshold.
+func (s *flightRecorderSender) flush(key string, threshold level.Priority) []message.Composer {
+	s.mu.Lock()
+	recording, ok := s.recordings[key]
+	delete(s.recordings, key)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	out := []message.Composer{}
+	for _, c := range recording.buffer.Get() {
+		recorded := c.(*recordedMessage)
+		if s.opts.MaxAge > 0 && now.Sub(recorded.recorded) > s.opts.MaxAge {
+			continue
+		}
+
+		out = append(out, flushedMessage(recorded.Composer, threshold))
+	}
+
+	return out
+}
+
+// flushedMessage returns a copy of a recorded message with a raised
+// priority. Copies of messages with message.Fields payloads, or that
+// are their own Raw form, are annotated with the original priority.
+func flushedMessage(m message.Composer, p level.Priority) message.Composer {
+	original := m.Priority().String()
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok && !isSelf(raw, m) {
+		raw = c.Raw()
+	}
+
+	switch payload := raw.(type) {
+	case message.Fields:
+		fields := make(message.Fields, len(payload)+1)
+		for k, v := range payload {
+			fields[k] = v
+		}
+		if _, ok := fields[RecordedPriorityKey]; !ok {
+			fields[RecordedPriorityKey] = original
+		}
+		raw = fields
+	case message.Composer:
+		if doc, err := messageDocument(m); err == nil {
+			if _, ok := doc[RecordedPriorityKey]; !ok {
+				doc[RecordedPriorityKey] = original
+			}
+			raw = doc
+		}
+	}
+
+	return newDocumentMessage(p, m.String(), raw)
+}
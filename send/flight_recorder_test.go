@@ -0,0 +1,132 @@
+package send
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flightRecorderKey struct{}
+
+func TestFlightRecorderSender(t *testing.T) {
+	newFlightRecorder := func(t *testing.T, opts FlightRecorderOptions) (Sender, *InternalSender) {
+		internal, err := NewInternalLogger("internal", LevelInfo{level.Info, level.Info})
+		require.NoError(t, err)
+		s, err := NewFlightRecorderSender(internal, opts)
+		require.NoError(t, err)
+		return s, internal
+	}
+	groupStrings := func(t *testing.T, m message.Composer) []string {
+		group, ok := m.(*message.GroupComposer)
+		require.True(t, ok)
+		out := []string{}
+		for _, msg := range group.Messages() {
+			out = append(out, msg.String())
+		}
+		return out
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []FlightRecorderOptions{
+			{Capacity: -1},
+			{MaxAge: -time.Second},
+			{Trigger: 200},
+			{MaxKeys: -1},
+		} {
+			s, err := NewFlightRecorderSender(nil, opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("FlushesOnTrigger", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{Capacity: 2})
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "one"))
+		two := message.NewDefaultMessage(level.Debug, "two")
+		s.Send(t.Context(), two)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Trace, "three"))
+		assert.False(t, internal.HasMessage())
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "passed through"))
+		assert.Equal(t, "passed through", internal.GetMessage().Message.String())
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed"))
+		msg := internal.GetMessage()
+		assert.Equal(t, []string{"two", "three", "failed"}, groupStrings(t, msg.Message))
+
+		recorded := msg.Message.(*message.GroupComposer).Messages()[0]
+		assert.Equal(t, level.Info, recorded.Priority())
+		assert.Equal(t, level.Debug.String(), messageAttributes(recorded)[RecordedPriorityKey])
+		assert.Equal(t, level.Debug, two.Priority(), "the recorded message is not modified")
+		assert.NotContains(t, messageAttributes(two), RecordedPriorityKey)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed again"))
+		assert.Equal(t, "failed again", internal.GetMessage().Message.String(), "the recording is cleared after a flush")
+	})
+	t.Run("MaxAge", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{MaxAge: 20 * time.Millisecond})
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "old"))
+		time.Sleep(40 * time.Millisecond)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "new"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Critical, "failed"))
+		assert.Equal(t, []string{"new", "failed"}, groupStrings(t, internal.GetMessage().Message))
+	})
+	t.Run("KeysFromFields", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{KeyField: "request"})
+
+		s.Send(t.Context(), message.NewFields(level.Debug, message.Fields{"request": 1, "message": "one"}))
+		s.Send(t.Context(), message.NewFields(level.Debug, message.Fields{"request": 2, "message": "two"}))
+		s.Send(t.Context(), message.NewFields(level.Error, message.Fields{"request": 2, "message": "failed"}))
+
+		group := internal.GetMessage().Message.(*message.GroupComposer)
+		require.Len(t, group.Messages(), 2)
+		fields := group.Messages()[0].Raw().(message.Fields)
+		assert.EqualValues(t, 2, fields["request"])
+		assert.Equal(t, level.Debug.String(), fields[RecordedPriorityKey])
+		assert.False(t, internal.HasMessage())
+	})
+	t.Run("KeysFromContext", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{ContextKey: flightRecorderKey{}})
+		first := context.WithValue(t.Context(), flightRecorderKey{}, "first")
+		second := context.WithValue(t.Context(), flightRecorderKey{}, "second")
+
+		s.Send(first, message.NewDefaultMessage(level.Debug, "one"))
+		s.Send(second, message.NewDefaultMessage(level.Debug, "two"))
+		s.Send(first, message.NewDefaultMessage(level.Error, "failed"))
+		assert.Equal(t, []string{"one", "failed"}, groupStrings(t, internal.GetMessage().Message))
+	})
+	t.Run("EvictsLeastRecentlyUsedKeys", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{KeyField: "request", MaxKeys: 1})
+
+		s.Send(t.Context(), message.NewFields(level.Debug, message.Fields{"request": 1}))
+		s.Send(t.Context(), message.NewFields(level.Debug, message.Fields{"request": 2}))
+		s.Send(t.Context(), message.NewFields(level.Error, message.Fields{"request": 1}))
+		_, ok := internal.GetMessage().Message.(*message.GroupComposer)
+		assert.False(t, ok)
+	})
+	t.Run("Groups", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{})
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Debug, "one"),
+			message.NewDefaultMessage(level.Info, "two"),
+			message.NewDefaultMessage(level.Error, "failed"),
+		))
+		assert.Equal(t, []string{"two", "one", "failed"}, groupStrings(t, internal.GetMessage().Message))
+	})
+	t.Run("KeepsPayloadTypes", func(t *testing.T) {
+		s, internal := newFlightRecorder(t, FlightRecorderOptions{})
+
+		s.Send(t.Context(), message.NewSlackMessage(level.Debug, "#chan", "recorded", nil))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "failed"))
+		recorded := internal.GetMessage().Message.(*message.GroupComposer).Messages()[0]
+		assert.Equal(t, level.Info, recorded.Priority())
+		assert.Equal(t, &message.Slack{Target: "#chan", Msg: "recorded"}, recorded.Raw())
+	})
+}
@@ -0,0 +1,455 @@
+package send
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultFluentTimeout       = 5 * time.Second
+	defaultFluentBufferSize    = 1024
+	defaultFluentRetryInterval = time.Second
+)
+
+// FluentOptions configures the Fluentd/Fluent Bit forward protocol
+// sender.
+type FluentOptions struct {
+	// Network is either "tcp" (the default) or "unix".
+	Network string `bson:"network" json:"network" yaml:"network"`
+	// Address is the host and port of the forward input, or the
+	// path to its socket for the unix network.
+	Address string `bson:"address" json:"address" yaml:"address"`
+	// TagField, if set, names a field of the message whose value
+	// is appended to the sender name to form the tag of the
+	// message, e.g. "app.audit" for a sender named "app" and a
+	// message with {"TagField": "audit"}.
+	TagField string `bson:"tag_field" json:"tag_field" yaml:"tag_field"`
+	// RequireAck requests an acknowledgment for every write and
+	// treats writes that the server does not acknowledge as
+	// failures, so that messages are retried rather than lost.
+	RequireAck bool `bson:"require_ack" json:"require_ack" yaml:"require_ack"`
+	// Timeout is the timeout for connecting, writing and waiting
+	// for acknowledgments. Defaults to 5 seconds.
+	Timeout time.Duration `bson:"timeout" json:"timeout" yaml:"timeout"`
+	// BufferSize is the maximum number of writes held while the
+	// server is unreachable. When the buffer is full, the oldest
+	// buffered messages are dropped. Defaults to 1024.
+	BufferSize int `bson:"buffer_size" json:"buffer_size" yaml:"buffer_size"`
+	// RetryInterval is the minimum time between attempts to
+	// reconnect to the server, and the interval at which buffered
+	// messages are retried in the background. Defaults to 1 second.
+	RetryInterval time.Duration `bson:"retry_interval" json:"retry_interval" yaml:"retry_interval"`
+}
+
+// Validate checks the options for required values and populates
+// defaults.
+func (opts *FluentOptions) Validate() error {
+	catcher := []string{}
+	switch opts.Network {
+	case "":
+		opts.Network = "tcp"
+	case "tcp", "unix":
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid network '%s'", opts.Network))
+	}
+	if opts.Address == "" {
+		catcher = append(catcher, "must specify an address")
+	}
+	if opts.Timeout < 0 {
+		catcher = append(catcher, "timeout cannot be negative")
+	}
+	if opts.BufferSize < 0 {
+		catcher = append(catcher, "buffer size cannot be negative")
+	}
+	if opts.RetryInterval < 0 {
+		catcher = append(catcher, "retry interval cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultFluentTimeout
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = defaultFluentBufferSize
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = defaultFluentRetryInterval
+	}
+
+	return nil
+}
+
+// fluentWrite is an encoded forward protocol message, along with the
+// composer it was built from, for error reporting.
+type fluentWrite struct {
+	data    []byte
+	chunk   string
+	message message.Composer
+}
+
+type fluentSender struct {
+	opts     FluentOptions
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	pending  []fluentWrite
+	lastDial time.Time
+	down     bool
+	retry    *time.Timer
+	closed   bool
+	*Base
+}
+
+// NewFluentSender constructs a Sender that writes messages to the
+// forward input of Fluentd or Fluent Bit. See MakeFluentSender for more
+// information.
+func NewFluentSender(name string, opts FluentOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeFluentSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeFluentSender constructs an unconfigured Fluent forward protocol
+// Sender. Pass to Journaler.SetSender or call SetName before using.
+//
+// The record of each event is the Raw form of the message; values
+// that are not documents are stored in the "message" field of the
+// record. Groups of messages (e.g. from the buffered senders) are
+// written in a single PackedForward message per tag.
+//
+// When the server is unreachable, writes are held in a bounded buffer
+// and retried, in order, in the background every RetryInterval, as
+// well as on the next Send or Flush. The error handler is called when
+// the sender loses its connection and when buffered messages are
+// dropped. Close attempts to
+// deliver buffered messages and returns an error if any remain.
+func MakeFluentSender(opts FluentOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Fluent options")
+	}
+
+	s := &fluentSender{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	s.closer = func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Close runs with the sender locked, so undelivered
+		// messages are reported in the returned error rather than
+		// through the error handler.
+		s.closed = true
+		if s.retry != nil {
+			s.retry.Stop()
+			s.retry = nil
+		}
+		s.lastDial = time.Time{}
+		err := s.drain()
+		if s.conn != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+		}
+		if len(s.pending) > 0 {
+			return errors.Wrapf(err, "%d buffered messages were not delivered", len(s.pending))
+		}
+
+		return nil
+	}
+
+	return s, nil
+}
+
+func (s *fluentSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	name := s.Name()
+	now := time.Now()
+	tags := []string{}
+	entries := map[string]*msgpackBuffer{}
+	counts := map[string]int{}
+	sources := map[string][]message.Composer{}
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		record, err := messageDocument(c)
+		if err != nil {
+			s.ErrorHandler()(ctx, errors.Wrap(err, "encoding Fluent record"), c)
+			continue
+		}
+
+		tag := s.tag(name, record)
+		if _, ok := entries[tag]; !ok {
+			tags = append(tags, tag)
+			entries[tag] = &msgpackBuffer{}
+		}
+
+		entry := entries[tag]
+		entry.ArrayHeader(2)
+		entry.EventTime(now)
+		entry.Value(record)
+		counts[tag]++
+		sources[tag] = append(sources[tag], c)
+	}
+
+	writes := make([]fluentWrite, 0, len(tags))
+	for _, tag := range tags {
+		write, err := s.encode(tag, entries[tag].Bytes(), counts[tag])
+		if err != nil {
+			s.ErrorHandler()(ctx, err, m)
+			return
+		}
+
+		write.message = sources[tag][0]
+		if len(sources[tag]) > 1 {
+			write.message = message.MakeGroupComposer(sources[tag]...)
+		}
+		writes = append(writes, write)
+	}
+
+	if len(writes) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	dropped := s.enqueue(writes)
+	wasDown := s.down
+	err := s.drain()
+	s.mu.Unlock()
+
+	for _, w := range dropped {
+		s.ErrorHandler()(ctx, errors.New("Fluent buffer is full, dropping oldest message"), w.message)
+	}
+	if err != nil && !wasDown {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "lost connection to Fluent server, buffering messages"), m)
+	}
+}
+
+func (s *fluentSender) Flush(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastDial = time.Time{}
+	if err := s.drain(); err != nil {
+		return errors.Wrapf(err, "%d buffered messages were not delivered", len(s.pending))
+	}
+
+	return nil
+}
+
+// tag returns the tag for a record: the sender name, followed by the
+// value of the tag field when the record has one.
+func (s *fluentSender) tag(name string, record map[string]interface{}) string {
+	if s.opts.TagField == "" {
+		return name
+	}
+
+	value, ok := record[s.opts.TagField]
+	if !ok || value == nil {
+		return name
+	}
+
+	suffix := fmt.Sprint(value)
+	if suffix == "" {
+		return name
+	}
+	if name == "" {
+		return suffix
+	}
+
+	return name + "." + suffix
+}
+
+// encode builds a forward protocol message for the encoded entries of
+// a tag: Message mode, [tag, time, record, option], for a single
+// entry, and PackedForward mode, [tag, entries, option], otherwise.
+func (s *fluentSender) encode(tag string, entries []byte, count int) (fluentWrite, error) {
+	out := fluentWrite{}
+	if s.opts.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return out, errors.Wrap(err, "generating Fluent chunk ID")
+		}
+		out.chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	buf := &msgpackBuffer{}
+	if count == 1 {
+		if out.chunk == "" {
+			buf.ArrayHeader(3)
+		} else {
+			buf.ArrayHeader(4)
+		}
+		buf.String(tag)
+		// The entry is encoded as [time, record], so splice its
+		// elements into the message.
+		buf.buf = append(buf.buf, entries[1:]...)
+		if out.chunk != "" {
+			buf.MapHeader(1)
+			buf.String("chunk")
+			buf.String(out.chunk)
+		}
+	} else {
+		buf.ArrayHeader(3)
+		buf.String(tag)
+		buf.Binary(entries)
+		if out.chunk == "" {
+			buf.MapHeader(1)
+		} else {
+			buf.MapHeader(2)
+			buf.String("chunk")
+			buf.String(out.chunk)
+		}
+		buf.String("size")
+		buf.Int(int64(count))
+	}
+
+	out.data = buf.Bytes()
+	return out, nil
+}
+
+// enqueue adds writes to the pending buffer, returning the writes
+// that were dropped to stay within the buffer size.
+func (s *fluentSender) enqueue(writes []fluentWrite) []fluentWrite {
+	s.pending = append(s.pending, writes...)
+	if overflow := len(s.pending) - s.opts.BufferSize; overflow > 0 {
+		dropped := append([]fluentWrite{}, s.pending[:overflow]...)
+		s.pending = append(s.pending[:0:0], s.pending[overflow:]...)
+		return dropped
+	}
+
+	return nil
+}
+
+// drain delivers pending writes in order, stopping at the first
+// failure, after which it schedules a retry. The caller must hold the
+// sender's lock.
+func (s *fluentSender) drain() error {
+	for len(s.pending) > 0 {
+		if err := s.deliver(s.pending[0]); err != nil {
+			s.down = true
+			if s.conn != nil {
+				_ = s.conn.Close()
+				s.conn = nil
+			}
+			s.scheduleRetry()
+			return err
+		}
+
+		s.pending[0] = fluentWrite{}
+		s.pending = s.pending[1:]
+	}
+
+	return nil
+}
+
+// scheduleRetry starts a timer to drain the pending writes in the
+// background after the retry interval, unless one is already running
+// or the sender is closed. The caller must hold the sender's lock.
+func (s *fluentSender) scheduleRetry() {
+	if s.closed || s.retry != nil || len(s.pending) == 0 {
+		return
+	}
+
+	s.retry = time.AfterFunc(s.opts.RetryInterval, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.retry = nil
+		if s.closed {
+			return
+		}
+		// drain schedules the next retry if this one fails.
+		_ = s.drain()
+	})
+}
+
+func (s *fluentSender) deliver(w fluentWrite) error {
+	if s.conn != nil && !s.opts.RequireAck && streamClosedByPeer(s.conn) {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	if s.conn == nil {
+		if time.Since(s.lastDial) < s.opts.RetryInterval {
+			return errors.New("waiting to reconnect to Fluent server")
+		}
+
+		s.lastDial = time.Now()
+		conn, err := net.DialTimeout(s.opts.Network, s.opts.Address, s.opts.Timeout)
+		if err != nil {
+			return errors.Wrapf(err, "dialing '%s'", s.opts.Address)
+		}
+
+		if s.opts.RequireAck {
+			s.conn = conn
+			s.reader = bufio.NewReader(conn)
+		} else {
+			s.conn = watchPeer(conn)
+		}
+	}
+
+	deadline := time.Now().Add(s.opts.Timeout)
+	if s.opts.RequireAck {
+		if err := s.conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(err, "setting deadline")
+		}
+	} else if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return errors.Wrap(err, "setting deadline")
+	}
+	if _, err := s.conn.Write(w.data); err != nil {
+		return errors.Wrap(err, "writing Fluent message")
+	}
+
+	if w.chunk != "" {
+		ack, err := readMsgpackStringMap(s.reader)
+		if err != nil {
+			return errors.Wrap(err, "reading Fluent acknowledgment")
+		}
+		if ack["ack"] != w.chunk {
+			return errors.Errorf("Fluent server acknowledged chunk '%s', expected '%s'", ack["ack"], w.chunk)
+		}
+	}
+
+	s.down = false
+	return nil
+}
@@ -0,0 +1,355 @@
+package send
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeMsgpack decodes the subset of MessagePack produced by
+// msgpackBuffer. EventTime values are decoded as time.Time values.
+func decodeMsgpack(t *testing.T, r *bufio.Reader) interface{} {
+	b, err := r.ReadByte()
+	require.NoError(t, err)
+
+	next := func(n int) []byte {
+		data := make([]byte, n)
+		_, err := io.ReadFull(r, data)
+		require.NoError(t, err)
+		return data
+	}
+	length := func(size int) int {
+		v, err := readMsgpackUint(r, size)
+		require.NoError(t, err)
+		return int(v)
+	}
+	array := func(n int) []interface{} {
+		out := make([]interface{}, n)
+		for i := range out {
+			out[i] = decodeMsgpack(t, r)
+		}
+		return out
+	}
+	doc := func(n int) map[string]interface{} {
+		out := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, ok := decodeMsgpack(t, r).(string)
+			require.True(t, ok)
+			out[key] = decodeMsgpack(t, r)
+		}
+		return out
+	}
+
+	switch {
+	case b < 0x80:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b&0xf0 == 0x80:
+		return doc(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return array(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return string(next(int(b & 0x1f)))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xc4, 0xc5, 0xc6:
+		return next(length(1 << (b - 0xc4)))
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(next(8)))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return int64(length(1 << (b - 0xcc)))
+	case 0xd0:
+		return int64(int8(next(1)[0]))
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(next(2))))
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(next(4))))
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(next(8)))
+	case 0xd7:
+		data := next(9)
+		require.Equal(t, byte(0), data[0])
+		return time.Unix(int64(binary.BigEndian.Uint32(data[1:5])), int64(binary.BigEndian.Uint32(data[5:])))
+	case 0xd9, 0xda, 0xdb:
+		return string(next(length(1 << (b - 0xd9))))
+	case 0xdc, 0xdd:
+		return array(length(2 << (b - 0xdc)))
+	case 0xde, 0xdf:
+		return doc(length(2 << (b - 0xde)))
+	}
+
+	require.Failf(t, "unsupported MessagePack type", "0x%02x", b)
+	return nil
+}
+
+type fluentServer struct {
+	net.Listener
+	ack      bool
+	mu       sync.Mutex
+	messages [][]interface{}
+	conns    []net.Conn
+	received chan struct{}
+}
+
+func newFluentServer(t *testing.T, network, address string, ack bool) *fluentServer {
+	ln, err := net.Listen(network, address)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	srv := &fluentServer{Listener: ln, ack: ack, received: make(chan struct{}, 100)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, conn)
+			srv.mu.Unlock()
+			go srv.handle(t, conn)
+		}
+	}()
+
+	return srv
+}
+
+func (srv *fluentServer) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		if _, err := r.Peek(1); err != nil {
+			return
+		}
+
+		msg, ok := decodeMsgpack(t, r).([]interface{})
+		require.True(t, ok)
+
+		if srv.ack {
+			options, ok := msg[len(msg)-1].(map[string]interface{})
+			require.True(t, ok)
+			buf := &msgpackBuffer{}
+			buf.MapHeader(1)
+			buf.String("ack")
+			buf.String(options["chunk"].(string))
+			_, err := conn.Write(buf.Bytes())
+			require.NoError(t, err)
+		}
+
+		srv.mu.Lock()
+		srv.messages = append(srv.messages, msg)
+		srv.mu.Unlock()
+		srv.received <- struct{}{}
+	}
+}
+
+func (srv *fluentServer) wait(t *testing.T, n int) [][]interface{} {
+	for i := 0; i < n; i++ {
+		select {
+		case <-srv.received:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for Fluent messages")
+		}
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([][]interface{}{}, srv.messages...)
+}
+
+func (srv *fluentServer) dropConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, conn := range srv.conns {
+		conn.Close()
+	}
+	srv.conns = nil
+}
+
+func TestFluentSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []FluentOptions{
+			{},
+			{Network: "udp", Address: "localhost:24224"},
+			{Address: "localhost:24224", BufferSize: -1},
+		} {
+			s, err := MakeFluentSender(opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("MessageMode", func(t *testing.T) {
+		srv := newFluentServer(t, "tcp", "127.0.0.1:0", false)
+		s, err := NewFluentSender("app", FluentOptions{Address: srv.Addr().String(), TagField: "kind"}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Info, message.Fields{"kind": "audit", "user": "alice", "count": 3}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "plain"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "filtered"))
+
+		msgs := srv.wait(t, 2)
+		require.Len(t, msgs, 2)
+
+		require.Len(t, msgs[0], 3)
+		assert.Equal(t, "app.audit", msgs[0][0])
+		assert.WithinDuration(t, time.Now(), msgs[0][1].(time.Time), time.Minute)
+		assert.Equal(t, map[string]interface{}{"kind": "audit", "user": "alice", "count": int64(3)}, msgs[0][2])
+
+		assert.Equal(t, "app", msgs[1][0])
+		assert.Equal(t, "plain", msgs[1][2].(map[string]interface{})[message.FieldsMsgName])
+	})
+	t.Run("PackedForwardWithAck", func(t *testing.T) {
+		srv := newFluentServer(t, "unix", filepath.Join(t.TempDir(), "fluent.sock"), true)
+		s, err := NewFluentSender("app", FluentOptions{Network: "unix", Address: srv.Addr().String(), RequireAck: true}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+		var handled []error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = append(handled, err) }))
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+			message.NewDefaultMessage(level.Error, "two"),
+		))
+
+		msgs := srv.wait(t, 1)
+		require.Len(t, msgs, 1)
+		require.Len(t, msgs[0], 3)
+		assert.Equal(t, "app", msgs[0][0])
+		options := msgs[0][2].(map[string]interface{})
+		assert.Equal(t, int64(2), options["size"])
+		assert.NotEmpty(t, options["chunk"])
+
+		entries := bufio.NewReader(bytes.NewReader(msgs[0][1].([]byte)))
+		for _, text := range []string{"one", "two"} {
+			entry := decodeMsgpack(t, entries).([]interface{})
+			require.Len(t, entry, 2)
+			assert.Equal(t, text, entry[1].(map[string]interface{})[message.FieldsMsgName])
+		}
+		assert.Empty(t, handled)
+	})
+	t.Run("BuffersDuringOutages", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+
+		s, err := NewFluentSender("app", FluentOptions{Address: addr, RetryInterval: time.Millisecond, BufferSize: 2}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+		var handled []error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = append(handled, err) }))
+
+		for _, text := range []string{"one", "two", "three"} {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, text))
+		}
+		require.Error(t, s.Flush(t.Context()))
+		// One error for the outage and one for the message that
+		// did not fit in the buffer.
+		assert.Len(t, handled, 2)
+
+		srv := newFluentServer(t, "tcp", addr, false)
+		require.NoError(t, s.Flush(t.Context()))
+		msgs := srv.wait(t, 2)
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "two", msgs[0][2].(map[string]interface{})[message.FieldsMsgName])
+		assert.Equal(t, "three", msgs[1][2].(map[string]interface{})[message.FieldsMsgName])
+
+		srv.dropConnections()
+		time.Sleep(10 * time.Millisecond)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "four"))
+		msgs = srv.wait(t, 1)
+		assert.Equal(t, "four", msgs[2][2].(map[string]interface{})[message.FieldsMsgName])
+	})
+	t.Run("RetriesInBackground", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+
+		s, err := NewFluentSender("app", FluentOptions{Address: addr, RetryInterval: 10 * time.Millisecond}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.SetErrorHandler(func(context.Context, error, message.Composer) {}))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "buffered"))
+
+		srv := newFluentServer(t, "tcp", addr, false)
+		msgs := srv.wait(t, 1)
+		assert.Equal(t, "buffered", msgs[0][2].(map[string]interface{})[message.FieldsMsgName], "buffered messages are delivered without another Send or Flush")
+		assert.NoError(t, s.Flush(t.Context()))
+	})
+}
+
+func TestReadMsgpackStringMap(t *testing.T) {
+	t.Run("Ack", func(t *testing.T) {
+		buf := &msgpackBuffer{}
+		buf.MapHeader(1)
+		buf.String("ack")
+		buf.String("chunk")
+
+		ack, err := readMsgpackStringMap(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"ack": "chunk"}, ack)
+	})
+	t.Run("LongString", func(t *testing.T) {
+		// A string that claims to be 4 GiB long is rejected
+		// before anything is allocated for it.
+		data := []byte{0x81, 0xa3, 'a', 'c', 'k', 0xdb, 0xff, 0xff, 0xff, 0xff}
+
+		ack, err := readMsgpackStringMap(bufio.NewReader(bytes.NewReader(data)))
+		assert.Error(t, err)
+		assert.Nil(t, ack)
+	})
+	t.Run("LargeMap", func(t *testing.T) {
+		data := []byte{0xdf, 0xff, 0xff, 0xff, 0xff}
+
+		ack, err := readMsgpackStringMap(bufio.NewReader(bytes.NewReader(data)))
+		assert.Error(t, err)
+		assert.Nil(t, ack)
+	})
+}
+
+func TestMsgpackBuffer(t *testing.T) {
+	buf := &msgpackBuffer{}
+	buf.Int(-1)
+	buf.Int(-200)
+	buf.Uint(200)
+	buf.Uint(70000)
+	buf.String("hi")
+	buf.Bool(true)
+	buf.Nil()
+
+	assert.Equal(t, []byte{
+		0xff,
+		0xd1, 0xff, 0x38,
+		0xcc, 0xc8,
+		0xce, 0x00, 0x01, 0x11, 0x70,
+		0xa2, 'h', 'i',
+		0xc3,
+		0xc0,
+	}, buf.Bytes())
+}
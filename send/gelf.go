@@ -0,0 +1,499 @@
+package send
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	gelfVersion          = "1.1"
+	defaultGELFChunkSize = 1420
+	minGELFChunkSize     = 512
+	maxGELFChunks        = 128
+	gelfChunkHeaderSize  = 12
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// GELFTransport describes how the GELF sender delivers messages.
+type GELFTransport string
+
+const (
+	// GELFTransportUDP sends each message as a datagram, split into
+	// chunks when the message is larger than the chunk size.
+	GELFTransportUDP GELFTransport = "udp"
+	// GELFTransportTCP sends null byte delimited messages over a
+	// TCP connection, which is reestablished if it fails.
+	GELFTransportTCP GELFTransport = "tcp"
+	// GELFTransportHTTP sends each message in an HTTP POST request.
+	GELFTransportHTTP GELFTransport = "http"
+)
+
+// GELFCompression describes how the GELF sender compresses
+// messages. Compression is not supported with the TCP transport.
+type GELFCompression string
+
+const (
+	GELFCompressionNone GELFCompression = ""
+	GELFCompressionGzip GELFCompression = "gzip"
+	GELFCompressionZlib GELFCompression = "zlib"
+)
+
+// GELFOptions configures the GELF sender.
+type GELFOptions struct {
+	Transport GELFTransport `bson:"transport" json:"transport" yaml:"transport"`
+	// Address is the host and port of the Graylog input for the
+	// UDP and TCP transports, or the full URL of the input
+	// (e.g. "http://graylog:12201/gelf") for the HTTP transport.
+	Address     string          `bson:"address" json:"address" yaml:"address"`
+	Compression GELFCompression `bson:"compression" json:"compression" yaml:"compression"`
+	// Host is the value of the "host" field of every
+	// message. Defaults to the hostname of the system.
+	Host string `bson:"host" json:"host" yaml:"host"`
+
+	// ChunkSize is the maximum size of a UDP datagram, including
+	// the chunk header. Defaults to 1420 bytes.
+	ChunkSize int `bson:"chunk_size" json:"chunk_size" yaml:"chunk_size"`
+	// TLSConfig, if set, is used to establish TLS connections for
+	// the TCP transport.
+	TLSConfig *tls.Config `bson:"-" json:"-" yaml:"-"`
+	// DialTimeout is the timeout for establishing UDP and TCP
+	// connections. Defaults to 5 seconds.
+	DialTimeout time.Duration `bson:"dial_timeout" json:"dial_timeout" yaml:"dial_timeout"`
+
+	// Client is the HTTP client used by the HTTP transport.
+	// Defaults to a client with a 10 second timeout.
+	Client           *http.Client `bson:"-" json:"-" yaml:"-"`
+	HTTPRetryOptions `bson:"retry" json:"retry" yaml:"retry"`
+}
+
+// Validate checks the options for required and conflicting values and
+// populates defaults.
+func (opts *GELFOptions) Validate() error {
+	catcher := []string{}
+	switch opts.Transport {
+	case GELFTransportUDP, GELFTransportHTTP:
+	case GELFTransportTCP:
+		if opts.Compression != GELFCompressionNone {
+			catcher = append(catcher, "compression is not supported with the TCP transport")
+		}
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid transport '%s'", opts.Transport))
+	}
+	switch opts.Compression {
+	case GELFCompressionNone, GELFCompressionGzip, GELFCompressionZlib:
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid compression '%s'", opts.Compression))
+	}
+	if opts.Address == "" {
+		catcher = append(catcher, "must specify an address")
+	}
+	if opts.ChunkSize != 0 && opts.ChunkSize < minGELFChunkSize {
+		catcher = append(catcher, fmt.Sprintf("chunk size must be at least %d", minGELFChunkSize))
+	}
+	if opts.DialTimeout < 0 {
+		catcher = append(catcher, "dial timeout cannot be negative")
+	}
+	if err := opts.HTTPRetryOptions.validate(); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = defaultGELFChunkSize
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return nil
+}
+
+type gelfSender struct {
+	opts GELFOptions
+	mu   sync.Mutex
+	conn net.Conn
+	*Base
+}
+
+// NewGELFSender constructs a Sender that writes messages to Graylog,
+// or any other service that accepts the Graylog Extended Log Format
+// (GELF). See MakeGELFSender for more information.
+func NewGELFSender(name string, opts GELFOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeGELFSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeGELFSender constructs an unconfigured GELF Sender. Pass to
+// Journaler.SetSender or call SetName before using.
+//
+// The short message is the string form of the message. Stack traces
+// from the message.Stack composers are sent as the full message, and
+// the fields and annotations of messages are flattened into
+// additional fields, so that {"a": {"b": 1}} becomes "_a_b": 1.
+func MakeGELFSender(opts GELFOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid GELF options")
+	}
+
+	s := &gelfSender{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	s.closer = func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.conn == nil {
+			return nil
+		}
+
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	return s, nil
+}
+
+func (s *gelfSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		payload, err := json.Marshal(newGELFMessage(s.opts.Host, c))
+		if err != nil {
+			s.ErrorHandler()(ctx, errors.Wrap(err, "encoding GELF message"), c)
+			continue
+		}
+
+		if err = s.write(ctx, payload); err != nil {
+			s.ErrorHandler()(ctx, err, c)
+		}
+	}
+}
+
+func (s *gelfSender) Flush(_ context.Context) error { return nil }
+
+func (s *gelfSender) write(ctx context.Context, payload []byte) error {
+	switch s.opts.Transport {
+	case GELFTransportHTTP:
+		return s.writeHTTP(ctx, payload)
+	case GELFTransportTCP:
+		return s.writeTCP(payload)
+	default:
+		return s.writeUDP(payload)
+	}
+}
+
+func (s *gelfSender) compress(payload []byte) ([]byte, error) {
+	var (
+		buf = &bytes.Buffer{}
+		w   io.WriteCloser
+	)
+
+	switch s.opts.Compression {
+	case GELFCompressionGzip:
+		w = gzip.NewWriter(buf)
+	case GELFCompressionZlib:
+		w = zlib.NewWriter(buf)
+	default:
+		return payload, nil
+	}
+
+	if _, err := w.Write(payload); err != nil {
+		return nil, errors.Wrap(err, "compressing GELF message")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "compressing GELF message")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *gelfSender) writeUDP(payload []byte) error {
+	payload, err := s.compress(payload)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := gelfChunks(payload, s.opts.ChunkSize)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if s.conn, err = net.DialTimeout("udp", s.opts.Address, s.opts.DialTimeout); err != nil {
+			s.conn = nil
+			return errors.Wrapf(err, "dialing '%s'", s.opts.Address)
+		}
+	}
+
+	for _, chunk := range chunks {
+		if _, err = s.conn.Write(chunk); err != nil {
+			return errors.Wrap(err, "writing GELF datagram")
+		}
+	}
+
+	return nil
+}
+
+// writeTCP writes a null byte delimited message to the connection,
+// reconnecting and retrying once if the write fails, since writes to a
+// connection that the server closed only fail after the fact.
+func (s *gelfSender) writeTCP(payload []byte) error {
+	frame := make([]byte, 0, len(payload)+1)
+	frame = append(frame, payload...)
+	frame = append(frame, 0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.conn != nil && streamClosedByPeer(s.conn) {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.dialTCP(); err != nil {
+				continue
+			}
+		}
+
+		if _, err = s.conn.Write(frame); err == nil {
+			return nil
+		}
+
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	return errors.Wrap(err, "writing GELF message")
+}
+
+func (s *gelfSender) dialTCP() error {
+	dialer := &net.Dialer{Timeout: s.opts.DialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.opts.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.opts.Address, s.opts.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.opts.Address)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "dialing '%s'", s.opts.Address)
+	}
+
+	s.conn = watchPeer(conn)
+	return nil
+}
+
+func (s *gelfSender) writeHTTP(ctx context.Context, payload []byte) error {
+	payload, err := s.compress(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doHTTPWithRetry(ctx, s.opts.Client, s.opts.HTTPRetryOptions, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.Address, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if s.opts.Compression == GELFCompressionGzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		} else if s.opts.Compression == GELFCompressionZlib {
+			req.Header.Set("Content-Encoding", "deflate")
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "sending GELF message")
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// gelfChunks splits a payload into chunked GELF datagrams, if the
+// payload does not fit in a single datagram. Each chunk starts with
+// the magic bytes, a random 8 byte message ID, and the sequence number
+// and count.
+func gelfChunks(payload []byte, size int) ([][]byte, error) {
+	if len(payload) <= size {
+		return [][]byte{payload}, nil
+	}
+
+	dataSize := size - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > maxGELFChunks {
+		return nil, errors.Errorf("GELF message of %d bytes requires %d chunks, which exceeds the limit of %d", len(payload), count, maxGELFChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.Wrap(err, "generating GELF message ID")
+	}
+
+	chunks := make([][]byte, 0, count)
+	for seq := 0; seq < count; seq++ {
+		end := (seq + 1) * dataSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-seq*dataSize)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, payload[seq*dataSize:end]...)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// newGELFMessage builds the GELF document for a message.
+func newGELFMessage(host string, m message.Composer) map[string]interface{} {
+	out := map[string]interface{}{
+		"version":       gelfVersion,
+		"host":          host,
+		"short_message": m.String(),
+		"timestamp":     float64(time.Now().UnixNano()) / float64(time.Second),
+		"level":         syslogSeverity(m.Priority()),
+	}
+
+	frames, attrs := messageStack(m)
+	if len(frames) > 0 {
+		out["full_message"] = message.StackTrace{Frames: frames}.String()
+	}
+
+	for k, v := range attrs {
+		flattenGELFField(out, gelfFieldName(k), v)
+	}
+
+	return out
+}
+
+func flattenGELFField(out map[string]interface{}, key string, value interface{}) {
+	name := "_" + key
+	if name == "_id" {
+		// "_id" is reserved by Graylog.
+		name = "_id_"
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, nested := range v {
+			flattenGELFField(out, key+"_"+gelfFieldName(k), nested)
+		}
+	case json.Number, string:
+		out[name] = v
+	default:
+		// GELF only supports string and numeric values, so
+		// booleans and arrays are sent as their JSON form.
+		data, err := json.Marshal(v)
+		if err != nil {
+			data = []byte(fmt.Sprint(v))
+		}
+		out[name] = string(data)
+	}
+}
+
+// gelfFieldName replaces characters that are not allowed in GELF
+// additional field names with underscores.
+func gelfFieldName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// syslogSeverity maps priorities to syslog severity levels.
+func syslogSeverity(p level.Priority) int {
+	switch {
+	case p >= level.Emergency:
+		return 0
+	case p >= level.Alert:
+		return 1
+	case p >= level.Critical:
+		return 2
+	case p >= level.Error:
+		return 3
+	case p >= level.Warning:
+		return 4
+	case p >= level.Notice:
+		return 5
+	case p >= level.Info:
+		return 6
+	default:
+		return 7
+	}
+}
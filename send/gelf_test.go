@@ -0,0 +1,287 @@
+package send
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readGELFDatagram reads a GELF message from a UDP listener,
+// reassembling chunks and decompressing the payload.
+func readGELFDatagram(t *testing.T, conn net.PacketConn) map[string]interface{} {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var (
+		payload []byte
+		chunks  [][]byte
+		id      []byte
+	)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		data := append([]byte{}, buf[:n]...)
+
+		if !bytes.HasPrefix(data, gelfChunkMagic) {
+			payload = data
+			break
+		}
+
+		if id == nil {
+			id = data[2:10]
+			chunks = make([][]byte, data[11])
+		}
+		require.Equal(t, id, data[2:10])
+		chunks[data[10]] = data[gelfChunkHeaderSize:]
+
+		complete := true
+		for _, chunk := range chunks {
+			if chunk == nil {
+				complete = false
+			}
+		}
+		if complete {
+			payload = bytes.Join(chunks, nil)
+			break
+		}
+	}
+
+	return decodeGELFPayload(t, payload)
+}
+
+func decodeGELFPayload(t *testing.T, payload []byte) map[string]interface{} {
+	var r io.Reader = bytes.NewReader(payload)
+	switch {
+	case bytes.HasPrefix(payload, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		r = gz
+	case len(payload) > 0 && payload[0] == 0x78:
+		zr, err := zlib.NewReader(r)
+		require.NoError(t, err)
+		r = zr
+	}
+
+	out := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(r).Decode(&out))
+	return out
+}
+
+func TestGELFSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []GELFOptions{
+			{},
+			{Transport: GELFTransportUDP},
+			{Transport: "carrier-pigeon", Address: "localhost:12201"},
+			{Transport: GELFTransportTCP, Address: "localhost:12201", Compression: GELFCompressionGzip},
+			{Transport: GELFTransportUDP, Address: "localhost:12201", Compression: "lz4"},
+			{Transport: GELFTransportUDP, Address: "localhost:12201", ChunkSize: 10},
+		} {
+			s, err := MakeGELFSender(opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		s, err := NewGELFSender("app", GELFOptions{
+			Transport: GELFTransportUDP,
+			Address:   conn.LocalAddr().String(),
+			Host:      "example",
+		}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewFields(level.Error, message.Fields{
+			"message": "hello",
+			"id":      42,
+			"nested":  message.Fields{"key": "value", "ok": true},
+			"bad key": "x",
+		}))
+
+		msg := readGELFDatagram(t, conn)
+		assert.Equal(t, gelfVersion, msg["version"])
+		assert.Equal(t, "example", msg["host"])
+		assert.Contains(t, msg["short_message"], "hello")
+		assert.EqualValues(t, 3, msg["level"])
+		assert.NotZero(t, msg["timestamp"])
+		assert.EqualValues(t, 42, msg["_id_"])
+		assert.NotContains(t, msg, "_id")
+		assert.Equal(t, "value", msg["_nested_key"])
+		assert.Equal(t, "true", msg["_nested_ok"])
+		assert.Equal(t, "x", msg["_bad_key"])
+		assert.NotContains(t, msg, "_message")
+	})
+	t.Run("UDPChunkedAndCompressed", func(t *testing.T) {
+		for _, compression := range []GELFCompression{GELFCompressionNone, GELFCompressionGzip, GELFCompressionZlib} {
+			t.Run(string(compression), func(t *testing.T) {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer conn.Close()
+
+				s, err := NewGELFSender("app", GELFOptions{
+					Transport:   GELFTransportUDP,
+					Address:     conn.LocalAddr().String(),
+					Compression: compression,
+					ChunkSize:   minGELFChunkSize,
+				}, lvl)
+				require.NoError(t, err)
+				defer s.Close()
+
+				// Random-looking content so that compression
+				// does not fit it in one datagram.
+				var long strings.Builder
+				for i := 0; long.Len() < 4*minGELFChunkSize; i++ {
+					long.WriteString(time.Duration(i * 7919).String())
+				}
+				s.Send(t.Context(), message.NewDefaultMessage(level.Info, long.String()))
+
+				msg := readGELFDatagram(t, conn)
+				assert.Equal(t, long.String(), msg["short_message"])
+			})
+		}
+	})
+	t.Run("StackTraceIsFullMessage", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		s, err := NewGELFSender("app", GELFOptions{Transport: GELFTransportUDP, Address: conn.LocalAddr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.WrapStack(1, message.NewDefaultMessage(level.Info, "stacked")))
+		msg := readGELFDatagram(t, conn)
+		assert.Contains(t, msg["full_message"], "gelf_test.go")
+		assert.NotContains(t, msg, "_frames")
+
+		s.Send(t.Context(), message.WrapStack(1, message.NewFields(level.Error, message.Fields{"key": "value"})))
+		msg = readGELFDatagram(t, conn)
+		assert.Contains(t, msg["full_message"], "gelf_test.go")
+		assert.Equal(t, "value", msg["_key"])
+		assert.NotContains(t, msg, "_stack.frames")
+	})
+	t.Run("TCPReconnects", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		lines := make(chan string, 10)
+		accepted := make(chan net.Conn, 10)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn
+				go func() {
+					r := bufio.NewReader(conn)
+					for {
+						line, err := r.ReadString(0)
+						if err != nil {
+							return
+						}
+						lines <- strings.TrimSuffix(line, "\x00")
+					}
+				}()
+			}
+		}()
+
+		s, err := NewGELFSender("app", GELFOptions{Transport: GELFTransportTCP, Address: ln.Addr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+		var handled []error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = append(handled, err) }))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "one"))
+		msg := decodeGELFPayload(t, []byte(<-lines))
+		assert.Equal(t, "one", msg["short_message"])
+
+		// Drop the connection from the server side; the sender
+		// should reconnect without losing later messages.
+		(<-accepted).Close()
+		time.Sleep(10 * time.Millisecond)
+
+		for _, text := range []string{"two", "three"} {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, text))
+		}
+
+		received := []string{}
+		timeout := time.After(5 * time.Second)
+		for len(received) < 2 {
+			select {
+			case line := <-lines:
+				received = append(received, decodeGELFPayload(t, []byte(line))["short_message"].(string))
+			case <-timeout:
+				require.Fail(t, "timed out waiting for messages", "received %v", received)
+			}
+		}
+		assert.Contains(t, received, "three")
+		assert.Empty(t, handled)
+	})
+	t.Run("HTTP", func(t *testing.T) {
+		bodies := make(chan map[string]interface{}, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			bodies <- decodeGELFPayload(t, data)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer srv.Close()
+
+		s, err := NewGELFSender("app", GELFOptions{
+			Transport:        GELFTransportHTTP,
+			Address:          srv.URL + "/gelf",
+			Compression:      GELFCompressionGzip,
+			HTTPRetryOptions: HTTPRetryOptions{MinRetryDelay: time.Millisecond},
+		}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Warning, "warned"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+		))
+		msg := <-bodies
+		assert.Equal(t, "warned", msg["short_message"])
+		assert.EqualValues(t, 4, msg["level"])
+		assert.Empty(t, bodies)
+	})
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	for p, expected := range map[level.Priority]int{
+		level.Emergency: 0,
+		level.Alert:     1,
+		level.Critical:  2,
+		level.Error:     3,
+		level.Warning:   4,
+		level.Notice:    5,
+		level.Info:      6,
+		level.Debug:     7,
+		level.Trace:     7,
+	} {
+		assert.Equal(t, expected, syslogSeverity(p), p.String())
+	}
+}
@@ -0,0 +1,138 @@
+package send
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHTTPMaxRetries    = 3
+	defaultHTTPMinRetryDelay = 100 * time.Millisecond
+	defaultHTTPMaxRetryDelay = 30 * time.Second
+)
+
+// HTTPRetryOptions configures how HTTP-based senders retry requests
+// that fail with a server error (5xx) or are rate limited (429).
+type HTTPRetryOptions struct {
+	// MaxRetries is the number of times a request is retried
+	// after the initial attempt. Defaults to 3; set to a negative
+	// value to disable retries.
+	MaxRetries int `bson:"max_retries" json:"max_retries" yaml:"max_retries"`
+	// MinRetryDelay is the delay before the first retry, which
+	// doubles after every attempt. Defaults to 100 milliseconds.
+	MinRetryDelay time.Duration `bson:"min_retry_delay" json:"min_retry_delay" yaml:"min_retry_delay"`
+	// MaxRetryDelay caps the delay between retries, including
+	// delays requested by the server with a Retry-After
+	// header. Defaults to 30 seconds.
+	MaxRetryDelay time.Duration `bson:"max_retry_delay" json:"max_retry_delay" yaml:"max_retry_delay"`
+}
+
+func (opts *HTTPRetryOptions) validate() error {
+	if opts.MinRetryDelay < 0 {
+		return errors.New("minimum retry delay cannot be negative")
+	}
+	if opts.MaxRetryDelay < 0 {
+		return errors.New("maximum retry delay cannot be negative")
+	}
+
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultHTTPMaxRetries
+	} else if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.MinRetryDelay == 0 {
+		opts.MinRetryDelay = defaultHTTPMinRetryDelay
+	}
+	if opts.MaxRetryDelay == 0 {
+		opts.MaxRetryDelay = defaultHTTPMaxRetryDelay
+	}
+	if opts.MaxRetryDelay < opts.MinRetryDelay {
+		opts.MaxRetryDelay = opts.MinRetryDelay
+	}
+
+	return nil
+}
+
+// doHTTPWithRetry sends the request produced by makeRequest, retrying
+// on network errors, 5xx, and 429 responses. makeRequest is called
+// once per attempt so that the request body can be re-read. The
+// response of a successful request is returned to the caller, who is
+// responsible for closing its body; failed responses are converted to
+// errors using handleHTTPResponseError.
+func doHTTPWithRetry(ctx context.Context, client *http.Client, opts HTTPRetryOptions, makeRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	delay := opts.MinRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		req, err := makeRequest(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "building request")
+		}
+
+		resp, err := client.Do(req)
+		final := attempt >= opts.MaxRetries
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if final || ctx.Err() != nil {
+				return nil, errors.Wrap(err, "sending request")
+			}
+			wait = delay
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return resp, nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			if final {
+				return nil, handleHTTPResponseError(resp)
+			}
+			wait = retryAfter(resp.Header.Get("Retry-After"), delay)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		default:
+			return nil, handleHTTPResponseError(resp)
+		}
+
+		if wait > opts.MaxRetryDelay {
+			wait = opts.MaxRetryDelay
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "waiting to retry request")
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > opts.MaxRetryDelay {
+			delay = opts.MaxRetryDelay
+		}
+	}
+}
+
+// retryAfter parses the value of a Retry-After header, which is
+// either a number of seconds or an HTTP date, returning the fallback
+// when the header is missing or invalid.
+func retryAfter(header string, fallback time.Duration) time.Duration {
+	if header == "" {
+		return fallback
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if ts, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(ts); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	return fallback
+}
@@ -0,0 +1,355 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultJournaldSocket is the path of the socket of the
+	// native journal protocol.
+	DefaultJournaldSocket = "/run/systemd/journal/socket"
+	maxJournaldFieldName  = 64
+)
+
+// JournaldOptions configures the native journald protocol sender.
+type JournaldOptions struct {
+	// SocketPath is the path of the journald socket. Defaults to
+	// DefaultJournaldSocket.
+	SocketPath string `bson:"socket_path" json:"socket_path" yaml:"socket_path"`
+	// Fields are added to every entry, e.g. {"SERVICE": "api"}.
+	// Names are normalized in the same way as the names of message
+	// fields.
+	Fields map[string]string `bson:"fields" json:"fields" yaml:"fields"`
+}
+
+// Validate checks that the socket exists and populates defaults.
+func (opts *JournaldOptions) Validate() error {
+	if opts.SocketPath == "" {
+		opts.SocketPath = DefaultJournaldSocket
+	}
+
+	info, err := os.Stat(opts.SocketPath)
+	if err != nil {
+		return errors.Wrapf(err, "journald socket '%s' is not available", opts.SocketPath)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("'%s' is not a socket", opts.SocketPath)
+	}
+
+	return nil
+}
+
+type journaldSender struct {
+	opts JournaldOptions
+	addr *net.UnixAddr
+	mu   sync.Mutex
+	conn *net.UnixConn
+	*Base
+}
+
+// NewJournaldSender constructs a Sender that writes entries to the
+// systemd journal with the native journal protocol. See
+// MakeJournaldSender for more information.
+func NewJournaldSender(name string, opts JournaldOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeJournaldSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeJournaldSender constructs an unconfigured journald Sender. Pass
+// to Journaler.SetSender or call SetName before using.
+//
+// Unlike the senders from NewSystemdLogger, which only record the
+// string form of messages, this sender preserves the structure of
+// messages: each entry has the MESSAGE, PRIORITY and SYSLOG_IDENTIFIER
+// (the sender name) fields, the CODE_FILE, CODE_LINE and CODE_FUNC
+// fields for messages from the message.Stack composers, and a field
+// for each of the fields and annotations of the message. Field names
+// are upper case, with characters other than letters, digits and
+// underscores replaced by underscores, and nested fields are
+// flattened, so that {"a": {"b": 1}} becomes A_B=1. Fields whose
+// names are already in use, e.g. "a.b" and "a_b" or "priority", have
+// a suffix with a hash of the key, e.g. A_B_1C2D3E4F.
+//
+// Entries that are too large for a single datagram are written to a
+// sealed memfd, which is passed to journald over the socket.
+func MakeJournaldSender(opts JournaldOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid journald options")
+	}
+
+	s := &journaldSender{
+		opts: opts,
+		addr: &net.UnixAddr{Name: opts.SocketPath, Net: "unixgram"},
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	s.closer = func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.conn == nil {
+			return nil
+		}
+
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	return s, nil
+}
+
+func (s *journaldSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	name := s.Name()
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		if err := s.write(s.entry(name, c)); err != nil {
+			s.ErrorHandler()(ctx, err, c)
+		}
+	}
+}
+
+func (s *journaldSender) Flush(_ context.Context) error { return nil }
+
+// entry encodes a message in the native journal protocol.
+func (s *journaldSender) entry(name string, m message.Composer) []byte {
+	buf := &bytes.Buffer{}
+	seen := map[string]bool{}
+	add := func(name, value string) {
+		seen[name] = true
+		writeJournaldField(buf, name, value)
+	}
+
+	add("MESSAGE", m.String())
+	add("PRIORITY", strconv.Itoa(syslogSeverity(m.Priority())))
+	add("SYSLOG_IDENTIFIER", name)
+
+	frames, attrs := messageStack(m)
+	if len(frames) > 0 {
+		add("CODE_FILE", frames[0].File)
+		add("CODE_LINE", strconv.Itoa(frames[0].Line))
+		add("CODE_FUNC", frames[0].Function)
+	}
+
+	for _, key := range sortedKeys(s.opts.Fields) {
+		add(uniqueJournaldFieldName(key, seen), s.opts.Fields[key])
+	}
+
+	var fields []journaldField
+	for k, v := range attrs {
+		fields = flattenJournaldField(fields, k, v)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].key != fields[j].key {
+			return fields[i].key < fields[j].key
+		}
+		return fields[i].value < fields[j].value
+	})
+	for _, field := range fields {
+		add(uniqueJournaldFieldName(field.key, seen), field.value)
+	}
+
+	return buf.Bytes()
+}
+
+func (s *journaldSender) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+		if err != nil {
+			return errors.Wrap(err, "opening journald socket")
+		}
+		s.conn = conn
+	}
+
+	_, _, err := s.conn.WriteMsgUnix(data, nil, s.addr)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, unix.EMSGSIZE) && !errors.Is(err, unix.ENOBUFS) {
+		return errors.Wrap(err, "writing journal entry")
+	}
+
+	return errors.Wrap(s.writeMemfd(data), "writing large journal entry")
+}
+
+// writeMemfd passes an entry that is too large for a datagram to
+// journald as a sealed memfd.
+func (s *journaldSender) writeMemfd(data []byte) error {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return errors.Wrap(err, "creating memfd")
+	}
+
+	file := os.NewFile(uintptr(fd), "journal-entry")
+	defer file.Close()
+
+	if _, err = file.Write(data); err != nil {
+		return errors.Wrap(err, "writing memfd")
+	}
+	if _, err = unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return errors.Wrap(err, "sealing memfd")
+	}
+
+	_, _, err = s.conn.WriteMsgUnix(nil, unix.UnixRights(int(file.Fd())), s.addr)
+	return errors.Wrap(err, "passing memfd")
+}
+
+// writeJournaldField writes a field in the native journal protocol:
+// KEY=value for values without newlines, and otherwise the key, a
+// newline, the length of the value as a little endian 64 bit integer
+// and the value.
+func writeJournaldField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldField is an attribute of a message with its key, joined
+// with the keys of its parents for nested attributes.
+type journaldField struct {
+	key   string
+	value string
+}
+
+func flattenJournaldField(fields []journaldField, key string, value interface{}) []journaldField {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, nested := range v {
+			fields = flattenJournaldField(fields, key+"_"+k, nested)
+		}
+	case string:
+		fields = append(fields, journaldField{key: key, value: v})
+	case json.Number:
+		fields = append(fields, journaldField{key: key, value: v.String()})
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			data = []byte(fmt.Sprint(v))
+		}
+		fields = append(fields, journaldField{key: key, value: string(data)})
+	}
+	return fields
+}
+
+// journaldFieldName returns a valid journal field name for a key:
+// upper case letters, digits and underscores, not starting with an
+// underscore (which journald reserves for trusted fields) or a digit,
+// and at most 64 characters.
+func journaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "F_" + name
+	}
+	if len(name) > maxJournaldFieldName {
+		name = name[:maxJournaldFieldName]
+	}
+
+	return name
+}
+
+// uniqueJournaldFieldName returns the journal field name for a key (see
+// journaldFieldName) unless the name is already in use, because another
+// key has the same name after normalization or the name is one that
+// the sender sets. Then, so that the value is not lost, the name has a
+// suffix with a hash of the key.
+func uniqueJournaldFieldName(key string, seen map[string]bool) string {
+	name := journaldFieldName(key)
+	if name != "" && !seen[name] {
+		return name
+	}
+
+	base := name
+	if base == "" {
+		base = "F"
+	}
+	for attempt := 0; name == "" || seen[name]; attempt++ {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		if attempt > 0 {
+			fmt.Fprintf(h, "\x00%d", attempt)
+		}
+		suffix := fmt.Sprintf("_%08X", h.Sum32())
+		if len(base) > maxJournaldFieldName-len(suffix) {
+			base = base[:maxJournaldFieldName-len(suffix)]
+		}
+		name = base + suffix
+	}
+
+	return name
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
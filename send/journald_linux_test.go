@@ -0,0 +1,183 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newJournaldListener(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readJournalEntry reads an entry from the listener, following memfds,
+// and parses the native journal protocol.
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	require.NoError(t, err)
+	data := buf[:n]
+
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		require.NoError(t, err)
+		require.Len(t, fds, 1)
+
+		file := os.NewFile(uintptr(fds[0]), "memfd")
+		defer file.Close()
+		// The offset of the memfd is shared with the sender, which
+		// left it at the end of the entry.
+		_, err = file.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		data, err = io.ReadAll(file)
+		require.NoError(t, err)
+	}
+
+	out := map[string]string{}
+	for len(data) > 0 {
+		line := data[:bytes.IndexByte(data, '\n')]
+		if idx := bytes.IndexByte(line, '='); idx >= 0 {
+			out[string(line[:idx])] = string(line[idx+1:])
+			data = data[len(line)+1:]
+			continue
+		}
+
+		data = data[len(line)+1:]
+		size := binary.LittleEndian.Uint64(data[:8])
+		out[string(line)] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+
+	return out
+}
+
+func TestJournaldSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+
+	t.Run("MissingSocket", func(t *testing.T) {
+		s, err := MakeJournaldSender(JournaldOptions{SocketPath: filepath.Join(t.TempDir(), "missing")})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+	})
+	t.Run("StructuredFields", func(t *testing.T) {
+		conn := newJournaldListener(t)
+		s, err := NewJournaldSender("app", JournaldOptions{
+			SocketPath: conn.LocalAddr().String(),
+			Fields:     map[string]string{"service": "api"},
+		}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Warning, message.Fields{
+			"message":   "hello",
+			"user-id":   42,
+			"_trusted":  "x",
+			"nested":    message.Fields{"ok": true},
+			"multiline": "one\ntwo",
+			"priority":  "ignored",
+		}))
+
+		entry := readJournalEntry(t, conn)
+		assert.Equal(t, "4", entry["PRIORITY"])
+		assert.Equal(t, "app", entry["SYSLOG_IDENTIFIER"])
+		assert.Contains(t, entry["MESSAGE"], "hello")
+		assert.Equal(t, "api", entry["SERVICE"])
+		assert.Equal(t, "42", entry["USER_ID"])
+		assert.Equal(t, "x", entry["TRUSTED"])
+		assert.Equal(t, "true", entry["NESTED_OK"])
+		assert.Equal(t, "one\ntwo", entry["MULTILINE"])
+		assert.NotContains(t, entry, "_TRUSTED")
+		assert.Equal(t, "ignored", entry[uniqueJournaldFieldName("priority", map[string]bool{"PRIORITY": true})])
+	})
+	t.Run("CollidingFieldNames", func(t *testing.T) {
+		conn := newJournaldListener(t)
+		s, err := NewJournaldSender("app", JournaldOptions{SocketPath: conn.LocalAddr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Info, message.Fields{
+			"message": "hello",
+			"a.b":     "dots",
+			"a_b":     "underscores",
+			"A-B":     "dashes",
+			"a":       message.Fields{"b": "nested"},
+		}))
+
+		entry := readJournalEntry(t, conn)
+		values := []string{}
+		for name, value := range entry {
+			if strings.HasPrefix(name, "A_B") {
+				assert.Regexp(t, `^A_B(_[0-9A-F]{8})?$`, name)
+				values = append(values, value)
+			}
+		}
+		assert.ElementsMatch(t, []string{"dots", "underscores", "dashes", "nested"}, values)
+		assert.Equal(t, "dashes", entry["A_B"], "the first key in order keeps the name")
+	})
+	t.Run("CodeLocation", func(t *testing.T) {
+		conn := newJournaldListener(t)
+		s, err := NewJournaldSender("app", JournaldOptions{SocketPath: conn.LocalAddr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.WrapStack(1, message.NewFields(level.Error, message.Fields{"key": "value"})))
+
+		entry := readJournalEntry(t, conn)
+		assert.Equal(t, "3", entry["PRIORITY"])
+		assert.True(t, strings.HasSuffix(entry["CODE_FILE"], "journald_linux_test.go"), entry["CODE_FILE"])
+		assert.NotEmpty(t, entry["CODE_LINE"])
+		assert.Contains(t, entry["CODE_FUNC"], "TestJournaldSender")
+		assert.Equal(t, "value", entry["KEY"])
+		assert.NotContains(t, entry, "STACK_FRAMES")
+	})
+	t.Run("LargeEntryUsesMemfd", func(t *testing.T) {
+		conn := newJournaldListener(t)
+		s, err := NewJournaldSender("app", JournaldOptions{SocketPath: conn.LocalAddr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+		var handled error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = err }))
+
+		large := strings.Repeat("x", 1<<20)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, large))
+		require.NoError(t, handled)
+
+		entry := readJournalEntry(t, conn)
+		assert.Equal(t, large, entry["MESSAGE"])
+	})
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"simple":                 "SIMPLE",
+		"with.dots-and spaces":   "WITH_DOTS_AND_SPACES",
+		"__leading":              "LEADING",
+		"9lives":                 "F_9LIVES",
+		strings.Repeat("a", 100): strings.Repeat("A", maxJournaldFieldName),
+	} {
+		assert.Equal(t, expected, journaldFieldName(key))
+	}
+}
@@ -0,0 +1,376 @@
+package send
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	lokiPushPath = "/loki/api/v1/push"
+
+	// LokiSenderLabel is the label that the Loki sender uses for
+	// the name of the sender.
+	LokiSenderLabel = "sender"
+	// LokiLevelLabel is the label that the Loki sender uses for
+	// the priority of the message.
+	LokiLevelLabel = "level"
+)
+
+// lokiLabelName matches the label names that Loki accepts.
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiCompression describes how the Loki sender encodes push
+// requests.
+type LokiCompression string
+
+const (
+	// LokiCompressionNone sends uncompressed JSON push requests.
+	LokiCompressionNone LokiCompression = ""
+	// LokiCompressionGzip sends gzip-compressed JSON push requests.
+	LokiCompressionGzip LokiCompression = "gzip"
+	// LokiCompressionSnappy sends snappy-compressed protobuf push
+	// requests, which is the native encoding used by Loki's own
+	// clients.
+	LokiCompressionSnappy LokiCompression = "snappy"
+)
+
+// LokiOptions configures the Loki sender.
+type LokiOptions struct {
+	// URL is the base URL of the Loki server
+	// (e.g. "http://loki:3100"). The push API path is appended
+	// to the URL.
+	URL string `bson:"url" json:"url" yaml:"url"`
+	// TenantID, if set, is sent in the X-Scope-OrgID header for
+	// multi-tenant Loki deployments.
+	TenantID string `bson:"tenant_id" json:"tenant_id" yaml:"tenant_id"`
+	Username string `bson:"username" json:"username" yaml:"username"`
+	Password string `bson:"password" json:"password" yaml:"password" secret:"true"`
+
+	// Labels are added to every stream. Label names must match
+	// [a-zA-Z_][a-zA-Z0-9_]*.
+	Labels map[string]string `bson:"labels" json:"labels" yaml:"labels"`
+	// FieldLabels is the list of message.Fields keys that, when
+	// present in a message, are used as stream labels. Keep this
+	// list to low-cardinality values. The keys must be valid label
+	// names (see Labels).
+	FieldLabels []string `bson:"field_labels" json:"field_labels" yaml:"field_labels"`
+
+	Compression LokiCompression `bson:"compression" json:"compression" yaml:"compression"`
+
+	// Client is the HTTP client used for requests. Defaults to a
+	// client with a 10 second timeout.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+
+	HTTPRetryOptions `bson:"retry" json:"retry" yaml:"retry"`
+}
+
+// Validate checks the options for required values and populates
+// defaults.
+func (opts *LokiOptions) Validate() error {
+	catcher := []string{}
+	if opts.URL == "" {
+		catcher = append(catcher, "must specify a URL")
+	}
+	switch opts.Compression {
+	case LokiCompressionNone, LokiCompressionGzip, LokiCompressionSnappy:
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid compression '%s'", opts.Compression))
+	}
+	for name := range opts.Labels {
+		if !lokiLabelName.MatchString(name) {
+			catcher = append(catcher, fmt.Sprintf("invalid label name '%s'", name))
+		}
+	}
+	for _, name := range opts.FieldLabels {
+		if !lokiLabelName.MatchString(name) {
+			catcher = append(catcher, fmt.Sprintf("invalid field label name '%s'", name))
+		}
+	}
+	if err := opts.HTTPRetryOptions.validate(); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return nil
+}
+
+type lokiSender struct {
+	opts LokiOptions
+	*Base
+}
+
+// NewLokiSender constructs a Sender that writes messages directly to
+// the push API of a Grafana Loki server. See MakeLokiSender for more
+// information.
+func NewLokiSender(name string, opts LokiOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeLokiSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeLokiSender constructs an unconfigured Loki Sender. Pass to
+// Journaler.SetSender or call SetName before using.
+//
+// Each message is rendered using the sender's formatter and assigned
+// to a stream labeled with the sender's name, the message's priority,
+// the static labels from the options, and the values of any allowed
+// message.Fields keys. Entries have the time recorded in the message's
+// metadata, or the time they are sent. Groups of messages (e.g. from
+// NewBufferedSender) are sent in a single push request, with one
+// stream per distinct label set.
+func MakeLokiSender(opts LokiOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Loki options")
+	}
+
+	s := &lokiSender{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	return s, nil
+}
+
+type lokiEntry struct {
+	ts   time.Time
+	line string
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+func (s *lokiSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	streams := map[string]*lokiStream{}
+	order := []string{}
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		line, err := s.Formatter()(c)
+		if err != nil {
+			s.ErrorHandler()(ctx, errors.Wrap(err, "formatting message"), c)
+			continue
+		}
+
+		labels := s.labels(c)
+		key := lokiLabelString(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{labels: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		stream.entries = append(stream.entries, lokiEntry{ts: messageTime(c), line: line})
+	}
+
+	if len(order) == 0 {
+		return
+	}
+
+	batch := make([]*lokiStream, 0, len(order))
+	for _, key := range order {
+		batch = append(batch, streams[key])
+	}
+
+	if err := s.push(ctx, batch); err != nil {
+		s.ErrorHandler()(ctx, err, m)
+	}
+}
+
+func (s *lokiSender) Flush(_ context.Context) error { return nil }
+
+func (s *lokiSender) labels(m message.Composer) map[string]string {
+	labels := make(map[string]string, len(s.opts.Labels)+len(s.opts.FieldLabels)+2)
+	for k, v := range s.opts.Labels {
+		labels[k] = v
+	}
+
+	if len(s.opts.FieldLabels) > 0 {
+		var fields message.Fields
+		switch raw := m.Raw().(type) {
+		case message.Fields:
+			fields = raw
+		case map[string]interface{}:
+			fields = raw
+		}
+
+		for _, key := range s.opts.FieldLabels {
+			if v, ok := fields[key]; ok && v != nil {
+				labels[key] = fmt.Sprint(v)
+			}
+		}
+	}
+
+	labels[LokiSenderLabel] = s.Name()
+	labels[LokiLevelLabel] = m.Priority().String()
+
+	return labels
+}
+
+func (s *lokiSender) push(ctx context.Context, streams []*lokiStream) error {
+	var (
+		body     []byte
+		err      error
+		ctype    = "application/json"
+		encoding string
+	)
+
+	switch s.opts.Compression {
+	case LokiCompressionSnappy:
+		body = snappy.Encode(nil, lokiProtobuf(streams))
+		ctype = "application/x-protobuf"
+	case LokiCompressionGzip:
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		if err = json.NewEncoder(gz).Encode(lokiJSON(streams)); err != nil {
+			return errors.Wrap(err, "encoding push request")
+		}
+		if err = gz.Close(); err != nil {
+			return errors.Wrap(err, "compressing push request")
+		}
+		body = buf.Bytes()
+		encoding = "gzip"
+	default:
+		if body, err = json.Marshal(lokiJSON(streams)); err != nil {
+			return errors.Wrap(err, "encoding push request")
+		}
+	}
+
+	resp, err := doHTTPWithRetry(ctx, s.opts.Client, s.opts.HTTPRetryOptions, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.opts.URL, "/")+lokiPushPath, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", ctype)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		if s.opts.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", s.opts.TenantID)
+		}
+		if s.opts.Username != "" {
+			req.SetBasicAuth(s.opts.Username, s.opts.Password)
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "pushing to Loki")
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// lokiJSON builds the JSON form of a push request:
+//
+//	{"streams": [{"stream": {<labels>}, "values": [["<unix ns>", "<line>"], ...]}]}
+func lokiJSON(streams []*lokiStream) interface{} {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	out := struct {
+		Streams []stream `json:"streams"`
+	}{Streams: make([]stream, 0, len(streams))}
+
+	for _, s := range streams {
+		values := make([][2]string, 0, len(s.entries))
+		for _, e := range s.entries {
+			values = append(values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+		}
+		out.Streams = append(out.Streams, stream{Stream: s.labels, Values: values})
+	}
+
+	return out
+}
+
+// lokiProtobuf builds the protobuf form of a push request, as defined
+// by Loki's logproto.PushRequest message.
+func lokiProtobuf(streams []*lokiStream) []byte {
+	req := &protoBuffer{}
+	for _, s := range streams {
+		req.Message(1, func(stream *protoBuffer) {
+			stream.StringField(1, lokiLabelString(s.labels))
+			for _, e := range s.entries {
+				stream.Message(2, func(entry *protoBuffer) {
+					entry.Message(1, func(ts *protoBuffer) {
+						ts.Int64(1, e.ts.Unix())
+						ts.Int64(2, int64(e.ts.Nanosecond()))
+					})
+					entry.StringField(2, e.line)
+				})
+			}
+		})
+	}
+
+	return req.Bytes()
+}
+
+// lokiLabelString renders labels in the Prometheus label set format,
+// with the keys sorted, e.g. `{level="info", sender="app"}`.
+func lokiLabelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+strconv.Quote(labels[k]))
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
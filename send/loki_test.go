@@ -0,0 +1,237 @@
+package send
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+type lokiServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	headers  []http.Header
+	bodies   [][]byte
+	statuses []int
+}
+
+func newLokiServer(t *testing.T, statuses ...int) *lokiServer {
+	srv := &lokiServer{statuses: statuses}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.headers = append(srv.headers, r.Header)
+		srv.bodies = append(srv.bodies, data)
+
+		status := http.StatusNoContent
+		if len(srv.statuses) > 0 {
+			status = srv.statuses[0]
+			srv.statuses = srv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func (srv *lokiServer) pushes(t *testing.T) []lokiPushRequest {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	out := []lokiPushRequest{}
+	for _, body := range srv.bodies {
+		req := lokiPushRequest{}
+		require.NoError(t, json.Unmarshal(body, &req))
+		out = append(out, req)
+	}
+	return out
+}
+
+func TestLokiSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+	retry := HTTPRetryOptions{MinRetryDelay: time.Millisecond}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		s, err := MakeLokiSender(LokiOptions{})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+
+		s, err = MakeLokiSender(LokiOptions{URL: "http://localhost", Compression: "lz4"})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+
+		s, err = MakeLokiSender(LokiOptions{URL: "http://localhost", Labels: map[string]string{"app-name": "grip"}})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+
+		s, err = MakeLokiSender(LokiOptions{URL: "http://localhost", FieldLabels: []string{"request.id"}})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+
+		s, err = MakeLokiSender(LokiOptions{URL: "http://localhost", Labels: map[string]string{"_app": "grip"}, FieldLabels: []string{"request_id2"}})
+		assert.NoError(t, err)
+		assert.NotNil(t, s)
+	})
+	t.Run("PushesLabeledStream", func(t *testing.T) {
+		srv := newLokiServer(t)
+		s, err := NewLokiSender("app", LokiOptions{
+			URL:              srv.URL,
+			TenantID:         "tenant",
+			Labels:           map[string]string{"env": "test"},
+			FieldLabels:      []string{"service", "missing"},
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+		require.NoError(t, s.SetFormatter(MakeJSONFormatter()))
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Error, message.Fields{"service": "api", "id": 42}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "filtered"))
+
+		pushes := srv.pushes(t)
+		require.Len(t, pushes, 1)
+		require.Len(t, pushes[0].Streams, 1)
+		stream := pushes[0].Streams[0]
+		assert.Equal(t, map[string]string{
+			"env":           "test",
+			"service":       "api",
+			LokiSenderLabel: "app",
+			LokiLevelLabel:  "error",
+		}, stream.Stream)
+		require.Len(t, stream.Values, 1)
+		assert.JSONEq(t, `{"service": "api", "id": 42}`, stream.Values[0][1])
+		assert.Equal(t, "tenant", srv.headers[0].Get("X-Scope-OrgID"))
+	})
+	t.Run("UsesMessageTime", func(t *testing.T) {
+		srv := newLokiServer(t)
+		s, err := NewLokiSender("app", LokiOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		ts := time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)
+		m := message.NewFields(level.Info, message.Fields{"id": 1})
+		m.Raw().(message.Fields)["metadata"].(*message.Base).Time = ts
+		s.Send(t.Context(), m)
+
+		before := time.Now()
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "no metadata"))
+
+		pushes := srv.pushes(t)
+		require.Len(t, pushes, 2)
+		require.Len(t, pushes[0].Streams, 1)
+		require.Len(t, pushes[0].Streams[0].Values, 1)
+		assert.Equal(t, strconv.FormatInt(ts.UnixNano(), 10), pushes[0].Streams[0].Values[0][0])
+
+		require.Len(t, pushes[1].Streams, 1)
+		require.Len(t, pushes[1].Streams[0].Values, 1)
+		nanos, err := strconv.ParseInt(pushes[1].Streams[0].Values[0][0], 10, 64)
+		require.NoError(t, err)
+		assert.False(t, time.Unix(0, nanos).Before(before), "messages without a time are sent with the current time")
+	})
+	t.Run("BatchesGroupsByLabelSet", func(t *testing.T) {
+		srv := newLokiServer(t)
+		s, err := NewLokiSender("app", LokiOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Error, "two"),
+			message.NewDefaultMessage(level.Info, "three"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+		))
+
+		pushes := srv.pushes(t)
+		require.Len(t, pushes, 1)
+		require.Len(t, pushes[0].Streams, 2)
+		assert.Equal(t, "info", pushes[0].Streams[0].Stream[LokiLevelLabel])
+		require.Len(t, pushes[0].Streams[0].Values, 2)
+		assert.Equal(t, "one", pushes[0].Streams[0].Values[0][1])
+		assert.Equal(t, "three", pushes[0].Streams[0].Values[1][1])
+		assert.Equal(t, "error", pushes[0].Streams[1].Stream[LokiLevelLabel])
+		require.Len(t, pushes[0].Streams[1].Values, 1)
+		assert.Equal(t, "two", pushes[0].Streams[1].Values[0][1])
+	})
+	t.Run("Gzip", func(t *testing.T) {
+		srv := newLokiServer(t)
+		s, err := NewLokiSender("app", LokiOptions{URL: srv.URL, Compression: LokiCompressionGzip, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "compressed"))
+
+		pushes := srv.pushes(t)
+		require.Len(t, pushes, 1)
+		assert.Equal(t, "gzip", srv.headers[0].Get("Content-Encoding"))
+		assert.Equal(t, "compressed", pushes[0].Streams[0].Values[0][1])
+	})
+	t.Run("SnappyProtobuf", func(t *testing.T) {
+		srv := newLokiServer(t)
+		s, err := NewLokiSender("app", LokiOptions{URL: srv.URL, Compression: LokiCompressionSnappy, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "compressed"))
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		require.Len(t, srv.bodies, 1)
+		assert.Equal(t, "application/x-protobuf", srv.headers[0].Get("Content-Type"))
+		data, err := snappy.Decode(nil, srv.bodies[0])
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `{level="info", sender="app"}`)
+		assert.Contains(t, string(data), "compressed")
+	})
+	t.Run("ReportsErrors", func(t *testing.T) {
+		srv := newLokiServer(t, http.StatusBadRequest)
+		s, err := NewLokiSender("app", LokiOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+		var handled error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = err }))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "rejected"))
+		assert.Error(t, handled)
+	})
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	ts := time.Unix(1, 2)
+	out := lokiProtobuf([]*lokiStream{{
+		labels:  map[string]string{"a": "b"},
+		entries: []lokiEntry{{ts: ts, line: "x"}},
+	}})
+
+	assert.Equal(t, []byte{
+		0x0a, 0x14, // streams
+		0x0a, 0x07, '{', 'a', '=', '"', 'b', '"', '}', // labels
+		0x12, 0x09, // entries
+		0x0a, 0x04, 0x08, 0x01, 0x10, 0x02, // timestamp
+		0x12, 0x01, 'x', // line
+	}, out)
+}
@@ -0,0 +1,268 @@
+package send
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// msgpackBuffer is a minimal MessagePack encoder, used by senders that
+// speak MessagePack-based wire protocols. It encodes the values
+// produced by decoding JSON with UseNumber, which is how senders
+// normalize the Raw form of messages.
+type msgpackBuffer struct {
+	buf []byte
+}
+
+func (p *msgpackBuffer) Bytes() []byte { return p.buf }
+
+func (p *msgpackBuffer) Nil() { p.buf = append(p.buf, 0xc0) }
+
+func (p *msgpackBuffer) Bool(v bool) {
+	if v {
+		p.buf = append(p.buf, 0xc3)
+	} else {
+		p.buf = append(p.buf, 0xc2)
+	}
+}
+
+func (p *msgpackBuffer) Int(v int64) {
+	switch {
+	case v >= 0:
+		p.Uint(uint64(v))
+	case v >= -32:
+		p.buf = append(p.buf, byte(v))
+	case v >= math.MinInt8:
+		p.buf = append(p.buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xd2), uint32(v))
+	default:
+		p.buf = binary.BigEndian.AppendUint64(append(p.buf, 0xd3), uint64(v))
+	}
+}
+
+func (p *msgpackBuffer) Uint(v uint64) {
+	switch {
+	case v < 128:
+		p.buf = append(p.buf, byte(v))
+	case v <= math.MaxUint8:
+		p.buf = append(p.buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xce), uint32(v))
+	default:
+		p.buf = binary.BigEndian.AppendUint64(append(p.buf, 0xcf), v)
+	}
+}
+
+func (p *msgpackBuffer) Float(v float64) {
+	p.buf = binary.BigEndian.AppendUint64(append(p.buf, 0xcb), math.Float64bits(v))
+}
+
+func (p *msgpackBuffer) String(v string) {
+	n := len(v)
+	switch {
+	case n < 32:
+		p.buf = append(p.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		p.buf = append(p.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xda), uint16(n))
+	default:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xdb), uint32(n))
+	}
+	p.buf = append(p.buf, v...)
+}
+
+func (p *msgpackBuffer) Binary(v []byte) {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		p.buf = append(p.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xc5), uint16(n))
+	default:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xc6), uint32(n))
+	}
+	p.buf = append(p.buf, v...)
+}
+
+func (p *msgpackBuffer) ArrayHeader(n int) {
+	switch {
+	case n < 16:
+		p.buf = append(p.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xdc), uint16(n))
+	default:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xdd), uint32(n))
+	}
+}
+
+func (p *msgpackBuffer) MapHeader(n int) {
+	switch {
+	case n < 16:
+		p.buf = append(p.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		p.buf = binary.BigEndian.AppendUint16(append(p.buf, 0xde), uint16(n))
+	default:
+		p.buf = binary.BigEndian.AppendUint32(append(p.buf, 0xdf), uint32(n))
+	}
+}
+
+// EventTime encodes a timestamp as the Fluent EventTime extension type
+// (type 0): seconds and nanoseconds as big endian 32 bit integers.
+func (p *msgpackBuffer) EventTime(ts time.Time) {
+	p.buf = append(p.buf, 0xd7, 0x00)
+	p.buf = binary.BigEndian.AppendUint32(p.buf, uint32(ts.Unix()))
+	p.buf = binary.BigEndian.AppendUint32(p.buf, uint32(ts.Nanosecond()))
+}
+
+// Value encodes a JSON-normalized value. Map keys are sorted so that
+// the output is deterministic.
+func (p *msgpackBuffer) Value(v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		p.Nil()
+	case bool:
+		p.Bool(val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			p.Int(i)
+		} else if f, err := val.Float64(); err == nil {
+			p.Float(f)
+		} else {
+			p.String(val.String())
+		}
+	case string:
+		p.String(val)
+	case []interface{}:
+		p.ArrayHeader(len(val))
+		for _, elem := range val {
+			p.Value(elem)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		p.MapHeader(len(val))
+		for _, k := range keys {
+			p.String(k)
+			p.Value(val[k])
+		}
+	default:
+		p.String(fmt.Sprint(val))
+	}
+}
+
+const (
+	// maxMsgpackReadEntries and maxMsgpackReadString bound the
+	// size of the maps that readMsgpackStringMap accepts, which
+	// only need to hold acknowledgments, so that a misbehaving
+	// server cannot make the sender allocate large buffers.
+	maxMsgpackReadEntries = 16
+	maxMsgpackReadString  = 1024
+)
+
+// readMsgpackStringMap decodes a MessagePack map with string keys and
+// string values, such as the acknowledgments of the Fluent forward
+// protocol. Values of other types, and maps or strings that are larger
+// than acknowledgments, are errors.
+func readMsgpackStringMap(r *bufio.Reader) (map[string]string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n uint64
+	switch {
+	case b&0xf0 == 0x80:
+		n = uint64(b & 0x0f)
+	case b == 0xde:
+		n, err = readMsgpackUint(r, 2)
+	case b == 0xdf:
+		n, err = readMsgpackUint(r, 4)
+	default:
+		return nil, errors.Errorf("expected a MessagePack map, got type 0x%02x", b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n > maxMsgpackReadEntries {
+		return nil, errors.Errorf("MessagePack map has %d entries, more than the limit of %d", n, maxMsgpackReadEntries)
+	}
+
+	out := make(map[string]string, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading map key")
+		}
+		value, err := readMsgpackString(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading value of '%s'", key)
+		}
+		out[key] = value
+	}
+
+	return out, nil
+}
+
+func readMsgpackString(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var n uint64
+	switch {
+	case b&0xe0 == 0xa0:
+		n = uint64(b & 0x1f)
+	case b == 0xd9 || b == 0xc4:
+		n, err = readMsgpackUint(r, 1)
+	case b == 0xda || b == 0xc5:
+		n, err = readMsgpackUint(r, 2)
+	case b == 0xdb || b == 0xc6:
+		n, err = readMsgpackUint(r, 4)
+	default:
+		return "", errors.Errorf("expected a MessagePack string, got type 0x%02x", b)
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > maxMsgpackReadString {
+		return "", errors.Errorf("MessagePack string is %d bytes long, more than the limit of %d", n, maxMsgpackReadString)
+	}
+
+	data := make([]byte, n)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, err
+	}
+
+	var out uint64
+	for _, b := range data {
+		out = out<<8 | uint64(b)
+	}
+	return out, nil
+}
@@ -0,0 +1,578 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	otlpLogsPath = "/v1/logs"
+
+	defaultOTLPBatchSize     = 512
+	defaultOTLPFlushInterval = 5 * time.Second
+)
+
+// OTLPEncoding describes the encoding of OTLP/HTTP requests.
+type OTLPEncoding string
+
+const (
+	// OTLPEncodingProtobuf sends binary protobuf requests.
+	OTLPEncodingProtobuf OTLPEncoding = "protobuf"
+	// OTLPEncodingJSON sends JSON requests, using the OTLP/JSON
+	// mapping of the protobuf messages.
+	OTLPEncodingJSON OTLPEncoding = "json"
+)
+
+// OTLPLogOptions configures the OTLP logs exporter sender.
+type OTLPLogOptions struct {
+	// Endpoint is the base URL of the collector
+	// (e.g. "http://otel-collector:4318"). The logs signal path,
+	// "/v1/logs", is appended to the endpoint.
+	Endpoint string `bson:"endpoint" json:"endpoint" yaml:"endpoint"`
+	// Headers are added to every request, and are typically used
+	// for authentication.
+	Headers map[string]string `bson:"headers" json:"headers" yaml:"headers" secret:"true"`
+	// Encoding defaults to protobuf.
+	Encoding OTLPEncoding `bson:"encoding" json:"encoding" yaml:"encoding"`
+
+	// ServiceName is the value of the service.name resource
+	// attribute. Defaults to the name of the sender.
+	ServiceName string `bson:"service_name" json:"service_name" yaml:"service_name"`
+	// HostName is the value of the host.name resource
+	// attribute. Defaults to the hostname of the system.
+	HostName string `bson:"host_name" json:"host_name" yaml:"host_name"`
+	// ResourceAttributes are added to the resource describing the
+	// source of the logs.
+	ResourceAttributes map[string]string `bson:"resource_attributes" json:"resource_attributes" yaml:"resource_attributes"`
+
+	// BatchSize is the number of log records buffered before the
+	// sender exports them. Defaults to 512.
+	BatchSize int `bson:"batch_size" json:"batch_size" yaml:"batch_size"`
+	// FlushInterval is the maximum duration that log records are
+	// buffered before the sender exports them. Defaults to 5
+	// seconds.
+	FlushInterval time.Duration `bson:"flush_interval" json:"flush_interval" yaml:"flush_interval"`
+
+	// Client is the HTTP client used for requests. Defaults to a
+	// client with a 10 second timeout.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+
+	HTTPRetryOptions `bson:"retry" json:"retry" yaml:"retry"`
+}
+
+// Validate checks the options for required values and populates
+// defaults.
+func (opts *OTLPLogOptions) Validate() error {
+	catcher := []string{}
+	if opts.Endpoint == "" {
+		catcher = append(catcher, "must specify an endpoint")
+	}
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = OTLPEncodingProtobuf
+	case OTLPEncodingProtobuf, OTLPEncodingJSON:
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid encoding '%s'", opts.Encoding))
+	}
+	if opts.BatchSize < 0 {
+		catcher = append(catcher, "batch size cannot be negative")
+	}
+	if opts.FlushInterval < 0 {
+		catcher = append(catcher, "flush interval cannot be negative")
+	}
+	if err := opts.HTTPRetryOptions.validate(); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultOTLPBatchSize
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = defaultOTLPFlushInterval
+	}
+	if opts.HostName == "" {
+		opts.HostName, _ = os.Hostname()
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return nil
+}
+
+type otlpLogSender struct {
+	opts      OTLPLogOptions
+	mu        sync.Mutex
+	records   []otlpLogRecord
+	msgs      []message.Composer
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeErr  error
+	closeOnce sync.Once
+	*Base
+}
+
+// NewOTLPLogSender constructs a Sender that exports messages as
+// OpenTelemetry log records to a collector using OTLP/HTTP. See
+// MakeOTLPLogSender for more information.
+func NewOTLPLogSender(name string, opts OTLPLogOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeOTLPLogSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeOTLPLogSender constructs an unconfigured OTLP log Sender. Pass
+// to Journaler.SetSender or call SetName before using.
+//
+// Each message is converted to a log record with a severity based on
+// the message's priority, a body from the message's String method,
+// and attributes from the message's fields and annotations. When the
+// context passed to Send carries a valid span, the record is
+// correlated with its trace and span IDs. Records are buffered and
+// exported in batches; call Flush to export buffered records
+// immediately. Closing the sender exports any buffered records.
+func MakeOTLPLogSender(opts OTLPLogOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid OTLP options")
+	}
+
+	s := &otlpLogSender{
+		opts: opts,
+		done: make(chan struct{}),
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	s.wg.Add(1)
+	go s.intervalFlush()
+
+	return s, nil
+}
+
+// Close stops the background flush and exports any buffered
+// records. Close is implemented here rather than with the Base's
+// closer so that export errors can reach the error handler.
+func (s *otlpLogSender) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		s.closeErr = s.Flush(context.Background())
+	})
+
+	return s.closeErr
+}
+
+func (s *otlpLogSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	sc := trace.SpanContextFromContext(ctx)
+	now := time.Now()
+
+	s.mu.Lock()
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		s.records = append(s.records, newOTLPLogRecord(now, c, sc))
+		s.msgs = append(s.msgs, c)
+	}
+	full := len(s.records) >= s.opts.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		_ = s.Flush(ctx)
+	}
+}
+
+// Flush exports all buffered log records. Export errors are passed
+// to the error handler, along with the records' messages, and
+// returned.
+func (s *otlpLogSender) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	records, msgs := s.records, s.msgs
+	s.records, s.msgs = nil, nil
+	s.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	err := s.export(ctx, records)
+	if err != nil {
+		s.ErrorHandler()(ctx, err, message.NewGroupComposer(msgs))
+	}
+
+	return err
+}
+
+func (s *otlpLogSender) intervalFlush() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			_ = s.Flush(context.Background())
+		}
+	}
+}
+
+func (s *otlpLogSender) resource() []otlpKeyValue {
+	attrs := make([]otlpKeyValue, 0, len(s.opts.ResourceAttributes)+2)
+
+	serviceName := s.opts.ServiceName
+	if serviceName == "" {
+		serviceName = s.Name()
+	}
+	attrs = append(attrs, otlpKeyValue{Key: "service.name", Value: serviceName})
+	if s.opts.HostName != "" {
+		attrs = append(attrs, otlpKeyValue{Key: "host.name", Value: s.opts.HostName})
+	}
+
+	keys := make([]string, 0, len(s.opts.ResourceAttributes))
+	for k := range s.opts.ResourceAttributes {
+		if k == "service.name" || k == "host.name" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: s.opts.ResourceAttributes[k]})
+	}
+
+	return attrs
+}
+
+func (s *otlpLogSender) export(ctx context.Context, records []otlpLogRecord) error {
+	var (
+		body  []byte
+		err   error
+		ctype string
+	)
+
+	resource := s.resource()
+	switch s.opts.Encoding {
+	case OTLPEncodingJSON:
+		ctype = "application/json"
+		if body, err = json.Marshal(otlpJSONRequest(resource, records)); err != nil {
+			return errors.Wrap(err, "encoding export request")
+		}
+	default:
+		ctype = "application/x-protobuf"
+		body = otlpProtobufRequest(resource, records)
+	}
+
+	resp, err := doHTTPWithRetry(ctx, s.opts.Client, s.opts.HTTPRetryOptions, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.opts.Endpoint, "/")+otlpLogsPath, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", ctype)
+		for k, v := range s.opts.Headers {
+			req.Header.Set(k, v)
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "exporting log records")
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// conversion of messages to log records
+//
+////////////////////////////////////////////////////////////////////////
+
+type otlpLogRecord struct {
+	Time           time.Time
+	SeverityNumber int
+	SeverityText   string
+	Body           string
+	Attributes     []otlpKeyValue
+	TraceID        trace.TraceID
+	SpanID         trace.SpanID
+	Flags          trace.TraceFlags
+}
+
+type otlpKeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+func newOTLPLogRecord(ts time.Time, m message.Composer, sc trace.SpanContext) otlpLogRecord {
+	r := otlpLogRecord{
+		Time:           ts,
+		SeverityNumber: otlpSeverity(m.Priority()),
+		SeverityText:   strings.ToUpper(m.Priority().String()),
+		Body:           m.String(),
+		Attributes:     otlpAttributes(m),
+	}
+
+	if sc.IsValid() {
+		r.TraceID = sc.TraceID()
+		r.SpanID = sc.SpanID()
+		r.Flags = sc.TraceFlags()
+	}
+
+	return r
+}
+
+// otlpSeverity maps priorities to OpenTelemetry severity numbers.
+func otlpSeverity(p level.Priority) int {
+	switch {
+	case p >= level.Emergency:
+		return 23 // FATAL3
+	case p >= level.Alert:
+		return 22 // FATAL2
+	case p >= level.Critical:
+		return 21 // FATAL
+	case p >= level.Error:
+		return 17 // ERROR
+	case p >= level.Warning:
+		return 13 // WARN
+	case p >= level.Notice:
+		return 10 // INFO2
+	case p >= level.Info:
+		return 9 // INFO
+	case p >= level.Debug:
+		return 5 // DEBUG
+	case p >= level.Trace:
+		return 1 // TRACE
+	default:
+		return 0 // UNSPECIFIED
+	}
+}
+
+// otlpAttributes produces the attributes of a log record from the
+// structured form of a message.
+func otlpAttributes(m message.Composer) []otlpKeyValue {
+	return otlpKeyValues(messageAttributes(m))
+}
+
+func otlpKeyValues(in map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		if in[k] == nil {
+			continue
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: in[k]})
+	}
+
+	return out
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// OTLP/JSON encoding
+//
+////////////////////////////////////////////////////////////////////////
+
+func otlpJSONRequest(resource []otlpKeyValue, records []otlpLogRecord) interface{} {
+	logRecords := make([]map[string]interface{}, 0, len(records))
+	for _, r := range records {
+		rec := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(r.Time.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(r.Time.UnixNano(), 10),
+			"severityNumber":       r.SeverityNumber,
+			"severityText":         r.SeverityText,
+			"body":                 otlpJSONValue(r.Body),
+			"attributes":           otlpJSONKeyValues(r.Attributes),
+		}
+		if r.TraceID.IsValid() {
+			rec["traceId"] = hex.EncodeToString(r.TraceID[:])
+			rec["spanId"] = hex.EncodeToString(r.SpanID[:])
+			rec["flags"] = int(r.Flags)
+		}
+		logRecords = append(logRecords, rec)
+	}
+
+	return map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpJSONKeyValues(resource),
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]interface{}{"name": packageName},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpJSONKeyValues(kvs []otlpKeyValue) []interface{} {
+	out := make([]interface{}, 0, len(kvs))
+	for _, kv := range kvs {
+		out = append(out, map[string]interface{}{"key": kv.Key, "value": otlpJSONValue(kv.Value)})
+	}
+
+	return out
+}
+
+func otlpJSONValue(v interface{}) map[string]interface{} {
+	switch val := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": val}
+	case bool:
+		return map[string]interface{}{"boolValue": val}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return map[string]interface{}{"intValue": strconv.FormatInt(i, 10)}
+		}
+		f, _ := val.Float64()
+		return map[string]interface{}{"doubleValue": f}
+	case []interface{}:
+		values := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			values = append(values, otlpJSONValue(item))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case map[string]interface{}:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": otlpJSONKeyValues(otlpKeyValues(val))}}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(val)}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// OTLP/protobuf encoding
+//
+////////////////////////////////////////////////////////////////////////
+
+// otlpProtobufRequest encodes an ExportLogsServiceRequest message.
+func otlpProtobufRequest(resource []otlpKeyValue, records []otlpLogRecord) []byte {
+	req := &protoBuffer{}
+	req.Message(1, func(rl *protoBuffer) { // ResourceLogs
+		rl.Message(1, func(res *protoBuffer) { // Resource
+			for _, kv := range resource {
+				res.Message(1, func(p *protoBuffer) { otlpProtobufKeyValue(p, kv) })
+			}
+		})
+		rl.Message(2, func(sl *protoBuffer) { // ScopeLogs
+			sl.Message(1, func(scope *protoBuffer) { scope.StringField(1, packageName) })
+			for _, r := range records {
+				sl.Message(2, func(lr *protoBuffer) { otlpProtobufLogRecord(lr, r) })
+			}
+		})
+	})
+
+	return req.Bytes()
+}
+
+func otlpProtobufLogRecord(p *protoBuffer, r otlpLogRecord) {
+	p.Fixed64(1, uint64(r.Time.UnixNano()))
+	p.Int64(2, int64(r.SeverityNumber))
+	p.StringField(3, r.SeverityText)
+	p.Message(5, func(body *protoBuffer) { otlpProtobufValue(body, r.Body) })
+	for _, kv := range r.Attributes {
+		p.Message(6, func(attr *protoBuffer) { otlpProtobufKeyValue(attr, kv) })
+	}
+	p.Fixed32(8, uint32(r.Flags))
+	if r.TraceID.IsValid() {
+		p.BytesField(9, r.TraceID[:])
+		p.BytesField(10, r.SpanID[:])
+	}
+	p.Fixed64(11, uint64(r.Time.UnixNano()))
+}
+
+func otlpProtobufKeyValue(p *protoBuffer, kv otlpKeyValue) {
+	p.StringField(1, kv.Key)
+	p.Message(2, func(v *protoBuffer) { otlpProtobufValue(v, kv.Value) })
+}
+
+func otlpProtobufValue(p *protoBuffer, v interface{}) {
+	switch val := v.(type) {
+	case string:
+		p.OneofString(1, val)
+	case bool:
+		if val {
+			p.OneofUint64(2, 1)
+		} else {
+			p.OneofUint64(2, 0)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			p.OneofUint64(3, uint64(i))
+			return
+		}
+		f, _ := val.Float64()
+		p.OneofDouble(4, f)
+	case []interface{}:
+		p.Message(5, func(arr *protoBuffer) {
+			for _, item := range val {
+				arr.Message(1, func(iv *protoBuffer) { otlpProtobufValue(iv, item) })
+			}
+		})
+	case map[string]interface{}:
+		p.Message(6, func(kvl *protoBuffer) {
+			for _, kv := range otlpKeyValues(val) {
+				kvl.Message(1, func(item *protoBuffer) { otlpProtobufKeyValue(item, kv) })
+			}
+		})
+	default:
+		p.OneofString(1, fmt.Sprint(val))
+	}
+}
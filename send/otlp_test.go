@@ -0,0 +1,243 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type otlpServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	headers []http.Header
+	bodies  [][]byte
+}
+
+func newOTLPServer(t *testing.T) *otlpServer {
+	srv := &otlpServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlpLogsPath, r.URL.Path)
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.headers = append(srv.headers, r.Header)
+		srv.bodies = append(srv.bodies, data)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func (srv *otlpServer) count() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.bodies)
+}
+
+type otlpJSONExport struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpJSONAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano   string                 `json:"timeUnixNano"`
+				SeverityNumber int                    `json:"severityNumber"`
+				SeverityText   string                 `json:"severityText"`
+				Body           map[string]interface{} `json:"body"`
+				Attributes     []otlpJSONAttribute    `json:"attributes"`
+				TraceID        string                 `json:"traceId"`
+				SpanID         string                 `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpJSONAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpJSONAttributeMap(attrs []otlpJSONAttribute) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	for _, attr := range attrs {
+		out[attr.Key] = attr.Value
+	}
+	return out
+}
+
+func TestOTLPLogSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+	retry := HTTPRetryOptions{MinRetryDelay: time.Millisecond}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]OTLPLogOptions{
+			"MissingEndpoint":  {},
+			"InvalidEncoding":  {Endpoint: "http://localhost", Encoding: "xml"},
+			"NegativeBatch":    {Endpoint: "http://localhost", BatchSize: -1},
+			"NegativeInterval": {Endpoint: "http://localhost", FlushInterval: -1},
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := MakeOTLPLogSender(opts)
+				assert.Error(t, err)
+				assert.Nil(t, s)
+			})
+		}
+	})
+	t.Run("ExportsJSON", func(t *testing.T) {
+		srv := newOTLPServer(t)
+		s, err := NewOTLPLogSender("svc", OTLPLogOptions{
+			Endpoint:           srv.URL,
+			Encoding:           OTLPEncodingJSON,
+			HostName:           "host0",
+			Headers:            map[string]string{"Authorization": "Bearer token"},
+			ResourceAttributes: map[string]string{"deployment.environment": "test"},
+			HTTPRetryOptions:   retry,
+		}, lvl)
+		require.NoError(t, err)
+
+		tid, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		require.NoError(t, err)
+		sid, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+		require.NoError(t, err)
+		ctx := trace.ContextWithSpanContext(t.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    tid,
+			SpanID:     sid,
+			TraceFlags: trace.FlagsSampled,
+		}))
+
+		msg := message.NewSimpleFieldsMessage(level.Error, "failed", message.Fields{"count": 2, "ok": false, "nested": map[string]interface{}{"a": 1.5}})
+		s.Send(ctx, msg)
+		annotated := message.NewDefaultMessage(level.Notice, "annotated")
+		require.NoError(t, annotated.Annotate("request", "r1"))
+		s.Send(t.Context(), annotated)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "filtered"))
+
+		assert.Zero(t, srv.count())
+		require.NoError(t, s.Flush(t.Context()))
+		require.Equal(t, 1, srv.count())
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Equal(t, "Bearer token", srv.headers[0].Get("Authorization"))
+		assert.Equal(t, "application/json", srv.headers[0].Get("Content-Type"))
+
+		out := otlpJSONExport{}
+		require.NoError(t, json.Unmarshal(srv.bodies[0], &out))
+		require.Len(t, out.ResourceLogs, 1)
+		resource := otlpJSONAttributeMap(out.ResourceLogs[0].Resource.Attributes)
+		assert.Equal(t, "svc", resource["service.name"]["stringValue"])
+		assert.Equal(t, "host0", resource["host.name"]["stringValue"])
+		assert.Equal(t, "test", resource["deployment.environment"]["stringValue"])
+
+		require.Len(t, out.ResourceLogs[0].ScopeLogs, 1)
+		assert.Equal(t, packageName, out.ResourceLogs[0].ScopeLogs[0].Scope.Name)
+		records := out.ResourceLogs[0].ScopeLogs[0].LogRecords
+		require.Len(t, records, 2)
+
+		assert.Equal(t, 17, records[0].SeverityNumber)
+		assert.Equal(t, "ERROR", records[0].SeverityText)
+		assert.Equal(t, msg.String(), records[0].Body["stringValue"])
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", records[0].TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", records[0].SpanID)
+		assert.NotEmpty(t, records[0].TimeUnixNano)
+		attrs := otlpJSONAttributeMap(records[0].Attributes)
+		assert.Equal(t, "2", attrs["count"]["intValue"])
+		assert.Equal(t, false, attrs["ok"]["boolValue"])
+		assert.Contains(t, attrs["nested"], "kvlistValue")
+		assert.NotContains(t, attrs, message.FieldsMsgName)
+
+		assert.Equal(t, 10, records[1].SeverityNumber)
+		assert.Empty(t, records[1].TraceID)
+		attrs = otlpJSONAttributeMap(records[1].Attributes)
+		assert.Equal(t, "r1", attrs["request"]["stringValue"])
+	})
+	t.Run("ExportsProtobufWhenBatchIsFull", func(t *testing.T) {
+		srv := newOTLPServer(t)
+		s, err := NewOTLPLogSender("svc", OTLPLogOptions{Endpoint: srv.URL, BatchSize: 2, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Info, "two"),
+		))
+		require.Equal(t, 1, srv.count())
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Equal(t, "application/x-protobuf", srv.headers[0].Get("Content-Type"))
+		assert.Contains(t, string(srv.bodies[0]), "one")
+		assert.Contains(t, string(srv.bodies[0]), "two")
+		assert.Contains(t, string(srv.bodies[0]), "service.name")
+	})
+	t.Run("ExportsOnIntervalAndClose", func(t *testing.T) {
+		srv := newOTLPServer(t)
+		s, err := NewOTLPLogSender("svc", OTLPLogOptions{Endpoint: srv.URL, FlushInterval: 10 * time.Millisecond, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "interval"))
+		require.Eventually(t, func() bool { return srv.count() == 1 }, time.Second, 10*time.Millisecond)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "close"))
+		require.NoError(t, s.Close())
+		assert.Equal(t, 2, srv.count())
+		assert.NoError(t, s.Close())
+	})
+	t.Run("ReportsExportErrors", func(t *testing.T) {
+		s, err := NewOTLPLogSender("svc", OTLPLogOptions{
+			Endpoint:         "http://127.0.0.1:1",
+			HTTPRetryOptions: HTTPRetryOptions{MaxRetries: -1},
+		}, lvl)
+		require.NoError(t, err)
+		var handled message.Composer
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, m message.Composer) { handled = m }))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "lost"))
+		assert.Error(t, s.Close())
+		require.NotNil(t, handled)
+		assert.Equal(t, "lost", handled.String())
+	})
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	assert.Equal(t, 23, otlpSeverity(level.Emergency))
+	assert.Equal(t, 22, otlpSeverity(level.Alert))
+	assert.Equal(t, 21, otlpSeverity(level.Critical))
+	assert.Equal(t, 17, otlpSeverity(level.Error))
+	assert.Equal(t, 13, otlpSeverity(level.Warning))
+	assert.Equal(t, 10, otlpSeverity(level.Notice))
+	assert.Equal(t, 9, otlpSeverity(level.Info))
+	assert.Equal(t, 5, otlpSeverity(level.Debug))
+	assert.Equal(t, 1, otlpSeverity(level.Trace))
+	assert.Equal(t, 0, otlpSeverity(level.Invalid))
+}
+
+func TestOTLPProtobufValue(t *testing.T) {
+	p := &protoBuffer{}
+	otlpProtobufValue(p, false)
+	assert.Equal(t, []byte{0x10, 0x00}, p.Bytes())
+
+	p = &protoBuffer{}
+	otlpProtobufValue(p, json.Number("300"))
+	assert.Equal(t, []byte{0x18, 0xac, 0x02}, p.Bytes())
+
+	p = &protoBuffer{}
+	otlpProtobufValue(p, "")
+	assert.Equal(t, []byte{0x0a, 0x00}, p.Bytes())
+}
@@ -0,0 +1,115 @@
+package send
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protoBuffer is a minimal protocol buffers encoder, used by senders
+// that speak protobuf-based wire protocols without depending on
+// generated code for those protocols.
+type protoBuffer struct {
+	buf []byte
+}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+func (p *protoBuffer) Bytes() []byte { return p.buf }
+
+func (p *protoBuffer) tag(field int, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	p.buf = binary.AppendUvarint(p.buf, v)
+}
+
+// Uint64 encodes an integer field, omitting zero values.
+func (p *protoBuffer) Uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoWireVarint)
+	p.varint(v)
+}
+
+// Int64 encodes a signed, non-zigzag integer field, omitting zero
+// values.
+func (p *protoBuffer) Int64(field int, v int64) { p.Uint64(field, uint64(v)) }
+
+// StringField encodes a string field, omitting empty values.
+func (p *protoBuffer) StringField(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+// Message encodes an embedded message field. Unlike the scalar
+// methods, empty messages are still written, since their presence may
+// be meaningful.
+func (p *protoBuffer) Message(field int, fn func(*protoBuffer)) {
+	inner := &protoBuffer{}
+	fn(inner)
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(inner.buf)))
+	p.buf = append(p.buf, inner.buf...)
+}
+
+// Fixed64 encodes a fixed64 field, omitting zero values.
+func (p *protoBuffer) Fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoWireFixed64)
+	p.buf = binary.LittleEndian.AppendUint64(p.buf, v)
+}
+
+// Fixed32 encodes a fixed32 field, omitting zero values.
+func (p *protoBuffer) Fixed32(field int, v uint32) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoWireFixed32)
+	p.buf = binary.LittleEndian.AppendUint32(p.buf, v)
+}
+
+// BytesField encodes a length-delimited field, omitting empty values.
+func (p *protoBuffer) BytesField(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+// The following methods always write the field, even when the value
+// is the zero value, for use with oneof fields where the presence of
+// the field is meaningful.
+
+// OneofUint64 encodes an integer field.
+func (p *protoBuffer) OneofUint64(field int, v uint64) {
+	p.tag(field, protoWireVarint)
+	p.varint(v)
+}
+
+// OneofDouble encodes a double field.
+func (p *protoBuffer) OneofDouble(field int, v float64) {
+	p.tag(field, protoWireFixed64)
+	p.buf = binary.LittleEndian.AppendUint64(p.buf, math.Float64bits(v))
+}
+
+// OneofString encodes a string field.
+func (p *protoBuffer) OneofString(field int, v string) {
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
@@ -0,0 +1,364 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+const (
+	defaultRateLimitSummaryInterval = time.Minute
+	defaultRateLimitMaxKeys         = 10000
+)
+
+// RateLimit configures a token bucket: the bucket holds up to Burst
+// messages and refills at Rate messages per second.
+type RateLimit struct {
+	Rate  float64 `bson:"rate" json:"rate" yaml:"rate"`
+	Burst int     `bson:"burst" json:"burst" yaml:"burst"`
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+// RateLimitOptions configure the rate limited sender. A message is
+// sent only if every limit that applies to it allows it.
+type RateLimitOptions struct {
+	// Global, if set, limits all messages.
+	Global *RateLimit
+	// Priority limits the messages of each priority. Priorities
+	// without a limit are only subject to the other limits.
+	Priority map[level.Priority]RateLimit
+	// Key, if set, extracts a key from each message, and KeyLimit
+	// limits the messages of each key separately. Messages with an
+	// empty key are only subject to the other limits.
+	Key      func(message.Composer) string
+	KeyLimit RateLimit
+	// MaxKeys is the maximum number of keys tracked at once. When
+	// there are more, messages with new keys are only subject to
+	// the other limits until idle keys are forgotten at the next
+	// summary interval. Defaults to 10,000.
+	MaxKeys int
+
+	// SummaryInterval is how often a summary of the suppressed
+	// messages is sent, if any messages were suppressed. Defaults
+	// to 1 minute.
+	SummaryInterval time.Duration
+	// SummaryPriority is the priority of the summary messages.
+	// Defaults to warning.
+	SummaryPriority level.Priority
+}
+
+func (opts *RateLimitOptions) validate() error {
+	if opts.Global == nil && len(opts.Priority) == 0 && opts.Key == nil {
+		return errors.New("must specify at least one limit")
+	}
+	if opts.Global != nil {
+		if err := opts.Global.validate(); err != nil {
+			return fmt.Errorf("invalid global limit: %w", err)
+		}
+	}
+	for p, l := range opts.Priority {
+		if !p.IsValid() {
+			return fmt.Errorf("invalid priority '%d'", p)
+		}
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("invalid limit for priority '%s': %w", p, err)
+		}
+	}
+	if opts.Key != nil {
+		if err := opts.KeyLimit.validate(); err != nil {
+			return fmt.Errorf("invalid key limit: %w", err)
+		}
+	}
+	if opts.MaxKeys < 0 {
+		return errors.New("MaxKeys cannot be negative")
+	}
+	if opts.SummaryInterval < 0 {
+		return errors.New("SummaryInterval cannot be negative")
+	}
+	if opts.SummaryPriority != level.Invalid && !opts.SummaryPriority.IsValid() {
+		return fmt.Errorf("invalid summary priority '%d'", opts.SummaryPriority)
+	}
+
+	if opts.MaxKeys == 0 {
+		opts.MaxKeys = defaultRateLimitMaxKeys
+	}
+	if opts.SummaryInterval == 0 {
+		opts.SummaryInterval = defaultRateLimitSummaryInterval
+	}
+	if opts.SummaryPriority == level.Invalid {
+		opts.SummaryPriority = level.Warning
+	}
+
+	return nil
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+}
+
+type rateLimitedSender struct {
+	opts     RateLimitOptions
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	global   *tokenBucket
+	priority map[level.Priority]*tokenBucket
+	keys     map[string]*tokenBucket
+	closed   bool
+
+	suppressed           int
+	suppressedByPriority map[level.Priority]int
+	suppressedByKey      map[string]int
+	firstSuppressed      time.Time
+
+	Sender
+}
+
+// NewRateLimitedSender provides a Sender implementation that wraps an
+// existing Sender and drops messages that exceed token bucket limits
+// on all messages, on the messages of each priority, and on the
+// messages of each key extracted from the message. Messages in a
+// group are limited individually.
+//
+// Dropped messages are counted, and a summary of them, with the total
+// and the counts by priority and by key, is sent to the underlying
+// Sender at every summary interval in which messages were dropped, and
+// when the Sender is closed. Summaries are not subject to the limits.
+//
+// This Sender does not own the underlying Sender, so users are responsible for
+// closing the underlying Sender if/when it is appropriate to release its
+// resources.
+func NewRateLimitedSender(sender Sender, opts RateLimitOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &rateLimitedSender{
+		opts:                 opts,
+		cancel:               cancel,
+		priority:             make(map[level.Priority]*tokenBucket, len(opts.Priority)),
+		keys:                 map[string]*tokenBucket{},
+		suppressedByPriority: map[level.Priority]int{},
+		suppressedByKey:      map[string]int{},
+		Sender:               sender,
+	}
+	if opts.Global != nil {
+		s.global = newTokenBucket(*opts.Global, now)
+	}
+	for p, l := range opts.Priority {
+		s.priority[p] = newTokenBucket(l, now)
+	}
+
+	go s.intervalSummary(ctx)
+
+	return s, nil
+}
+
+func (s *rateLimitedSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	if g, ok := m.(*message.GroupComposer); ok {
+		allowed := []message.Composer{}
+		for _, c := range g.Messages() {
+			if s.allow(c) {
+				allowed = append(allowed, c)
+			}
+		}
+
+		switch len(allowed) {
+		case 0:
+		case len(g.Messages()):
+			s.Sender.Send(ctx, m)
+		default:
+			s.Sender.Send(ctx, message.NewGroupComposer(allowed))
+		}
+		return
+	}
+
+	if s.allow(m) {
+		s.Sender.Send(ctx, m)
+	}
+}
+
+// Close sends a summary of any messages dropped since the last summary
+// to the underlying Sender. This does not close the underlying sender.
+func (s *rateLimitedSender) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.cancel()
+	summary := s.summary()
+	s.mu.Unlock()
+
+	if summary != nil {
+		s.Sender.Send(context.Background(), summary)
+	}
+
+	return nil
+}
+
+// allow reports whether a message is within all of the limits that
+// apply to it, and takes a token from each of their buckets if it
+// is. Otherwise, the message is counted as suppressed.
+func (s *rateLimitedSender) allow(m message.Composer) bool {
+	var key string
+	if s.opts.Key != nil {
+		key = s.opts.Key(m)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	now := time.Now()
+	buckets := make([]*tokenBucket, 0, 3)
+	if s.global != nil {
+		buckets = append(buckets, s.global)
+	}
+	if b, ok := s.priority[m.Priority()]; ok {
+		buckets = append(buckets, b)
+	}
+	if key != "" {
+		b, ok := s.keys[key]
+		if !ok && len(s.keys) < s.opts.MaxKeys {
+			b = newTokenBucket(s.opts.KeyLimit, now)
+			s.keys[key] = b
+		}
+		if b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+
+	allowed := true
+	for _, b := range buckets {
+		b.refill(now)
+		if b.tokens < 1 {
+			allowed = false
+		}
+	}
+
+	if !allowed {
+		if s.suppressed == 0 {
+			s.firstSuppressed = now
+		}
+		s.suppressed++
+		s.suppressedByPriority[m.Priority()]++
+		if key != "" {
+			s.suppressedByKey[key]++
+		}
+		return false
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true
+}
+
+// summary returns a message describing the messages suppressed since
+// the last summary, or nil if there are none, and resets the counts.
+// The caller must hold the lock.
+func (s *rateLimitedSender) summary() message.Composer {
+	if s.suppressed == 0 {
+		return nil
+	}
+
+	byPriority := message.Fields{}
+	for p, count := range s.suppressedByPriority {
+		byPriority[p.String()] = count
+	}
+
+	fields := message.Fields{
+		message.FieldsMsgName: fmt.Sprintf("%d messages suppressed by rate limit", s.suppressed),
+		"suppressed":          s.suppressed,
+		"by_priority":         byPriority,
+		"since":               s.firstSuppressed,
+	}
+	if len(s.suppressedByKey) > 0 {
+		byKey := message.Fields{}
+		for key, count := range s.suppressedByKey {
+			byKey[key] = count
+		}
+		fields["by_key"] = byKey
+	}
+
+	s.suppressed = 0
+	s.suppressedByPriority = map[level.Priority]int{}
+	s.suppressedByKey = map[string]int{}
+
+	return message.NewFields(s.opts.SummaryPriority, fields)
+}
+
+// forgetIdleKeys removes the buckets of keys that have refilled
+// completely, since they are equivalent to new buckets. The caller
+// must hold the lock.
+func (s *rateLimitedSender) forgetIdleKeys(now time.Time) {
+	for key, b := range s.keys {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+func (s *rateLimitedSender) intervalSummary(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.SummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				return
+			}
+			summary := s.summary()
+			s.forgetIdleKeys(time.Now())
+			s.mu.Unlock()
+
+			if summary != nil {
+				s.Sender.Send(ctx, summary)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package send
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedSender(t *testing.T) {
+	newRateLimitedSender := func(t *testing.T, opts RateLimitOptions) (*rateLimitedSender, *InternalSender) {
+		s, err := NewInternalLogger("limited", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+
+		rs, err := NewRateLimitedSender(s, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = rs.Close() })
+
+		return rs.(*rateLimitedSender), s
+	}
+	drain := func(s *InternalSender) []*InternalMessage {
+		out := []*InternalMessage{}
+		for {
+			msg, ok := s.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg)
+		}
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		s, err := NewInternalLogger("limited", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+
+		for _, opts := range []RateLimitOptions{
+			{},
+			{Global: &RateLimit{Rate: 0, Burst: 1}},
+			{Global: &RateLimit{Rate: 1, Burst: 0}},
+			{Priority: map[level.Priority]RateLimit{level.Priority(1000): {Rate: 1, Burst: 1}}},
+			{Key: func(message.Composer) string { return "" }},
+		} {
+			rs, err := NewRateLimitedSender(s, opts)
+			assert.Error(t, err)
+			assert.Nil(t, rs)
+		}
+	})
+	t.Run("GlobalLimit", func(t *testing.T) {
+		rs, s := newRateLimitedSender(t, RateLimitOptions{Global: &RateLimit{Rate: 0.001, Burst: 3}})
+
+		for i := 0; i < 10; i++ {
+			rs.Send(t.Context(), message.NewDefaultMessage(level.Info, fmt.Sprint(i)))
+		}
+		msgs := drain(s)
+		require.Len(t, msgs, 3)
+		assert.Equal(t, "2", msgs[2].Message.String())
+
+		require.NoError(t, rs.Close())
+		msgs = drain(s)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, level.Warning, msgs[0].Priority)
+		assert.Equal(t, "7 messages suppressed by rate limit", msgs[0].Message.Raw().(message.Fields)[message.FieldsMsgName])
+		assert.Equal(t, 7, msgs[0].Message.Raw().(message.Fields)["suppressed"])
+		assert.Equal(t, message.Fields{"info": 7}, msgs[0].Message.Raw().(message.Fields)["by_priority"])
+
+		rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "closed"))
+		assert.Empty(t, drain(s))
+	})
+	t.Run("PriorityLimit", func(t *testing.T) {
+		rs, s := newRateLimitedSender(t, RateLimitOptions{
+			Priority: map[level.Priority]RateLimit{level.Debug: {Rate: 0.001, Burst: 1}},
+		})
+
+		for i := 0; i < 5; i++ {
+			rs.Send(t.Context(), message.NewDefaultMessage(level.Debug, "debug"))
+			rs.Send(t.Context(), message.NewDefaultMessage(level.Error, "error"))
+		}
+		msgs := drain(s)
+		assert.Len(t, msgs, 6)
+	})
+	t.Run("KeyLimitRefills", func(t *testing.T) {
+		rs, s := newRateLimitedSender(t, RateLimitOptions{
+			Key:      func(m message.Composer) string { return m.String() },
+			KeyLimit: RateLimit{Rate: 10, Burst: 1},
+		})
+
+		for i := 0; i < 5; i++ {
+			rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "a"))
+			rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "b"))
+		}
+		assert.Len(t, drain(s), 2)
+
+		time.Sleep(150 * time.Millisecond)
+		rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "a"))
+		assert.Len(t, drain(s), 1)
+
+		require.NoError(t, rs.Close())
+		msgs := drain(s)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, message.Fields{"a": 4, "b": 4}, msgs[0].Message.Raw().(message.Fields)["by_key"])
+	})
+	t.Run("GroupsAreLimitedIndividually", func(t *testing.T) {
+		rs, s := newRateLimitedSender(t, RateLimitOptions{Global: &RateLimit{Rate: 0.001, Burst: 2}})
+
+		rs.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Info, "two"),
+			message.NewDefaultMessage(level.Info, "three"),
+		))
+		msgs := drain(s)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "one\ntwo", msgs[0].Message.String())
+	})
+	t.Run("PeriodicSummary", func(t *testing.T) {
+		rs, s := newRateLimitedSender(t, RateLimitOptions{
+			Global:          &RateLimit{Rate: 0.001, Burst: 1},
+			SummaryInterval: 10 * time.Millisecond,
+			SummaryPriority: level.Notice,
+		})
+
+		rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "sent"))
+		rs.Send(t.Context(), message.NewDefaultMessage(level.Info, "dropped"))
+
+		require.Eventually(t, func() bool { return s.Len() == 2 }, time.Second, time.Millisecond)
+		msg := s.GetMessage()
+		assert.Equal(t, "sent", msg.Message.String())
+		msg = s.GetMessage()
+		assert.Equal(t, level.Notice, msg.Priority)
+		assert.Equal(t, 1, msg.Message.Raw().(message.Fields)["suppressed"])
+	})
+}
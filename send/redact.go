@@ -0,0 +1,556 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/mongodb/grip/message"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+const (
+	defaultRedactionMask = "[REDACTED]"
+	maxRedactionDepth    = 32
+)
+
+// DefaultRedactedKeys are the key patterns that are redacted when
+// RedactionOptions does not specify any.
+var DefaultRedactedKeys = []string{
+	"password",
+	"passwd",
+	"*secret*",
+	"*token*",
+	"api_key",
+	"apikey",
+	"authorization",
+	"cookie",
+	"private_key",
+}
+
+// secretPattern is a regular expression for a kind of secret and the
+// replacement for its matches, which may refer to submatches.
+type secretPattern struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// secretPatterns are the shapes of common secrets that are redacted
+// from strings.
+var secretPatterns = []secretPattern{
+	// AWS access key IDs.
+	{regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`), "${mask}"},
+	// AWS secret access keys, which are only recognizable by the
+	// name that precedes them.
+	{regexp.MustCompile(`(?i)(aws_?secret_?access_?key["']?\s*[:=]\s*["']?)[A-Za-z0-9/+=]{40}`), "${1}${mask}"},
+	// Bearer tokens, e.g. in Authorization headers.
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}${mask}"},
+	// GitHub personal access, OAuth, user, server and refresh
+	// tokens.
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`), "${mask}"},
+	// Credentials in URLs.
+	{regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.\-]*://)[^/\s:@]*:[^/\s@]*@`), "${1}${mask}@"},
+}
+
+// RedactionOptions configure how the redacting Sender and formatter
+// mask secrets.
+type RedactionOptions struct {
+	// Keys are glob patterns, as used by path.Match, for the keys
+	// of values to mask, matched without regard to case. Defaults
+	// to DefaultRedactedKeys.
+	Keys []string `bson:"keys" json:"keys" yaml:"keys"`
+	// Patterns are regular expressions for secrets to mask in
+	// strings, in addition to the built-in patterns for AWS keys,
+	// bearer tokens, GitHub tokens and URLs with credentials.
+	Patterns []string `bson:"patterns" json:"patterns" yaml:"patterns"`
+	// Mask replaces the redacted values. Defaults to "[REDACTED]".
+	Mask string `bson:"mask" json:"mask" yaml:"mask"`
+}
+
+// redactor masks secrets in messages and values.
+type redactor struct {
+	keys     []string
+	patterns []secretPattern
+	mask     string
+}
+
+func newRedactor(opts RedactionOptions) (*redactor, error) {
+	r := &redactor{mask: opts.Mask}
+	if r.mask == "" {
+		r.mask = defaultRedactionMask
+	}
+	keys := opts.Keys
+	if keys == nil {
+		keys = DefaultRedactedKeys
+	}
+
+	catcher := []string{}
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		if _, err := path.Match(key, ""); err != nil {
+			catcher = append(catcher, fmt.Sprintf("invalid key pattern '%s': %s", key, err))
+			continue
+		}
+		r.keys = append(r.keys, key)
+	}
+
+	// Expand the mask in the replacements, escaping it so that it
+	// is not expanded again.
+	mask := strings.ReplaceAll(r.mask, "$", "$$")
+	for _, p := range secretPatterns {
+		r.patterns = append(r.patterns, secretPattern{
+			pattern:     p.pattern,
+			replacement: strings.ReplaceAll(p.replacement, "${mask}", mask),
+		})
+	}
+	for _, pattern := range opts.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			catcher = append(catcher, fmt.Sprintf("invalid pattern '%s': %s", pattern, err))
+			continue
+		}
+		r.patterns = append(r.patterns, secretPattern{pattern: re, replacement: mask})
+	}
+	if len(catcher) > 0 {
+		return nil, errors.New(strings.Join(catcher, "; "))
+	}
+
+	return r, nil
+}
+
+func (r *redactor) matchesKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.keys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, p := range r.patterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+
+	return s
+}
+
+// redactMessage returns a copy of a message with its secrets masked,
+// or the message itself if it has none. Groups are redacted member by
+// member.
+func (r *redactor) redactMessage(m message.Composer) message.Composer {
+	out, _ := r.redactComposer(m, 0)
+	return out
+}
+
+// redactComposer redacts a message, and reports whether it masked
+// anything. Messages with message.Fields payloads are rebuilt from the
+// redacted fields, which keep the original metadata unless its
+// annotations are redacted. Other messages are wrapped, so that their
+// Raw forms keep their types, as the Slack and Jira senders require.
+func (r *redactor) redactComposer(m message.Composer, depth int) (message.Composer, bool) {
+	if g, ok := m.(*message.GroupComposer); ok {
+		changed := false
+		msgs := make([]message.Composer, 0, len(g.Messages()))
+		for _, c := range g.Messages() {
+			out, ok := r.redactComposer(c, depth+1)
+			changed = changed || ok
+			msgs = append(msgs, out)
+		}
+		if !changed {
+			return m, false
+		}
+		return message.NewGroupComposer(msgs), true
+	}
+
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok && !isSelf(raw, m) {
+		raw = c.Raw()
+	}
+	if fields, ok := raw.(message.Fields); ok {
+		out, changed := r.redactReflect(reflect.ValueOf(fields), depth+1)
+		if !changed {
+			return m, false
+		}
+		return message.NewSimpleFields(m.Priority(), out.Interface().(message.Fields)), true
+	}
+
+	// Some composers, such as string messages, are their own Raw
+	// form, and compute their fields from unexported state, so
+	// their redacted Raw forms are documents.
+	if _, ok := raw.(message.Composer); ok {
+		if doc, err := messageDocument(m); err == nil {
+			raw = doc
+		}
+	}
+	msg := m.String()
+	redacted := r.redactString(msg)
+	out, changed := r.redactDynamic(reflect.ValueOf(raw), depth+1)
+	if !changed && redacted == msg {
+		return m, false
+	}
+
+	rm := &redactedMessage{Composer: m, message: redacted}
+	if out.IsValid() {
+		rm.raw = out.Interface()
+	}
+	return rm, true
+}
+
+// redactedMessage is a redacted copy of a message that does not have a
+// message.Fields payload. Its priority and metadata are those of the
+// original message.
+type redactedMessage struct {
+	message.Composer
+	message string
+	raw     interface{}
+}
+
+func (m *redactedMessage) String() string   { return m.message }
+func (m *redactedMessage) Raw() interface{} { return m.raw }
+
+func (m *redactedMessage) Annotate(key string, value interface{}) error {
+	doc, ok := m.raw.(map[string]interface{})
+	if !ok {
+		return m.Composer.Annotate(key, value)
+	}
+	if _, ok := doc[key]; ok {
+		return fmt.Errorf("key '%s' already exists", key)
+	}
+	doc[key] = value
+
+	return nil
+}
+
+// redactValue returns a copy of a value with its secrets masked, or the
+// value itself if it has none: the values of matching keys and of
+// struct fields tagged secret:"true" are replaced with the mask, and
+// strings are redacted. Copies have the type of the original value,
+// except for composers, errors, and values that marshal themselves to
+// JSON with secrets, which are replaced with redacted messages,
+// redacted error messages, and redacted JSON documents.
+func (r *redactor) redactValue(value interface{}, depth int) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	out, _ := r.redactDynamic(reflect.ValueOf(value), depth)
+	return out.Interface()
+}
+
+// redactDynamic redacts a value that may be replaced by a value of
+// another type, and reports whether it masked anything.
+func (r *redactor) redactDynamic(v reflect.Value, depth int) (reflect.Value, bool) {
+	if !v.IsValid() || depth > maxRedactionDepth || !v.CanInterface() {
+		return v, false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return v, false
+	}
+
+	switch value := v.Interface().(type) {
+	case message.Composer:
+		out, changed := r.redactComposer(value, depth+1)
+		return reflect.ValueOf(out), changed
+	case json.Marshaler:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return r.redactBytes(v, depth)
+		}
+		if doc, ok := r.redactJSON(value, depth); ok {
+			return reflect.ValueOf(doc), true
+		}
+	case error:
+		msg := value.Error()
+		if redacted := r.redactString(msg); redacted != msg {
+			return reflect.ValueOf(redacted), true
+		}
+		return v, false
+	}
+
+	return r.redactReflect(v, depth)
+}
+
+// redactJSON redacts the JSON document a value marshals to, and reports
+// whether it masked anything.
+func (r *redactor) redactJSON(value json.Marshaler, depth int) (interface{}, bool) {
+	data, err := value.MarshalJSON()
+	if err != nil {
+		return nil, false
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, false
+	}
+
+	out, changed := r.redactDynamic(reflect.ValueOf(doc), depth+1)
+	if !changed {
+		return nil, false
+	}
+	return out.Interface(), true
+}
+
+// redactReflect returns a copy of a value, of the same type, with its
+// secrets masked, and reports whether it masked anything. Unexported
+// fields of structs are shared with the original value.
+func (r *redactor) redactReflect(v reflect.Value, depth int) (reflect.Value, bool) {
+	if depth > maxRedactionDepth {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		inner, changed := r.redactDynamic(v.Elem(), depth+1)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		switch {
+		case inner.Type().AssignableTo(v.Type()):
+			out.Set(inner)
+		case inner.Kind() == reflect.String && v.Type() == errorType:
+			out.Set(reflect.ValueOf(errors.New(inner.String())))
+		default:
+			if inner, changed = r.redactReflect(v.Elem(), depth+1); !changed {
+				return v, false
+			}
+			out.Set(inner)
+		}
+		return out, true
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := r.redactReflect(v.Elem(), depth+1)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		if !r.redactStruct(out, depth) {
+			return v, false
+		}
+		return out, true
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+		changed := false
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			val, ok := r.redactEntry(iter.Key().String(), iter.Value(), depth)
+			changed = changed || ok
+			out.SetMapIndex(iter.Key(), val)
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, false
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return r.redactBytes(v, depth)
+		}
+		changed := false
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for idx := 0; idx < v.Len(); idx++ {
+			val, ok := r.redactReflect(v.Index(idx), depth+1)
+			changed = changed || ok
+			out.Index(idx).Set(val)
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	case reflect.Array:
+		changed := false
+		out := reflect.New(v.Type()).Elem()
+		for idx := 0; idx < v.Len(); idx++ {
+			val, ok := r.redactReflect(v.Index(idx), depth+1)
+			changed = changed || ok
+			out.Index(idx).Set(val)
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	case reflect.String:
+		s := r.redactString(v.String())
+		if s == v.String() {
+			return v, false
+		}
+		return reflect.ValueOf(s).Convert(v.Type()), true
+	default:
+		return v, false
+	}
+}
+
+// redactBytes redacts byte slices that hold JSON documents, such as
+// json.RawMessage, and leaves other bytes alone.
+func (r *redactor) redactBytes(v reflect.Value, depth int) (reflect.Value, bool) {
+	if !v.CanInterface() {
+		return v, false
+	}
+	m, ok := v.Interface().(json.Marshaler)
+	if !ok {
+		return v, false
+	}
+	doc, ok := r.redactJSON(m, depth)
+	if !ok {
+		return v, false
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return v, false
+	}
+
+	return reflect.ValueOf(data).Convert(v.Type()), true
+}
+
+// isSelf reports whether two values are the same pointer.
+func isSelf(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Kind() == reflect.Ptr && vb.Kind() == reflect.Ptr && va.Pointer() == vb.Pointer()
+}
+
+func (r *redactor) redactEntry(key string, v reflect.Value, depth int) (reflect.Value, bool) {
+	if r.matchesKey(key) {
+		return r.maskValue(v.Type()), true
+	}
+
+	return r.redactReflect(v, depth+1)
+}
+
+// maskValue returns the mask as a value of a type, or the zero value of
+// types that cannot hold strings.
+func (r *redactor) maskValue(t reflect.Type) reflect.Value {
+	mask := reflect.ValueOf(r.mask)
+	switch {
+	case t.Kind() == reflect.String:
+		return mask.Convert(t)
+	case mask.Type().AssignableTo(t):
+		out := reflect.New(t).Elem()
+		out.Set(mask)
+		return out
+	default:
+		return reflect.Zero(t)
+	}
+}
+
+// redactStruct redacts the exported fields of a struct in place, and
+// reports whether it masked anything. Fields are matched by their JSON
+// names, and untagged embedded structs are redacted as part of the
+// struct, as encoding/json does.
+func (r *redactor) redactStruct(rv reflect.Value, depth int) bool {
+	changed := false
+	rt := rv.Type()
+	for idx := 0; idx < rt.NumField(); idx++ {
+		field := rt.Field(idx)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fv := rv.Field(idx)
+
+		if field.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			changed = r.redactStruct(fv, depth+1) || changed
+			continue
+		}
+		if !fv.CanSet() {
+			continue
+		}
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			if !fv.IsZero() {
+				fv.Set(r.maskValue(field.Type))
+				changed = true
+			}
+			continue
+		}
+		if val, ok := r.redactEntry(name, fv, depth); ok {
+			fv.Set(val)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+type redactingSender struct {
+	redactor *redactor
+	Sender
+}
+
+// NewRedactingSender provides a Sender implementation that wraps an
+// existing Sender and masks secrets in messages before sending them:
+// the values of keys that match the configured patterns, struct fields
+// tagged secret:"true", and strings that look like AWS keys, bearer
+// tokens, GitHub tokens or URLs with credentials, including values
+// nested in maps, slices and structs. The underlying Sender receives
+// messages without secrets unchanged, and redacted copies of other
+// messages, whose Raw forms keep their types, so that senders that
+// expect particular payloads, such as *message.Slack or
+// *message.JiraIssue, still receive them.
+//
+// Since the redacting sender owns the underlying Sender, calling Close
+// on this sender will close the underlying sender.
+func NewRedactingSender(sender Sender, opts RedactionOptions) (Sender, error) {
+	r, err := newRedactor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redactingSender{redactor: r, Sender: sender}, nil
+}
+
+func (s *redactingSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	s.Sender.Send(ctx, s.redactor.redactMessage(m))
+}
+
+// MakeRedactingFormatter returns a MessageFormatter that formats
+// redacted copies of messages with another MessageFormatter, and
+// redacts its output, masking secrets in the same way as the redacting
+// Sender. Senders that do not use formatters are not affected, so use
+// NewRedactingSender to redact messages for all kinds of senders.
+func MakeRedactingFormatter(mf MessageFormatter, opts RedactionOptions) (MessageFormatter, error) {
+	if mf == nil {
+		return nil, errors.New("must specify a formatter")
+	}
+	r, err := newRedactor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(m message.Composer) (string, error) {
+		out, err := mf(r.redactMessage(m))
+		if err != nil {
+			return "", err
+		}
+
+		return r.redactString(out), nil
+	}, nil
+}
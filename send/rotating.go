@@ -0,0 +1,435 @@
+package send
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	rotatedFileTimeFormat = "20060102T150405.000000000"
+	compressedFileSuffix  = ".gz"
+)
+
+// RotatingFileOptions configures the rotating file sender.
+type RotatingFileOptions struct {
+	// Path is the path to the active log file. Rotated segments
+	// are written to the same directory, with a timestamp suffix
+	// added to the file name.
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// MaxSize is the maximum size, in bytes, of the active log
+	// file. A message that would make the file exceed this size
+	// causes a rotation before it's written. Zero disables
+	// size-based rotation.
+	MaxSize int64 `bson:"max_size" json:"max_size" yaml:"max_size"`
+	// Interval rotates the active log file when it's older than
+	// the interval. Zero disables time-based rotation.
+	Interval time.Duration `bson:"interval" json:"interval" yaml:"interval"`
+	// MaxBackups is the maximum number of rotated segments to
+	// keep. Zero keeps all segments.
+	MaxBackups int `bson:"max_backups" json:"max_backups" yaml:"max_backups"`
+	// MaxAge is the maximum age of rotated segments. Older
+	// segments are deleted after a rotation. Zero keeps segments
+	// regardless of age.
+	MaxAge time.Duration `bson:"max_age" json:"max_age" yaml:"max_age"`
+	// Compress gzips rotated segments in the background.
+	Compress bool `bson:"compress" json:"compress" yaml:"compress"`
+	// ReopenOnSIGHUP closes and reopens the active log file when
+	// the process receives SIGHUP, for use with external rotation
+	// tools that move the file.
+	ReopenOnSIGHUP bool `bson:"reopen_on_sighup" json:"reopen_on_sighup" yaml:"reopen_on_sighup"`
+}
+
+// Validate checks the options for impossible values.
+func (opts RotatingFileOptions) Validate() error {
+	catcher := []string{}
+	if opts.Path == "" {
+		catcher = append(catcher, "must specify a file path")
+	}
+	if opts.MaxSize < 0 {
+		catcher = append(catcher, "max size cannot be negative")
+	}
+	if opts.Interval < 0 {
+		catcher = append(catcher, "interval cannot be negative")
+	}
+	if opts.MaxBackups < 0 {
+		catcher = append(catcher, "max backups cannot be negative")
+	}
+	if opts.MaxAge < 0 {
+		catcher = append(catcher, "max age cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+type rotatingFileLogger struct {
+	opts      RotatingFileOptions
+	file      *os.File
+	size      int64
+	openedAt  time.Time
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	cleanup   sync.Mutex
+	signals   chan os.Signal
+	closed    bool
+	closeErr  error
+	closeOnce sync.Once
+	*Base
+}
+
+// NewRotatingFileLogger constructs a configured Sender that writes
+// messages to a file, rotating the file based on its size and/or age.
+// See MakeRotatingFileLogger for more information.
+func NewRotatingFileLogger(name string, opts RotatingFileOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeRotatingFileLogger(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeRotatingFileLogger constructs an unconfigured Sender that
+// writes one formatted message per line to the file specified in the
+// options. When the file reaches the configured maximum size or age,
+// it is renamed with a timestamp suffix, optionally compressed, and a
+// new file is opened in its place. Old segments are removed according
+// to the MaxBackups and MaxAge options.
+//
+// The sender uses the default formatter, but accepts any
+// MessageFormatter (e.g. MakeJSONFormatter or
+// MakeCallSiteFormatter) through SetFormatter. Closing the sender
+// closes the file and waits for any background compression to finish.
+func MakeRotatingFileLogger(opts RotatingFileOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid rotating file options")
+	}
+
+	s := &rotatingFileLogger{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	if err := s.SetFormatter(MakeDefaultFormatter()); err != nil {
+		return nil, err
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stderr, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	if opts.ReopenOnSIGHUP {
+		s.signals = make(chan os.Signal, 1)
+		signal.Notify(s.signals, syscall.SIGHUP)
+		go s.handleSignals()
+	}
+
+	return s, nil
+}
+
+// Close closes the active file and waits for background compression
+// and cleanup of rotated segments to complete. Messages sent after
+// Close are passed to the error handler, and the file is not rotated
+// or reopened. This does not use the Base's closer, because the
+// background operations may need to call the error handler, which
+// would deadlock with Base.Close.
+func (s *rotatingFileLogger) Close() error {
+	s.closeOnce.Do(func() {
+		if s.signals != nil {
+			signal.Stop(s.signals)
+			close(s.signals)
+		}
+
+		s.mu.Lock()
+		s.closed = true
+		if s.file != nil {
+			s.closeErr = errors.WithStack(s.file.Close())
+			s.file = nil
+		}
+		s.mu.Unlock()
+
+		s.wg.Wait()
+	})
+
+	return s.closeErr
+}
+
+func (s *rotatingFileLogger) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	out, err := s.Formatter()(m)
+	if err != nil {
+		s.ErrorHandler()(ctx, err, m)
+		return
+	}
+
+	line := []byte(out + "\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.ErrorHandler()(ctx, errors.New("the log file is closed"), m)
+		return
+	}
+
+	if s.shouldRotate(int64(len(line))) {
+		if err = s.rotate(); err != nil {
+			s.ErrorHandler()(ctx, errors.Wrap(err, "rotating log file"), m)
+			if s.file == nil {
+				return
+			}
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "writing to log file"), m)
+	}
+}
+
+func (s *rotatingFileLogger) Flush(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	return errors.WithStack(s.file.Sync())
+}
+
+func (s *rotatingFileLogger) handleSignals() {
+	for range s.signals {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		if s.file != nil {
+			_ = s.file.Close()
+		}
+		err := s.open()
+		s.mu.Unlock()
+
+		if err != nil {
+			s.ErrorHandler()(context.Background(), err, message.NewErrorWrapMessage(level.Error, err, "reopening log file '%s'", s.opts.Path))
+		}
+	}
+}
+
+// open opens (or creates) the active log file. The caller must hold
+// the lock, except during construction.
+func (s *rotatingFileLogger) open() error {
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		s.file = nil
+		return errors.Wrapf(err, "opening output file '%s'", s.opts.Path)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		s.file = nil
+		return errors.Wrapf(err, "getting info for output file '%s'", s.opts.Path)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	if s.size > 0 {
+		s.openedAt = info.ModTime()
+	}
+
+	return nil
+}
+
+func (s *rotatingFileLogger) shouldRotate(next int64) bool {
+	if s.file == nil {
+		return true
+	}
+
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+next > s.opts.MaxSize {
+		return true
+	}
+
+	if s.opts.Interval > 0 && time.Since(s.openedAt) >= s.opts.Interval {
+		return true
+	}
+
+	return false
+}
+
+// rotate moves the active file aside and opens a new one in its
+// place. The caller must hold the lock.
+func (s *rotatingFileLogger) rotate() error {
+	if s.closed {
+		return errors.New("the log file is closed")
+	}
+
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return errors.Wrapf(err, "closing output file '%s'", s.opts.Path)
+		}
+		s.file = nil
+	}
+
+	if s.size > 0 {
+		rotated := s.opts.Path + "." + time.Now().UTC().Format(rotatedFileTimeFormat)
+		if err := os.Rename(s.opts.Path, rotated); err != nil && !os.IsNotExist(err) {
+			if openErr := s.open(); openErr != nil {
+				return errors.Wrap(openErr, err.Error())
+			}
+			return errors.Wrapf(err, "renaming output file '%s'", s.opts.Path)
+		}
+
+		s.wg.Add(1)
+		go s.postRotate(rotated)
+	}
+
+	return s.open()
+}
+
+// postRotate compresses the newly rotated segment, if configured, and
+// removes segments beyond the retention limits.
+func (s *rotatingFileLogger) postRotate(rotated string) {
+	defer s.wg.Done()
+
+	s.cleanup.Lock()
+	defer s.cleanup.Unlock()
+
+	if s.opts.Compress {
+		if err := compressFile(rotated); err != nil {
+			s.ErrorHandler()(context.Background(), err, message.NewErrorWrapMessage(level.Error, err, "compressing rotated log file '%s'", rotated))
+		}
+	}
+
+	if err := s.prune(); err != nil {
+		s.ErrorHandler()(context.Background(), err, message.NewErrorWrapMessage(level.Error, err, "removing old log files for '%s'", s.opts.Path))
+	}
+}
+
+type rotatedSegment struct {
+	path    string
+	rotated time.Time
+}
+
+func (s *rotatingFileLogger) segments() ([]rotatedSegment, error) {
+	dir, base := filepath.Split(s.opts.Path)
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading directory '%s'", dir)
+	}
+
+	out := []rotatedSegment{}
+	prefix := base + "."
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		ts, err := time.Parse(rotatedFileTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressedFileSuffix))
+		if err != nil {
+			continue
+		}
+
+		out = append(out, rotatedSegment{path: filepath.Join(dir, name), rotated: ts})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].rotated.After(out[j].rotated) })
+
+	return out, nil
+}
+
+func (s *rotatingFileLogger) prune() error {
+	if s.opts.MaxBackups == 0 && s.opts.MaxAge == 0 {
+		return nil
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	catcher := []string{}
+	for idx, seg := range segments {
+		expired := s.opts.MaxAge > 0 && time.Since(seg.rotated) > s.opts.MaxAge
+		excess := s.opts.MaxBackups > 0 && idx >= s.opts.MaxBackups
+		if !expired && !excess {
+			continue
+		}
+
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			catcher = append(catcher, err.Error())
+		}
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "opening file '%s'", path)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+compressedFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "creating file '%s'", path+compressedFileSuffix)
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		_ = gz.Close()
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+		return errors.Wrapf(err, "compressing file '%s'", path)
+	}
+
+	if err = gz.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+		return errors.Wrapf(err, "flushing compressed file '%s'", path)
+	}
+
+	if err = out.Close(); err != nil {
+		return errors.Wrapf(err, "closing compressed file '%s'", path)
+	}
+
+	return errors.Wrapf(os.Remove(path), "removing uncompressed file '%s'", path)
+}
@@ -0,0 +1,208 @@
+package send
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileLogger(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+
+	listSegments := func(t *testing.T, s Sender) []rotatedSegment {
+		segments, err := s.(*rotatingFileLogger).segments()
+		require.NoError(t, err)
+		return segments
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]RotatingFileOptions{
+			"MissingPath":        {},
+			"NegativeSize":       {Path: "foo", MaxSize: -1},
+			"NegativeInterval":   {Path: "foo", Interval: -1},
+			"NegativeMaxBackups": {Path: "foo", MaxBackups: -1},
+			"NegativeMaxAge":     {Path: "foo", MaxAge: -1},
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := MakeRotatingFileLogger(opts)
+				assert.Error(t, err)
+				assert.Nil(t, s)
+			})
+		}
+	})
+	t.Run("WritesLines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "hello"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Debug, "filtered"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Error, "world"))
+		require.NoError(t, s.Close())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "[p=info]: hello\n[p=error]: world\n", string(data))
+	})
+	t.Run("AcceptsFormatter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path}, lvl)
+		require.NoError(t, err)
+		require.NoError(t, s.SetFormatter(MakeJSONFormatter()))
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Info, message.Fields{"a": "b"}))
+		require.NoError(t, s.Close())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		doc := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(data, &doc))
+		assert.Equal(t, "b", doc["a"])
+	})
+	t.Run("RotatesOnSize", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, MaxSize: 32}, lvl)
+		require.NoError(t, err)
+		require.NoError(t, s.SetFormatter(MakePlainFormatter()))
+
+		for i := 0; i < 10; i++ {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, "0123456789"))
+		}
+		require.NoError(t, s.Close())
+
+		segments := listSegments(t, s)
+		assert.Len(t, segments, 4)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat("0123456789\n", 2), string(data))
+		for _, seg := range segments {
+			info, err := os.Stat(seg.path)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, info.Size(), int64(32))
+		}
+	})
+	t.Run("RotatesOnInterval", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, Interval: 10 * time.Millisecond}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+		time.Sleep(20 * time.Millisecond)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+		require.NoError(t, s.Close())
+
+		assert.Len(t, listSegments(t, s), 1)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "[p=info]: second\n", string(data))
+	})
+	t.Run("KeepsMaxBackups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, MaxSize: 1, MaxBackups: 2}, lvl)
+		require.NoError(t, err)
+
+		for i := 0; i < 6; i++ {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, "message"))
+		}
+		require.NoError(t, s.Close())
+
+		assert.Len(t, listSegments(t, s), 2)
+	})
+	t.Run("RemovesExpiredBackups", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.log")
+		old := path + "." + time.Now().Add(-time.Hour).UTC().Format(rotatedFileTimeFormat)
+		require.NoError(t, os.WriteFile(old, []byte("old\n"), 0666))
+
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, MaxSize: 1, MaxAge: time.Minute}, lvl)
+		require.NoError(t, err)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "one"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "two"))
+		require.NoError(t, s.Close())
+
+		_, err = os.Stat(old)
+		assert.True(t, os.IsNotExist(err))
+		assert.Len(t, listSegments(t, s), 1)
+	})
+	t.Run("CompressesBackups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, MaxSize: 1, Compress: true}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "compressed"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "active"))
+		require.NoError(t, s.Close())
+
+		segments := listSegments(t, s)
+		require.Len(t, segments, 1)
+		require.True(t, strings.HasSuffix(segments[0].path, compressedFileSuffix))
+
+		f, err := os.Open(segments[0].path)
+		require.NoError(t, err)
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		data, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, "[p=info]: compressed\n", string(data))
+	})
+	t.Run("ReopensOnSIGHUP", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, ReopenOnSIGHUP: true}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "before"))
+		require.NoError(t, os.Rename(path, filepath.Join(dir, "moved.log")))
+
+		proc, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, proc.Signal(syscall.SIGHUP))
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(path)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "after"))
+		require.NoError(t, s.Flush(t.Context()))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "[p=info]: after\n", string(data))
+	})
+	t.Run("SendAfterClose", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.log")
+		s, err := NewRotatingFileLogger("rotating", RotatingFileOptions{Path: path, MaxSize: 1}, lvl)
+		require.NoError(t, err)
+
+		var errs []error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+			errs = append(errs, err)
+		}))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "before"))
+		require.NoError(t, s.Close())
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "after"))
+
+		require.Len(t, errs, 1)
+		assert.Empty(t, listSegments(t, s))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "[p=info]: before\n", string(data))
+	})
+}
@@ -0,0 +1,347 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// RoutingRule routes the messages that it matches to its targets. A
+// rule matches a message when all of its conditions match; conditions
+// that are not set always match.
+type RoutingRule struct {
+	// MinPriority and MaxPriority are the inclusive range of
+	// priorities of the messages to match. Either end of the range
+	// may be left unset.
+	MinPriority level.Priority
+	MaxPriority level.Priority
+	// Names are glob patterns, as used by path.Match, for the
+	// name of the routing sender. The rule matches if any of the
+	// patterns match. Names match the sender, not the messages:
+	// journalers set the name of their sender with SetName and
+	// SetSender, so journalers that share a routing sender all
+	// match the name of the journaler that set it last. To route
+	// the messages of journalers that share a routing sender, use
+	// Fields instead, e.g. with journalers derived with With.
+	Names []string
+	// Types are the types of messages to match. The rule matches
+	// if the message, or its Raw form, has any of the types, or
+	// implements any of the interface types. Use RouteType to get
+	// the types of messages and interfaces.
+	Types []reflect.Type
+	// Fields are predicates on the values of the fields of
+	// messages, which are passed as decoded from JSON, so numbers
+	// are json.Number values. The rule matches if the messages
+	// have all of the fields and all of the predicates return true.
+	Fields map[string]func(interface{}) bool
+
+	// Targets are the senders of the messages that the rule
+	// matches.
+	Targets []Sender
+	// Continue, if true, continues routing the messages that the
+	// rule matches to the targets of the following rules. By
+	// default, routing stops at the first rule that matches.
+	Continue bool
+}
+
+// RouteType returns the type of a value for RoutingRule.Types. For
+// nil pointers to interfaces, such as (*message.ErrorComposer)(nil),
+// it returns the interface type, otherwise the type of the value, e.g.
+// the type of (*message.GithubStatus)(nil) is *message.GithubStatus.
+func RouteType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Interface {
+		return t.Elem()
+	}
+
+	return t
+}
+
+func (r *RoutingRule) validate() error {
+	catcher := []string{}
+	if r.MinPriority != level.Invalid && !r.MinPriority.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid minimum priority '%d'", r.MinPriority))
+	}
+	if r.MaxPriority != level.Invalid && !r.MaxPriority.IsValid() {
+		catcher = append(catcher, fmt.Sprintf("invalid maximum priority '%d'", r.MaxPriority))
+	}
+	if r.MinPriority != level.Invalid && r.MaxPriority != level.Invalid && r.MinPriority > r.MaxPriority {
+		catcher = append(catcher, "minimum priority cannot be greater than the maximum priority")
+	}
+	for _, name := range r.Names {
+		if _, err := path.Match(name, ""); err != nil {
+			catcher = append(catcher, fmt.Sprintf("invalid name pattern '%s': %s", name, err))
+		}
+	}
+	for _, t := range r.Types {
+		if t == nil {
+			catcher = append(catcher, "types cannot be nil")
+		}
+	}
+	for key, predicate := range r.Fields {
+		if predicate == nil {
+			catcher = append(catcher, fmt.Sprintf("predicate for field '%s' cannot be nil", key))
+		}
+	}
+	if len(r.Targets) == 0 {
+		catcher = append(catcher, "must specify at least one target")
+	}
+	for _, target := range r.Targets {
+		if target == nil {
+			catcher = append(catcher, "targets cannot be nil")
+		}
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+func (r *RoutingRule) matches(name string, m message.Composer) bool {
+	p := m.Priority()
+	if r.MinPriority != level.Invalid && p < r.MinPriority {
+		return false
+	}
+	if r.MaxPriority != level.Invalid && p > r.MaxPriority {
+		return false
+	}
+
+	if len(r.Names) > 0 {
+		matched := false
+		for _, pattern := range r.Names {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.Types) > 0 {
+		matched := false
+		for _, t := range r.Types {
+			if hasType(m, t) || hasType(m.Raw(), t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.Fields) > 0 {
+		attrs := messageAttributes(m)
+		for key, predicate := range r.Fields {
+			value, ok := attrs[key]
+			if !ok || !predicate(value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func hasType(v interface{}, t reflect.Type) bool {
+	vt := reflect.TypeOf(v)
+	if vt == nil {
+		return false
+	}
+	if t.Kind() == reflect.Interface {
+		return vt.Implements(t)
+	}
+
+	return vt == t
+}
+
+// RoutingOptions configure the routing sender.
+type RoutingOptions struct {
+	// Rules are the routing rules, in the order in which they are
+	// checked.
+	Rules []RoutingRule
+	// Default are the senders of the messages that no rule
+	// matches. Messages that no rule matches are dropped if there
+	// are none.
+	Default []Sender
+}
+
+func (opts *RoutingOptions) validate() error {
+	catcher := []string{}
+	for idx := range opts.Rules {
+		if err := opts.Rules[idx].validate(); err != nil {
+			catcher = append(catcher, fmt.Sprintf("rule %d: %s", idx, err))
+		}
+	}
+	for _, target := range opts.Default {
+		if target == nil {
+			catcher = append(catcher, "default senders cannot be nil")
+		}
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+type routingSender struct {
+	rules    []RoutingRule
+	defaults []Sender
+	targets  []Sender
+	*Base
+}
+
+// NewRoutingSender constructs a Sender that routes each message to
+// the targets of the first rule that matches it, or of every matching
+// rule up to and including the first that does not continue, or to the
+// default senders if no rule matches. Messages in a group are routed
+// individually, and each target receives the messages of the group
+// that were routed to it as a group. Unlike the multi sender, the
+// routing sender does not change the names or levels of its targets,
+// which filter messages by their own levels.
+//
+// The Sender takes ownership of the targets, so closing this Sender
+// closes each of the targets once, even if it is the target of several
+// rules.
+func NewRoutingSender(name string, l LevelInfo, opts RoutingOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &routingSender{
+		rules:    opts.Rules,
+		defaults: opts.Default,
+		Base:     NewBase(name),
+	}
+	if err := s.Base.SetLevel(l); err != nil {
+		return nil, fmt.Errorf("invalid level specification: %w", err)
+	}
+
+	seen := map[Sender]bool{}
+	add := func(targets []Sender) {
+		for _, target := range targets {
+			if !seen[target] {
+				seen[target] = true
+				s.targets = append(s.targets, target)
+			}
+		}
+	}
+	for _, rule := range s.rules {
+		add(rule.Targets)
+	}
+	add(s.defaults)
+
+	s.closer = func() error {
+		errs := []string{}
+		for _, target := range s.targets {
+			if err := target.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return errors.New(strings.Join(errs, "\n"))
+		}
+
+		return nil
+	}
+
+	return s, nil
+}
+
+// route returns the distinct targets of a message.
+func (s *routingSender) route(name string, m message.Composer) []Sender {
+	out := []Sender{}
+	seen := map[Sender]bool{}
+	add := func(targets []Sender) {
+		for _, target := range targets {
+			if !seen[target] {
+				seen[target] = true
+				out = append(out, target)
+			}
+		}
+	}
+
+	matched := false
+	for idx := range s.rules {
+		rule := &s.rules[idx]
+		if !rule.matches(name, m) {
+			continue
+		}
+		matched = true
+		add(rule.Targets)
+		if !rule.Continue {
+			break
+		}
+	}
+	if !matched {
+		add(s.defaults)
+	}
+
+	return out
+}
+
+func (s *routingSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	name := s.Name()
+	g, ok := m.(*message.GroupComposer)
+	if !ok {
+		for _, target := range s.route(name, m) {
+			target.Send(ctx, m)
+		}
+		return
+	}
+
+	order := []Sender{}
+	routed := map[Sender][]message.Composer{}
+	for _, c := range g.Messages() {
+		if !s.Level().ShouldLog(c) {
+			continue
+		}
+		for _, target := range s.route(name, c) {
+			if _, ok := routed[target]; !ok {
+				order = append(order, target)
+			}
+			routed[target] = append(routed[target], c)
+		}
+	}
+
+	for _, target := range order {
+		msgs := routed[target]
+		if len(msgs) == len(g.Messages()) {
+			target.Send(ctx, m)
+		} else if len(msgs) == 1 {
+			target.Send(ctx, msgs[0])
+		} else {
+			target.Send(ctx, message.NewGroupComposer(msgs))
+		}
+	}
+}
+
+func (s *routingSender) Flush(ctx context.Context) error {
+	errs := []string{}
+	for _, target := range s.targets {
+		if err := target.Flush(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package send
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closeCountingSender struct {
+	closes int
+	*InternalSender
+}
+
+func (s *closeCountingSender) Close() error {
+	s.closes++
+	return nil
+}
+
+func TestRoutingSender(t *testing.T) {
+	newTarget := func(t *testing.T, name string) *closeCountingSender {
+		s, err := NewInternalLogger(name, LevelInfo{level.Trace, level.Trace})
+		require.NoError(t, err)
+		return &closeCountingSender{InternalSender: s}
+	}
+	drain := func(s *closeCountingSender) []message.Composer {
+		out := []message.Composer{}
+		for {
+			msg, ok := s.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg.Message)
+		}
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		target := newTarget(t, "target")
+		for _, opts := range []RoutingOptions{
+			{Rules: []RoutingRule{{}}},
+			{Rules: []RoutingRule{{Targets: []Sender{nil}}}},
+			{Rules: []RoutingRule{{MinPriority: level.Error, MaxPriority: level.Info, Targets: []Sender{target}}}},
+			{Rules: []RoutingRule{{Names: []string{"["}, Targets: []Sender{target}}}},
+			{Rules: []RoutingRule{{Fields: map[string]func(interface{}) bool{"key": nil}, Targets: []Sender{target}}}},
+			{Default: []Sender{nil}},
+		} {
+			s, err := NewRoutingSender("router", LevelInfo{level.Info, level.Info}, opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("RoutesByRules", func(t *testing.T) {
+		alerts, github, slow, file := newTarget(t, "alerts"), newTarget(t, "github"), newTarget(t, "slow"), newTarget(t, "file")
+		s, err := NewRoutingSender("router", LevelInfo{level.Debug, level.Debug}, RoutingOptions{
+			Rules: []RoutingRule{
+				{
+					MinPriority: level.Error,
+					Targets:     []Sender{alerts},
+					Continue:    true,
+				},
+				{
+					Types:   []reflect.Type{RouteType((*message.GithubStatus)(nil))},
+					Targets: []Sender{github},
+				},
+				{
+					Fields: map[string]func(interface{}) bool{
+						"duration_ms": func(v interface{}) bool {
+							ms, err := v.(json.Number).Int64()
+							return err == nil && ms > 1000
+						},
+					},
+					Targets: []Sender{slow},
+				},
+			},
+			Default: []Sender{file},
+		})
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewErrorMessage(level.Critical, errors.New("outage")))
+		s.Send(t.Context(), message.NewFields(level.Error, message.Fields{"op": "insert", "duration_ms": 2000}))
+		s.Send(t.Context(), message.NewGithubStatusMessage(level.Info, "ci", message.GithubStateSuccess, "https://ci", "passed"))
+		s.Send(t.Context(), message.NewFields(level.Info, message.Fields{"op": "query", "duration_ms": 5000}))
+		s.Send(t.Context(), message.NewFields(level.Info, message.Fields{"op": "query", "duration_ms": 5}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Trace, "filtered"))
+
+		assert.Len(t, drain(alerts), 2)
+		assert.Len(t, drain(github), 1)
+		slowMsgs := drain(slow)
+		require.Len(t, slowMsgs, 2, "routing continues after the alerts rule")
+		assert.EqualValues(t, 2000, slowMsgs[0].Raw().(message.Fields)["duration_ms"])
+		assert.EqualValues(t, 5000, slowMsgs[1].Raw().(message.Fields)["duration_ms"])
+		fileMsgs := drain(file)
+		require.Len(t, fileMsgs, 1, "matched messages do not take the default route")
+		assert.EqualValues(t, 5, fileMsgs[0].Raw().(message.Fields)["duration_ms"])
+	})
+	t.Run("MatchesInterfacesAndNames", func(t *testing.T) {
+		errs, other := newTarget(t, "errors"), newTarget(t, "other")
+		s, err := NewRoutingSender("service.api", LevelInfo{level.Info, level.Info}, RoutingOptions{
+			Rules: []RoutingRule{
+				{
+					Names:   []string{"service.*"},
+					Types:   []reflect.Type{RouteType((*message.ErrorComposer)(nil))},
+					Targets: []Sender{errs},
+				},
+			},
+			Default: []Sender{other},
+		})
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewErrorMessage(level.Info, errors.New("failed")))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "fine"))
+		assert.Len(t, drain(errs), 1)
+		assert.Len(t, drain(other), 1)
+
+		s.SetName("worker")
+		s.Send(t.Context(), message.NewErrorMessage(level.Info, errors.New("failed")))
+		assert.Empty(t, drain(errs))
+		assert.Len(t, drain(other), 1)
+	})
+	t.Run("SplitsGroups", func(t *testing.T) {
+		high, low := newTarget(t, "high"), newTarget(t, "low")
+		s, err := NewRoutingSender("router", LevelInfo{level.Info, level.Info}, RoutingOptions{
+			Rules: []RoutingRule{
+				{MinPriority: level.Warning, Targets: []Sender{high}},
+				{MaxPriority: level.Notice, Targets: []Sender{low}},
+			},
+		})
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Error, "two"),
+			message.NewDefaultMessage(level.Notice, "three"),
+		))
+		highMsgs := drain(high)
+		require.Len(t, highMsgs, 1)
+		assert.Equal(t, "two", highMsgs[0].String())
+		lowMsgs := drain(low)
+		require.Len(t, lowMsgs, 1)
+		group := lowMsgs[0].(*message.GroupComposer)
+		require.Len(t, group.Messages(), 2)
+		assert.Equal(t, "one", group.Messages()[0].String())
+		assert.Equal(t, "three", group.Messages()[1].String())
+	})
+	t.Run("NoDefaultDropsUnmatched", func(t *testing.T) {
+		target := newTarget(t, "target")
+		s, err := NewRoutingSender("router", LevelInfo{level.Info, level.Info}, RoutingOptions{
+			Rules: []RoutingRule{{MinPriority: level.Error, Targets: []Sender{target}}},
+		})
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "dropped"))
+		assert.Empty(t, drain(target))
+	})
+	t.Run("CloseClosesTargetsOnce", func(t *testing.T) {
+		shared, other := newTarget(t, "shared"), newTarget(t, "other")
+		s, err := NewRoutingSender("router", LevelInfo{level.Info, level.Info}, RoutingOptions{
+			Rules: []RoutingRule{
+				{MinPriority: level.Error, Targets: []Sender{shared, other}},
+				{MinPriority: level.Warning, Targets: []Sender{shared}},
+			},
+			Default: []Sender{shared},
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Flush(t.Context()))
+		require.NoError(t, s.Close())
+		require.NoError(t, s.Close())
+		assert.Equal(t, 1, shared.closes)
+		assert.Equal(t, 1, other.closes)
+	})
+}
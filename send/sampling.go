@@ -0,0 +1,263 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/sometimes"
+)
+
+// SampleRateKey is the annotation that the sampling sender adds to
+// messages: the number of messages that each sent message represents.
+const SampleRateKey = "sample_rate"
+
+// SamplingOptions configure the sampling sender. Each of the kinds of
+// sampling is optional, and a message is sent only if it is kept by
+// all of them.
+type SamplingOptions struct {
+	// Percent is the percentage of the messages of each priority
+	// to send, chosen at random. Priorities that are not in the map
+	// are not sampled.
+	Percent map[level.Priority]int
+
+	// First and Thereafter sample repeated messages in each
+	// Interval: the first First messages with the same priority
+	// and string form are sent, and after that every Thereafter-th
+	// one. Thereafter values of 0 drop all messages after the first
+	// First ones.
+	First      int
+	Thereafter int
+	Interval   time.Duration
+
+	// KeyField and KeyPercent sample messages by the value of a
+	// field: all of the messages for KeyPercent percent of the
+	// values are sent, so that related messages are sent or
+	// dropped together. Messages without the field are not
+	// sampled by key.
+	KeyField   string
+	KeyPercent int
+}
+
+func (opts *SamplingOptions) validate() error {
+	catcher := []string{}
+	for p, percent := range opts.Percent {
+		if !p.IsValid() {
+			catcher = append(catcher, fmt.Sprintf("invalid priority '%d'", p))
+		}
+		if percent < 0 || percent > 100 {
+			catcher = append(catcher, fmt.Sprintf("percent for priority '%s' must be between 0 and 100", p))
+		}
+	}
+	if opts.First < 0 || opts.Thereafter < 0 {
+		catcher = append(catcher, "First and Thereafter cannot be negative")
+	}
+	if opts.First > 0 && opts.Interval <= 0 {
+		catcher = append(catcher, "must specify an Interval with First")
+	}
+	if opts.First == 0 && (opts.Thereafter > 0 || opts.Interval != 0) {
+		catcher = append(catcher, "must specify First with Thereafter or Interval")
+	}
+	if opts.KeyField != "" && (opts.KeyPercent < 0 || opts.KeyPercent > 100) {
+		catcher = append(catcher, "KeyPercent must be between 0 and 100")
+	}
+	if opts.KeyField == "" && opts.KeyPercent != 0 {
+		catcher = append(catcher, "must specify KeyField with KeyPercent")
+	}
+	if len(opts.Percent) == 0 && opts.First == 0 && opts.KeyField == "" {
+		catcher = append(catcher, "must specify at least one kind of sampling")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+type samplingSender struct {
+	opts    SamplingOptions
+	mu      sync.Mutex
+	counts  map[string]int
+	resetAt time.Time
+
+	Sender
+}
+
+// NewSamplingSender provides a Sender implementation that wraps an
+// existing Sender and only sends a sample of messages: a percentage of
+// the messages of each priority, the first messages of each kind in
+// an interval and then one in every so many of them, or all of the
+// messages for a percentage of the values of a field. Random choices
+// use the sometimes package. Messages in a group are sampled
+// individually.
+//
+// Each message that is sent in place of others is annotated with its
+// sample rate (see SampleRateKey), the number of messages that it
+// represents, so that counts can be reweighted downstream. Messages
+// that represent only themselves are not annotated. When a message
+// already has a sample rate, e.g. from another sampling sender, the
+// rate is multiplied by this sender's rate.
+//
+// Since the sampling sender owns the underlying Sender, calling Close
+// on this sender will close the underlying sender.
+func NewSamplingSender(sender Sender, opts SamplingOptions) (Sender, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &samplingSender{
+		opts:   opts,
+		counts: map[string]int{},
+		Sender: sender,
+	}, nil
+}
+
+func (s *samplingSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	if g, ok := m.(*message.GroupComposer); ok {
+		sampled := []message.Composer{}
+		for _, c := range g.Messages() {
+			if s.Level().ShouldLog(c) && s.sample(ctx, c) {
+				sampled = append(sampled, c)
+			}
+		}
+
+		switch len(sampled) {
+		case 0:
+		case len(g.Messages()):
+			s.Sender.Send(ctx, m)
+		default:
+			s.Sender.Send(ctx, message.NewGroupComposer(sampled))
+		}
+		return
+	}
+
+	if s.sample(ctx, m) {
+		s.Sender.Send(ctx, m)
+	}
+}
+
+// sample reports whether a message is kept, and annotates kept
+// messages that represent other messages with their sample rate.
+func (s *samplingSender) sample(ctx context.Context, m message.Composer) bool {
+	rate := 1.0
+
+	if percent, ok := s.opts.Percent[m.Priority()]; ok {
+		if !sometimes.Percent(percent) {
+			return false
+		}
+		rate *= 100 / float64(percent)
+	}
+
+	if s.opts.KeyField != "" {
+		if key, ok := messageAttributes(m)[s.opts.KeyField]; ok {
+			if !sometimes.KeyedPercent(fmt.Sprint(key), s.opts.KeyPercent) {
+				return false
+			}
+			rate *= 100 / float64(s.opts.KeyPercent)
+		}
+	}
+
+	if s.opts.First > 0 {
+		n := s.count(m)
+		if n > s.opts.First {
+			if s.opts.Thereafter == 0 || (n-s.opts.First)%s.opts.Thereafter != 0 {
+				return false
+			}
+			rate *= float64(s.opts.Thereafter)
+		}
+	}
+
+	if rate > 1 {
+		if err := setSampleRate(m, rate); err != nil {
+			s.ErrorHandler()(ctx, err, m)
+		}
+	}
+
+	return true
+}
+
+// setSampleRate annotates a message with a sample rate, or multiplies
+// the sample rate that the message already has. Existing rates are
+// replaced where they are stored: in the fields of message.Fields
+// payloads, or in the annotations of the message's metadata.
+func setSampleRate(m message.Composer, rate float64) error {
+	existing, ok := messageAttributes(m)[SampleRateKey]
+	if !ok {
+		return m.Annotate(SampleRateKey, rate)
+	}
+
+	prior, err := strconv.ParseFloat(fmt.Sprint(existing), 64)
+	if err != nil {
+		return fmt.Errorf("invalid existing sample rate '%v'", existing)
+	}
+	rate *= prior
+
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok && !isSelf(raw, m) {
+		raw = c.Raw()
+	}
+	if fields, ok := raw.(message.Fields); ok {
+		if _, ok := fields[SampleRateKey]; ok {
+			fields[SampleRateKey] = rate
+			return nil
+		}
+	}
+	if b := messageBase(raw); b != nil {
+		if _, ok := b.Context[SampleRateKey]; ok {
+			b.Context[SampleRateKey] = rate
+			return nil
+		}
+	}
+
+	return errors.New("cannot update the existing sample rate")
+}
+
+// messageBase returns the metadata of a Raw form, if it has any:
+// message.Fields payloads keep it in the "metadata" field, and
+// composers that are their own Raw form embed it.
+func messageBase(raw interface{}) *message.Base {
+	if fields, ok := raw.(message.Fields); ok {
+		b, _ := fields["metadata"].(*message.Base)
+		return b
+	}
+
+	v := reflect.ValueOf(raw)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field, ok := v.Elem().Type().FieldByName("Base")
+	if !ok || !field.Anonymous || field.Type != reflect.TypeOf(message.Base{}) {
+		return nil
+	}
+
+	return v.Elem().FieldByIndex(field.Index).Addr().Interface().(*message.Base)
+}
+
+// count returns the number of messages of the same kind in the current
+// interval, including this one.
+func (s *samplingSender) count(m message.Composer) int {
+	key := m.Priority().String() + "\x00" + m.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); !now.Before(s.resetAt) {
+		s.counts = map[string]int{}
+		s.resetAt = now.Add(s.opts.Interval)
+	}
+
+	s.counts[key]++
+	return s.counts[key]
+}
@@ -0,0 +1,185 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/sometimes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingSender(t *testing.T) {
+	newSamplingSender := func(t *testing.T, opts SamplingOptions) (Sender, *InternalSender) {
+		s, err := NewInternalLogger("sampled", LevelInfo{level.Debug, level.Debug})
+		require.NoError(t, err)
+
+		ss, err := NewSamplingSender(s, opts)
+		require.NoError(t, err)
+
+		return ss, s
+	}
+	drain := func(s *InternalSender) []message.Composer {
+		out := []message.Composer{}
+		for {
+			msg, ok := s.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg.Message)
+		}
+	}
+	sampleRate := func(m message.Composer) float64 {
+		rate, err := messageAttributes(m)[SampleRateKey].(json.Number).Float64()
+		require.NoError(t, err)
+		return rate
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []SamplingOptions{
+			{},
+			{Percent: map[level.Priority]int{level.Info: 101}},
+			{First: 1},
+			{Thereafter: 2},
+			{KeyPercent: 10},
+			{KeyField: "id", KeyPercent: -1},
+		} {
+			ss, err := NewSamplingSender(nil, opts)
+			assert.Error(t, err)
+			assert.Nil(t, ss)
+		}
+	})
+	t.Run("PerLevelPercent", func(t *testing.T) {
+		ss, s := newSamplingSender(t, SamplingOptions{Percent: map[level.Priority]int{
+			level.Debug: 0,
+			level.Info:  100,
+		}})
+
+		for i := 0; i < 10; i++ {
+			ss.Send(t.Context(), message.NewDefaultMessage(level.Debug, "dropped"))
+			ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "kept"))
+			ss.Send(t.Context(), message.NewDefaultMessage(level.Error, "unsampled"))
+		}
+		msgs := drain(s)
+		require.Len(t, msgs, 20)
+		for _, msg := range msgs {
+			assert.NotEqual(t, "dropped", msg.String())
+			assert.NotContains(t, messageAttributes(msg), SampleRateKey)
+		}
+	})
+	t.Run("FirstThenThereafter", func(t *testing.T) {
+		ss, s := newSamplingSender(t, SamplingOptions{First: 2, Thereafter: 3, Interval: time.Hour})
+
+		for i := 0; i < 10; i++ {
+			ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "repeated"))
+		}
+		ss.Send(t.Context(), message.NewDefaultMessage(level.Warning, "repeated"))
+
+		msgs := drain(s)
+		// The 1st, 2nd, 5th and 8th repeats, and the warning.
+		require.Len(t, msgs, 5)
+		assert.NotContains(t, messageAttributes(msgs[0]), SampleRateKey)
+		assert.NotContains(t, messageAttributes(msgs[1]), SampleRateKey)
+		assert.EqualValues(t, 3, sampleRate(msgs[2]))
+		assert.EqualValues(t, 3, sampleRate(msgs[3]))
+		assert.Equal(t, level.Warning, msgs[4].Priority())
+	})
+	t.Run("MultipliesExistingSampleRate", func(t *testing.T) {
+		ss, s := newSamplingSender(t, SamplingOptions{First: 1, Thereafter: 2, Interval: time.Hour})
+		var errs []error
+		require.NoError(t, ss.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+			errs = append(errs, err)
+		}))
+
+		for i := 0; i < 3; i++ {
+			ss.Send(t.Context(), message.NewFields(level.Info, message.Fields{"op": "read", SampleRateKey: 10}))
+		}
+
+		msgs := drain(s)
+		require.Len(t, msgs, 2)
+		assert.EqualValues(t, 10, sampleRate(msgs[0]), "messages that represent only themselves keep their rate")
+		assert.EqualValues(t, 20, sampleRate(msgs[1]))
+		assert.Empty(t, errs)
+	})
+	t.Run("ChainedSamplers", func(t *testing.T) {
+		for name, makeMessage := range map[string]func() message.Composer{
+			"Fields": func() message.Composer {
+				return message.NewFields(level.Info, message.Fields{"op": "read"})
+			},
+			"String": func() message.Composer { return message.NewDefaultMessage(level.Info, "read") },
+		} {
+			t.Run(name, func(t *testing.T) {
+				inner, s := newSamplingSender(t, SamplingOptions{First: 1, Thereafter: 3, Interval: time.Hour})
+				outer, err := NewSamplingSender(inner, SamplingOptions{First: 1, Thereafter: 2, Interval: time.Hour})
+				require.NoError(t, err)
+				var errs []error
+				require.NoError(t, outer.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+					errs = append(errs, err)
+				}))
+				require.NoError(t, inner.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) {
+					errs = append(errs, err)
+				}))
+
+				// The outer sampler passes messages 1, 3, 5
+				// and 7, each of the last three representing
+				// two messages, and the inner sampler passes
+				// the first and fourth of those.
+				for i := 0; i < 7; i++ {
+					outer.Send(t.Context(), makeMessage())
+				}
+
+				msgs := drain(s)
+				require.Len(t, msgs, 2)
+				assert.NotContains(t, messageAttributes(msgs[0]), SampleRateKey)
+				assert.EqualValues(t, 6, sampleRate(msgs[1]))
+				assert.Empty(t, errs)
+			})
+		}
+	})
+	t.Run("IntervalResetsCounts", func(t *testing.T) {
+		ss, s := newSamplingSender(t, SamplingOptions{First: 1, Interval: 20 * time.Millisecond})
+
+		ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "repeated"))
+		ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "repeated"))
+		assert.Len(t, drain(s), 1)
+
+		time.Sleep(30 * time.Millisecond)
+		ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "repeated"))
+		assert.Len(t, drain(s), 1)
+	})
+	t.Run("ConsistentKeySampling", func(t *testing.T) {
+		ss, s := newSamplingSender(t, SamplingOptions{KeyField: "request", KeyPercent: 25})
+
+		expected := 0
+		for i := 0; i < 100; i++ {
+			request := fmt.Sprintf("request-%d", i)
+			if sometimes.KeyedPercent(request, 25) {
+				expected += 2
+			}
+			ss.Send(t.Context(), message.MakeGroupComposer(
+				message.NewFields(level.Info, message.Fields{"request": request, "step": 1}),
+				message.NewFields(level.Info, message.Fields{"request": request, "step": 2}),
+			))
+		}
+
+		msgs := drain(s)
+		sent := 0
+		for _, msg := range msgs {
+			group := msg.(*message.GroupComposer)
+			require.Len(t, group.Messages(), 2, "related messages are kept together")
+			assert.EqualValues(t, 4, sampleRate(group.Messages()[0]))
+			sent += 2
+		}
+		assert.Equal(t, expected, sent)
+		assert.NotZero(t, sent)
+		assert.Less(t, sent, 200)
+
+		ss.Send(t.Context(), message.NewDefaultMessage(level.Info, "no key"))
+		assert.Len(t, drain(s), 1)
+	})
+}
@@ -0,0 +1,220 @@
+package send
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// Custom slog levels for the grip priorities that slog does not
+// define. The standard slog levels map to Debug, Info, Warning and
+// Error.
+const (
+	SlogLevelTrace     = slog.Level(-8)
+	SlogLevelNotice    = slog.Level(2)
+	SlogLevelCritical  = slog.Level(12)
+	SlogLevelAlert     = slog.Level(14)
+	SlogLevelEmergency = slog.Level(16)
+)
+
+// SlogLevelToPriority converts a slog level to a grip priority. Levels
+// between two defined levels map to the priority of the lower level.
+func SlogLevelToPriority(l slog.Level) level.Priority {
+	switch {
+	case l >= SlogLevelEmergency:
+		return level.Emergency
+	case l >= SlogLevelAlert:
+		return level.Alert
+	case l >= SlogLevelCritical:
+		return level.Critical
+	case l >= slog.LevelError:
+		return level.Error
+	case l >= slog.LevelWarn:
+		return level.Warning
+	case l >= SlogLevelNotice:
+		return level.Notice
+	case l >= slog.LevelInfo:
+		return level.Info
+	case l >= slog.LevelDebug:
+		return level.Debug
+	default:
+		return level.Trace
+	}
+}
+
+// PriorityToSlogLevel converts a grip priority to a slog level.
+func PriorityToSlogLevel(p level.Priority) slog.Level {
+	switch {
+	case p >= level.Emergency:
+		return SlogLevelEmergency
+	case p >= level.Alert:
+		return SlogLevelAlert
+	case p >= level.Critical:
+		return SlogLevelCritical
+	case p >= level.Error:
+		return slog.LevelError
+	case p >= level.Warning:
+		return slog.LevelWarn
+	case p >= level.Notice:
+		return SlogLevelNotice
+	case p >= level.Info:
+		return slog.LevelInfo
+	case p >= level.Debug:
+		return slog.LevelDebug
+	default:
+		return SlogLevelTrace
+	}
+}
+
+type slogHandler struct {
+	sender Sender
+	// fields are the attributes added with WithAttrs, with groups as
+	// nested maps. Handlers never modify them once they are shared.
+	fields message.Fields
+	// groups are the names of the open groups, from WithGroup, that
+	// the attributes of records belong to.
+	groups []string
+}
+
+// NewSlogHandler returns a slog.Handler that sends records to the
+// Sender as message.Fields, with the record message in the "message"
+// field and groups as nested maps. The level of a record is converted
+// with SlogLevelToPriority, and Enabled compares it to the threshold
+// of the Sender, so that calls below the threshold are cheap.
+//
+// The handler does not own the Sender, so users are responsible for
+// closing it.
+func NewSlogHandler(sender Sender) slog.Handler {
+	return &slogHandler{sender: sender}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return SlogLevelToPriority(l) >= h.sender.Level().Threshold
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(message.Fields, len(h.fields)+r.NumAttrs()+2)
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+
+	if r.NumAttrs() > 0 {
+		target := openSlogGroups(fields, h.groups)
+		r.Attrs(func(a slog.Attr) bool {
+			addSlogAttr(target, a)
+			return true
+		})
+	}
+
+	m := message.NewFieldsMessage(SlogLevelToPriority(r.Level), r.Message, fields)
+	if base, ok := fields["metadata"].(*message.Base); ok && !r.Time.IsZero() {
+		base.Time = r.Time
+	}
+
+	h.sender.Send(ctx, m)
+
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	fields := make(message.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	target := openSlogGroups(fields, h.groups)
+	for _, a := range attrs {
+		addSlogAttr(target, a)
+	}
+
+	return &slogHandler{
+		sender: h.sender,
+		fields: fields,
+		groups: h.groups,
+	}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := make([]string, len(h.groups), len(h.groups)+1)
+	copy(groups, h.groups)
+
+	return &slogHandler{
+		sender: h.sender,
+		fields: h.fields,
+		groups: append(groups, name),
+	}
+}
+
+// openSlogGroups returns the map for the innermost of the groups in
+// the fields, copying the maps of the groups that already exist, since
+// they may be shared with other handlers, and creating the others.
+func openSlogGroups(fields message.Fields, groups []string) message.Fields {
+	target := fields
+	for _, name := range groups {
+		existing, _ := target[name].(message.Fields)
+		group := make(message.Fields, len(existing)+1)
+		for k, v := range existing {
+			group[k] = v
+		}
+		target[name] = group
+		target = group
+	}
+
+	return target
+}
+
+// addSlogAttr adds the attribute to the fields, following the slog
+// conventions: empty attributes and groups are ignored, and groups
+// without a key are inlined.
+func addSlogAttr(fields message.Fields, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		fields[a.Key] = slogValue(a.Value)
+		return
+	}
+
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+	if a.Key == "" {
+		for _, ga := range attrs {
+			addSlogAttr(fields, ga)
+		}
+		return
+	}
+
+	// the existing group may be shared with other handlers.
+	existing, _ := fields[a.Key].(message.Fields)
+	group := make(message.Fields, len(existing)+len(attrs))
+	for k, v := range existing {
+		group[k] = v
+	}
+	fields[a.Key] = group
+	for _, ga := range attrs {
+		addSlogAttr(group, ga)
+	}
+}
+
+// slogValue converts a resolved slog value to a field value. Errors
+// are converted to their messages, since most of them do not marshal.
+func slogValue(v slog.Value) interface{} {
+	if err, ok := v.Any().(error); ok && v.Kind() == slog.KindAny {
+		return err.Error()
+	}
+
+	return v.Any()
+}
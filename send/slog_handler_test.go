@@ -0,0 +1,112 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogLevels(t *testing.T) {
+	for l, p := range map[slog.Level]level.Priority{
+		SlogLevelTrace:     level.Trace,
+		slog.LevelDebug:    level.Debug,
+		slog.LevelInfo:     level.Info,
+		SlogLevelNotice:    level.Notice,
+		slog.LevelWarn:     level.Warning,
+		slog.LevelError:    level.Error,
+		SlogLevelCritical:  level.Critical,
+		SlogLevelAlert:     level.Alert,
+		SlogLevelEmergency: level.Emergency,
+	} {
+		assert.Equal(t, p, SlogLevelToPriority(l))
+		assert.Equal(t, l, PriorityToSlogLevel(p))
+	}
+	assert.Equal(t, level.Info, SlogLevelToPriority(slog.LevelInfo+1))
+	assert.Equal(t, level.Trace, SlogLevelToPriority(slog.Level(-100)))
+	assert.Equal(t, level.Emergency, SlogLevelToPriority(slog.Level(100)))
+}
+
+func TestSlogHandler(t *testing.T) {
+	newLogger := func(t *testing.T) (*slog.Logger, *InternalSender) {
+		internal, err := NewInternalLogger("internal", LevelInfo{level.Info, level.Info})
+		require.NoError(t, err)
+		return slog.New(NewSlogHandler(internal)), internal
+	}
+	fields := func(t *testing.T, s *InternalSender) message.Fields {
+		require.True(t, s.HasMessage())
+		f, ok := s.GetMessage().Message.Raw().(message.Fields)
+		require.True(t, ok)
+		return f
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		logger, internal := newLogger(t)
+		assert.False(t, logger.Enabled(t.Context(), slog.LevelDebug))
+		assert.True(t, logger.Enabled(t.Context(), slog.LevelInfo))
+
+		require.NoError(t, internal.SetLevel(LevelInfo{level.Trace, level.Trace}))
+		assert.True(t, logger.Enabled(t.Context(), SlogLevelTrace))
+
+		logger.Debug("hello")
+		assert.True(t, internal.HasMessage())
+	})
+	t.Run("Records", func(t *testing.T) {
+		logger, internal := newLogger(t)
+		now := time.Now().Add(-time.Hour)
+
+		logger.Log(t.Context(), SlogLevelCritical, "failed", "count", 3, "err", errors.New("boom"), slog.Group("empty"))
+		msg := internal.GetMessage()
+		assert.Equal(t, level.Critical, msg.Priority)
+		f := msg.Message.Raw().(message.Fields)
+		assert.Equal(t, "failed", f[message.FieldsMsgName])
+		assert.EqualValues(t, 3, f["count"])
+		assert.Equal(t, "boom", f["err"])
+		assert.NotContains(t, f, "empty")
+
+		r := slog.NewRecord(now, slog.LevelInfo, "at", 0)
+		require.NoError(t, logger.Handler().Handle(t.Context(), r))
+		assert.Equal(t, now, fields(t, internal)["metadata"].(*message.Base).Time)
+	})
+	t.Run("Groups", func(t *testing.T) {
+		logger, internal := newLogger(t)
+		req := logger.With("service", "api").WithGroup("request").With("id", "abc")
+		user := req.WithGroup("user")
+
+		user.Info("hello", "name", "ann", slog.Group("", slog.Int("age", 30)))
+		f := fields(t, internal)
+		assert.Equal(t, "api", f["service"])
+		request := f["request"].(message.Fields)
+		assert.Equal(t, "abc", request["id"])
+		assert.Equal(t, message.Fields{"name": "ann", "age": int64(30)}, request["user"])
+
+		req.Info("again", slog.Group("extra", "k", "v"))
+		f = fields(t, internal)
+		assert.Equal(t, message.Fields{"id": "abc", "extra": message.Fields{"k": "v"}}, f["request"], "derived handlers do not share record attributes")
+
+		user.Info("no attrs")
+		f = fields(t, internal)
+		assert.Equal(t, message.Fields{"id": "abc"}, f["request"], "groups without attributes are omitted")
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		logger, internal := newLogger(t)
+		logger = logger.WithGroup("g").With("a", 1)
+		done := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			go func(i int) {
+				defer func() { done <- struct{}{} }()
+				logger.InfoContext(context.Background(), "msg", "i", i)
+			}(i)
+		}
+		for i := 0; i < 8; i++ {
+			<-done
+		}
+		assert.Equal(t, 8, internal.Len())
+	})
+}
@@ -0,0 +1,124 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+type slogSender struct {
+	handler slog.Handler
+	*Base
+}
+
+// NewSlogSender returns a Sender that writes messages as records to a
+// slog.Handler, so that messages logged through grip end up in an
+// application's configured slog handler. Priorities are converted to
+// levels with PriorityToSlogLevel, the fields of message.Fields
+// messages and the annotations of other messages become attributes,
+// and the call site of the stack trace captured by the message.Stack
+// composers becomes the source attribute. The members of a
+// GroupComposer are written as separate records.
+//
+// The sender has the default name and its threshold and default levels
+// are Trace; use SetName and SetLevel to configure them.
+func NewSlogSender(h slog.Handler) Sender {
+	s := &slogSender{
+		handler: h,
+		Base:    NewBase(""),
+	}
+	_ = s.SetLevel(LevelInfo{Default: level.Trace, Threshold: level.Trace})
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	return s
+}
+
+func (s *slogSender) Send(ctx context.Context, m message.Composer) {
+	if g, ok := m.(*message.GroupComposer); ok {
+		for _, c := range g.Messages() {
+			s.Send(ctx, c)
+		}
+		return
+	}
+
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	l := PriorityToSlogLevel(m.Priority())
+	if !s.handler.Enabled(ctx, l) {
+		return
+	}
+
+	if err := s.handler.Handle(ctx, slogRecord(m, l)); err != nil {
+		s.ErrorHandler()(ctx, err, m)
+	}
+}
+
+// slogRecord converts a message to a slog record.
+func slogRecord(m message.Composer, l slog.Level) slog.Record {
+	frames, attrs := messageStack(m)
+
+	raw := m.Raw()
+	if c, ok := raw.(message.Composer); ok {
+		raw = c.Raw()
+	}
+
+	msg := m.String()
+	ts := time.Now()
+	switch payload := raw.(type) {
+	case message.Fields:
+		msg = ""
+		if value, ok := payload[message.FieldsMsgName]; ok {
+			msg = fmt.Sprint(value)
+		}
+		if md, ok := payload["metadata"].(*message.Base); ok && !md.Time.IsZero() {
+			ts = md.Time
+		}
+		// use the original values of the fields rather than the
+		// values normalized through JSON.
+		for k := range attrs {
+			if value, ok := payload[k]; ok {
+				attrs[k] = value
+			}
+		}
+	case message.StackTrace:
+		if c, ok := payload.Context.(message.Composer); ok {
+			msg = c.String()
+		}
+	}
+
+	r := slog.NewRecord(ts, l, msg, 0)
+	if len(frames) > 0 {
+		r.AddAttrs(slog.Any(slog.SourceKey, &slog.Source{
+			Function: frames[0].Function,
+			File:     frames[0].File,
+			Line:     frames[0].Line,
+		}))
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.AddAttrs(slog.Any(k, attrs[k]))
+	}
+
+	return r
+}
+
+func (s *slogSender) Flush(_ context.Context) error { return nil }
@@ -0,0 +1,116 @@
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogSender(t *testing.T) {
+	newSlogSender := func(t *testing.T, l slog.Level) (Sender, *bytes.Buffer) {
+		buf := &bytes.Buffer{}
+		return NewSlogSender(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: l})), buf
+	}
+	records := func(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+		out := []map[string]interface{}{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			record := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			out = append(out, record)
+		}
+		buf.Reset()
+		return out
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		s, buf := newSlogSender(t, SlogLevelTrace)
+		s.Send(t.Context(), message.NewFieldsMessage(level.Error, "failed", message.Fields{"count": 3, "op": "insert"}))
+
+		out := records(t, buf)
+		require.Len(t, out, 1)
+		assert.Equal(t, "failed", out[0][slog.MessageKey])
+		assert.Equal(t, "ERROR", out[0][slog.LevelKey])
+		assert.EqualValues(t, 3, out[0]["count"])
+		assert.Equal(t, "insert", out[0]["op"])
+		assert.NotContains(t, out[0], "metadata")
+	})
+	t.Run("LevelsAndAnnotations", func(t *testing.T) {
+		s, buf := newSlogSender(t, SlogLevelTrace)
+		m := message.NewDefaultMessage(level.Emergency, "down")
+		require.NoError(t, m.Annotate("host", "db1"))
+		s.Send(t.Context(), m)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Trace, "details"))
+
+		out := records(t, buf)
+		require.Len(t, out, 2)
+		assert.Equal(t, "down", out[0][slog.MessageKey])
+		assert.Equal(t, "ERROR+8", out[0][slog.LevelKey])
+		assert.Equal(t, "db1", out[0]["host"])
+		assert.Equal(t, "DEBUG-4", out[1][slog.LevelKey])
+	})
+	t.Run("Filtering", func(t *testing.T) {
+		s, buf := newSlogSender(t, slog.LevelWarn)
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "handler filtered"))
+		require.NoError(t, s.SetLevel(LevelInfo{Default: level.Info, Threshold: level.Error}))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Warning, "sender filtered"))
+		assert.Empty(t, records(t, buf))
+	})
+	t.Run("StackSource", func(t *testing.T) {
+		s, buf := newSlogSender(t, SlogLevelTrace)
+		m := message.WrapStack(1, message.Fields{"message": "with stack", "key": "value"})
+		require.NoError(t, m.SetPriority(level.Error))
+		s.Send(t.Context(), m)
+		m = message.NewStack(1, "plain stack")
+		require.NoError(t, m.SetPriority(level.Error))
+		s.Send(t.Context(), m)
+
+		out := records(t, buf)
+		require.Len(t, out, 2)
+		assert.Equal(t, "with stack", out[0][slog.MessageKey])
+		assert.Equal(t, "value", out[0]["key"])
+		assert.NotContains(t, out[0], stackFramesKey)
+		assert.Equal(t, "plain stack", out[1][slog.MessageKey])
+		for _, record := range out {
+			source, ok := record[slog.SourceKey].(map[string]interface{})
+			require.True(t, ok)
+			assert.Contains(t, source["file"], "slog_sender_test.go")
+			assert.Contains(t, source["function"], "TestSlogSender")
+		}
+	})
+	t.Run("Groups", func(t *testing.T) {
+		s, buf := newSlogSender(t, slog.LevelInfo)
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+			message.NewErrorMessage(level.Error, errors.New("two")),
+		))
+
+		out := records(t, buf)
+		require.Len(t, out, 2)
+		assert.Equal(t, "one", out[0][slog.MessageKey])
+		assert.Equal(t, "two", out[1][slog.MessageKey])
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		internal, err := NewInternalLogger("internal", LevelInfo{level.Trace, level.Trace})
+		require.NoError(t, err)
+		s := NewSlogSender(NewSlogHandler(internal))
+		s.Send(t.Context(), message.NewFieldsMessage(level.Notice, "hello", message.Fields{"key": "value"}))
+
+		msg := internal.GetMessage()
+		assert.Equal(t, level.Notice, msg.Priority)
+		fields := msg.Message.Raw().(message.Fields)
+		assert.Equal(t, "hello", fields[message.FieldsMsgName])
+		assert.Equal(t, "value", fields["key"])
+	})
+}
@@ -0,0 +1,758 @@
+package send
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+const (
+	defaultSpoolSegmentSize   = 8 * 1024 * 1024
+	defaultSpoolMaxDiskUsage  = 256 * 1024 * 1024
+	defaultSpoolMinRetryDelay = 100 * time.Millisecond
+	defaultSpoolMaxRetryDelay = time.Minute
+	spoolCursorInterval       = time.Second
+
+	spoolSegmentExt  = ".wal"
+	spoolCursorFile  = "cursor"
+	spoolHeaderSize  = 8
+	spoolMaxRecord   = 64 * 1024 * 1024
+	spoolFilePerms   = 0600
+	spoolFolderPerms = 0700
+)
+
+// SpoolOverflowPolicy is what the spool does with messages when it
+// reaches its maximum disk usage.
+type SpoolOverflowPolicy string
+
+const (
+	// SpoolDropOldest deletes the oldest segments of the spool,
+	// including any undelivered messages in them, to make room for
+	// new messages.
+	SpoolDropOldest SpoolOverflowPolicy = "drop-oldest"
+	// SpoolDropNewest drops new messages until there is room in
+	// the spool.
+	SpoolDropNewest SpoolOverflowPolicy = "drop-newest"
+)
+
+// SpoolOptions configure the disk-backed spool.
+type SpoolOptions struct {
+	// Directory is where the spool stores its segments. It is
+	// created if it does not exist, and must not be shared with
+	// other spools.
+	Directory string `bson:"directory" json:"directory" yaml:"directory"`
+	// SegmentSize is the size in bytes at which the spool starts a
+	// new segment file. Defaults to 8 MiB.
+	SegmentSize int64 `bson:"segment_size" json:"segment_size" yaml:"segment_size"`
+	// MaxDiskUsage is the maximum total size in bytes of the
+	// segments. Defaults to 256 MiB, and must be at least twice
+	// the segment size.
+	MaxDiskUsage int64 `bson:"max_disk_usage" json:"max_disk_usage" yaml:"max_disk_usage"`
+	// Overflow is what to do when the spool is full. Defaults to
+	// SpoolDropOldest.
+	Overflow SpoolOverflowPolicy `bson:"overflow" json:"overflow" yaml:"overflow"`
+	// MinRetryDelay is the delay before retrying a message that
+	// failed to send, which doubles after every failure. Defaults
+	// to 100 milliseconds.
+	MinRetryDelay time.Duration `bson:"min_retry_delay" json:"min_retry_delay" yaml:"min_retry_delay"`
+	// MaxRetryDelay caps the delay between retries. Defaults to 1
+	// minute.
+	MaxRetryDelay time.Duration `bson:"max_retry_delay" json:"max_retry_delay" yaml:"max_retry_delay"`
+	// Sync, if true, syncs the spool to disk after every message,
+	// so that messages survive a crash of the host and not only of
+	// the process, at the expense of throughput.
+	Sync bool `bson:"sync" json:"sync" yaml:"sync"`
+}
+
+// Validate ensures that the options are valid and sets the defaults.
+func (opts *SpoolOptions) Validate() error {
+	catcher := []string{}
+	if opts.Directory == "" {
+		catcher = append(catcher, "must specify a directory")
+	}
+	if opts.SegmentSize < 0 {
+		catcher = append(catcher, "segment size cannot be negative")
+	}
+	if opts.MaxDiskUsage < 0 {
+		catcher = append(catcher, "max disk usage cannot be negative")
+	}
+	if opts.MinRetryDelay < 0 || opts.MaxRetryDelay < 0 {
+		catcher = append(catcher, "retry delays cannot be negative")
+	}
+	switch opts.Overflow {
+	case "":
+		opts.Overflow = SpoolDropOldest
+	case SpoolDropOldest, SpoolDropNewest:
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid overflow policy '%s'", opts.Overflow))
+	}
+
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = defaultSpoolSegmentSize
+	}
+	if opts.MaxDiskUsage == 0 {
+		opts.MaxDiskUsage = defaultSpoolMaxDiskUsage
+	}
+	if opts.MaxDiskUsage < 2*opts.SegmentSize {
+		catcher = append(catcher, "max disk usage must be at least twice the segment size")
+	}
+	if opts.MinRetryDelay == 0 {
+		opts.MinRetryDelay = defaultSpoolMinRetryDelay
+	}
+	if opts.MaxRetryDelay == 0 {
+		opts.MaxRetryDelay = defaultSpoolMaxRetryDelay
+	}
+	if opts.MaxRetryDelay < opts.MinRetryDelay {
+		opts.MaxRetryDelay = opts.MinRetryDelay
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+// spoolRecord is the form in which messages are stored in the spool.
+type spoolRecord struct {
+	Priority level.Priority  `json:"priority"`
+	Message  string          `json:"message"`
+	Raw      json.RawMessage `json:"raw,omitempty"`
+}
+
+// spoolPosition identifies a record in the spool.
+type spoolPosition struct {
+	segment uint64
+	offset  int64
+}
+
+type spoolSender struct {
+	opts   SpoolOptions
+	sender Sender
+	errors int64
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	notify chan struct{}
+
+	// The remaining fields are protected by the lock.
+	mu       sync.Mutex
+	segments []uint64
+	sizes    map[uint64]int64
+	usage    int64
+	writer   *os.File
+	read     spoolPosition
+	reader   *os.File
+	closed   bool
+	// cursorSaved is when the cursor was last written, and
+	// cursorDirty is set when the read position moved since.
+	cursorSaved time.Time
+	cursorDirty bool
+	// reports are errors for the error handler, which is called
+	// without holding the lock.
+	reports []error
+
+	*Base
+}
+
+// NewSpoolSender provides a Sender implementation that wraps an
+// existing Sender with a durable queue: each message is appended to a
+// write-ahead log on disk before Send returns, and a background
+// goroutine delivers the logged messages to the underlying Sender in
+// order, retrying with exponential backoff when it fails. Messages
+// that were not delivered when the process stopped are delivered when
+// a spool is created again with the same directory, so messages are
+// delivered at least once. The position of the delivered messages is
+// saved at most once a second, and when the spool is idle or closed,
+// so messages delivered shortly before a crash are delivered again.
+//
+// The log is stored in segment files, which are deleted once all of
+// their messages are delivered. When the segments reach the maximum
+// disk usage, the overflow policy either drops whole segments,
+// starting with the oldest, or drops new messages.
+//
+// Messages are stored in their Raw form, with their priority and string
+// form, so the underlying Sender receives equivalent composers rather
+// than the original ones. Messages in a group are stored and delivered
+// individually.
+//
+// The spool detects failures with the error handler of the underlying
+// Sender, which it replaces: a message fails if the error handler is
+// called while sending it. These errors, and the errors of the spool
+// itself, are passed to the error handler of the spool, which logs to
+// standard output by default.
+//
+// This Sender does not own the underlying Sender, so users are responsible for
+// closing the underlying Sender if/when it is appropriate to release its
+// resources.
+func NewSpoolSender(ctx context.Context, sender Sender, opts SpoolOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if sender == nil {
+		return nil, errors.New("must specify a sender")
+	}
+
+	s := &spoolSender{
+		opts:   opts,
+		sender: sender,
+		done:   make(chan struct{}),
+		notify: make(chan struct{}, 1),
+		sizes:  map[uint64]int64{},
+		Base:   NewBase(sender.Name()),
+	}
+	if err := s.Base.SetLevel(sender.Level()); err != nil {
+		return nil, fmt.Errorf("invalid level of sender: %w", err)
+	}
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+	s.reset()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	if err := sender.SetErrorHandler(func(ctx context.Context, err error, m message.Composer) {
+		if err == nil {
+			return
+		}
+		s.mu.Lock()
+		s.errors++
+		s.mu.Unlock()
+		s.ErrorHandler()(ctx, err, m)
+	}); err != nil {
+		return nil, fmt.Errorf("replacing error handler of sender: %w", err)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	go s.deliver()
+
+	return s, nil
+}
+
+// open loads the existing segments and the cursor from the directory
+// and starts a new segment for writing.
+func (s *spoolSender) open() error {
+	if err := os.MkdirAll(s.opts.Directory, spoolFolderPerms); err != nil {
+		return fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(s.opts.Directory)
+	if err != nil {
+		return fmt.Errorf("reading spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("reading segment '%s': %w", name, err)
+		}
+		s.segments = append(s.segments, seq)
+		s.sizes[seq] = info.Size()
+		s.usage += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	cursor, err := s.readCursor()
+	if err != nil {
+		return err
+	}
+	for len(s.segments) > 0 && s.segments[0] < cursor.segment {
+		if err := s.removeSegment(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	if len(s.segments) > 0 {
+		s.read = spoolPosition{segment: s.segments[0]}
+		if s.segments[0] == cursor.segment {
+			s.read.offset = cursor.offset
+		}
+	}
+
+	// Always start a new segment, rather than appending after a
+	// record that may have been partially written by a crash.
+	next := cursor.segment + 1
+	if len(s.segments) > 0 && s.segments[len(s.segments)-1] >= next {
+		next = s.segments[len(s.segments)-1] + 1
+	}
+	if err := s.startSegment(next); err != nil {
+		return err
+	}
+	if len(s.segments) == 1 {
+		s.read = spoolPosition{segment: next}
+	}
+
+	return nil
+}
+
+func (s *spoolSender) segmentPath(seq uint64) string {
+	return filepath.Join(s.opts.Directory, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// startSegment creates a new segment and makes it the segment that
+// messages are appended to. The caller must hold the lock, except
+// while opening the spool.
+func (s *spoolSender) startSegment(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, spoolFilePerms)
+	if err != nil {
+		return fmt.Errorf("creating spool segment: %w", err)
+	}
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("closing spool segment: %w", err)
+		}
+	}
+
+	s.writer = f
+	s.segments = append(s.segments, seq)
+	s.sizes[seq] = 0
+
+	return nil
+}
+
+// removeSegment deletes a segment. The caller must hold the lock,
+// except while opening the spool.
+func (s *spoolSender) removeSegment(seq uint64) error {
+	if s.reader != nil && s.read.segment == seq {
+		_ = s.reader.Close()
+		s.reader = nil
+	}
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing spool segment: %w", err)
+	}
+
+	for idx, segment := range s.segments {
+		if segment == seq {
+			s.segments = append(s.segments[:idx], s.segments[idx+1:]...)
+			break
+		}
+	}
+	s.usage -= s.sizes[seq]
+	delete(s.sizes, seq)
+
+	if s.read.segment == seq && len(s.segments) > 0 {
+		s.read = spoolPosition{segment: s.segments[0]}
+	}
+
+	return nil
+}
+
+func (s *spoolSender) readCursor() (spoolPosition, error) {
+	data, err := os.ReadFile(filepath.Join(s.opts.Directory, spoolCursorFile))
+	if os.IsNotExist(err) {
+		return spoolPosition{}, nil
+	}
+	if err != nil {
+		return spoolPosition{}, fmt.Errorf("reading spool cursor: %w", err)
+	}
+
+	var pos spoolPosition
+	if _, err := fmt.Sscanf(string(data), "%d %d", &pos.segment, &pos.offset); err != nil {
+		return spoolPosition{}, fmt.Errorf("parsing spool cursor: %w", err)
+	}
+
+	return pos, nil
+}
+
+// saveCursor writes the cursor if the read position moved since it was
+// last written, and force is set or the cursor interval passed. The
+// caller must hold the lock.
+func (s *spoolSender) saveCursor(force bool) {
+	if !s.cursorDirty || (!force && time.Since(s.cursorSaved) < spoolCursorInterval) {
+		return
+	}
+
+	if err := s.writeCursor(); err != nil {
+		s.report(err)
+		return
+	}
+	s.cursorDirty = false
+	s.cursorSaved = time.Now()
+}
+
+// writeCursor records the position of the next message to deliver. The
+// caller must hold the lock.
+func (s *spoolSender) writeCursor() error {
+	path := filepath.Join(s.opts.Directory, spoolCursorFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, spoolFilePerms)
+	if err != nil {
+		return fmt.Errorf("writing spool cursor: %w", err)
+	}
+	_, err = fmt.Fprintf(f, "%d %d\n", s.read.segment, s.read.offset)
+	if err == nil && s.opts.Sync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing spool cursor: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing spool cursor: %w", err)
+	}
+
+	return nil
+}
+
+// Send appends the message to the spool, to be delivered in the
+// background.
+func (s *spoolSender) Send(ctx context.Context, m message.Composer) {
+	if !s.Level().ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	for _, c := range msgs {
+		if !s.Level().ShouldLog(c) {
+			continue
+		}
+		if err := s.append(c); err != nil {
+			s.ErrorHandler()(ctx, err, c)
+		}
+	}
+	s.reportErrors(ctx)
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spoolSender) append(m message.Composer) error {
+	rec := spoolRecord{Priority: m.Priority(), Message: m.String()}
+	if raw := m.Raw(); raw != nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("encoding message for the spool: %w", err)
+		}
+		rec.Raw = data
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding message for the spool: %w", err)
+	}
+
+	size := int64(spoolHeaderSize + len(payload))
+	if size > s.opts.SegmentSize || len(payload) > spoolMaxRecord {
+		return errors.New("the message was dropped because it is larger than a spool segment")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("the spool is closed")
+	}
+
+	seq := s.segments[len(s.segments)-1]
+	if s.sizes[seq]+size > s.opts.SegmentSize {
+		if err := s.startSegment(seq + 1); err != nil {
+			return err
+		}
+		seq++
+	}
+
+	for s.usage+size > s.opts.MaxDiskUsage {
+		if s.opts.Overflow == SpoolDropNewest || len(s.segments) == 1 {
+			return errors.New("the message was dropped because the spool is full")
+		}
+		oldest := s.segments[0]
+		if err := s.removeSegment(oldest); err != nil {
+			return err
+		}
+		s.report(fmt.Errorf("dropped spool segment %d with undelivered messages because the spool is full", oldest))
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[spoolHeaderSize:], payload)
+
+	n, err := s.writer.Write(buf)
+	s.sizes[seq] += int64(n)
+	s.usage += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing message to the spool: %w", err)
+	}
+	if s.opts.Sync {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("syncing the spool: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deliver sends the spooled messages to the underlying sender until
+// the spool is closed.
+func (s *spoolSender) deliver() {
+	defer close(s.done)
+
+	delay := s.opts.MinRetryDelay
+	for {
+		rec, pos, size, ok := s.next()
+		s.reportErrors(s.ctx)
+		if !ok {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.notify:
+				continue
+			}
+		}
+
+		s.mu.Lock()
+		before := s.errors
+		s.mu.Unlock()
+
+		var raw interface{}
+		if len(rec.Raw) > 0 {
+			_ = json.Unmarshal(rec.Raw, &raw)
+		}
+		s.sender.Send(s.ctx, newDocumentMessage(rec.Priority, rec.Message, raw))
+
+		s.mu.Lock()
+		failed := s.errors != before
+		if !failed {
+			s.advance(pos, size)
+		}
+		s.mu.Unlock()
+		s.reportErrors(s.ctx)
+
+		if !failed {
+			delay = s.opts.MinRetryDelay
+			continue
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay *= 2
+		if delay > s.opts.MaxRetryDelay {
+			delay = s.opts.MaxRetryDelay
+		}
+	}
+}
+
+// next returns the next record to deliver, its position and its size,
+// or false if there are none, in which case the cursor is saved.
+func (s *spoolSender) next() (spoolRecord, spoolPosition, int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.closed || len(s.segments) == 0 {
+			return spoolRecord{}, spoolPosition{}, 0, false
+		}
+		pos := s.read
+		current := pos.segment == s.segments[len(s.segments)-1]
+		if current && pos.offset >= s.sizes[pos.segment] {
+			s.saveCursor(true)
+			return spoolRecord{}, spoolPosition{}, 0, false
+		}
+
+		payload, err := s.readRecord(pos)
+		if err == nil {
+			var rec spoolRecord
+			if err = json.Unmarshal(payload, &rec); err == nil {
+				return rec, pos, int64(spoolHeaderSize + len(payload)), true
+			}
+		}
+
+		// Segments other than the current one are complete, so
+		// an error at the end of one means that the process
+		// stopped while writing it and the segment is done.
+		if !current && !errors.Is(err, io.EOF) {
+			s.report(fmt.Errorf("skipping the rest of spool segment %d: %w", pos.segment, err))
+		}
+		if current {
+			s.report(fmt.Errorf("skipping corrupt record in spool segment %d: %w", pos.segment, err))
+			s.read.offset = s.sizes[pos.segment]
+			s.cursorDirty = true
+			continue
+		}
+		if err := s.removeSegment(pos.segment); err != nil {
+			s.report(err)
+			return spoolRecord{}, spoolPosition{}, 0, false
+		}
+		s.cursorDirty = true
+	}
+}
+
+// readRecord reads the record at a position. The caller must hold the
+// lock.
+func (s *spoolSender) readRecord(pos spoolPosition) ([]byte, error) {
+	if s.reader == nil {
+		f, err := os.Open(s.segmentPath(pos.segment))
+		if err != nil {
+			return nil, err
+		}
+		s.reader = f
+	}
+
+	var header [spoolHeaderSize]byte
+	if _, err := s.reader.ReadAt(header[:], pos.offset); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > spoolMaxRecord {
+		return nil, errors.New("invalid record length")
+	}
+
+	payload := make([]byte, length)
+	if _, err := s.reader.ReadAt(payload, pos.offset+spoolHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("invalid record checksum")
+	}
+
+	return payload, nil
+}
+
+// advance moves the read position past a delivered record, unless the
+// record was dropped in the meantime, and deletes the segment if it is
+// done. The cursor is saved when a segment is deleted or the cursor
+// interval passed. The caller must hold the lock.
+func (s *spoolSender) advance(pos spoolPosition, size int64) {
+	if s.read != pos {
+		return
+	}
+	s.read.offset += size
+	s.cursorDirty = true
+
+	removed := false
+	if s.read.offset >= s.sizes[pos.segment] && pos.segment != s.segments[len(s.segments)-1] {
+		if err := s.removeSegment(pos.segment); err != nil {
+			s.report(err)
+		}
+		removed = true
+	}
+
+	s.saveCursor(removed)
+}
+
+// report queues an error for the error handler, so that it is called
+// once the lock is released: error handlers may send messages, which
+// would deadlock if they were sent to the spool while it holds the
+// lock. The caller must hold the lock.
+func (s *spoolSender) report(err error) {
+	s.reports = append(s.reports, err)
+}
+
+// reportErrors passes the queued errors to the error handler. The
+// caller must not hold the lock.
+func (s *spoolSender) reportErrors(ctx context.Context) {
+	s.mu.Lock()
+	reports := s.reports
+	s.reports = nil
+	s.mu.Unlock()
+
+	for _, err := range reports {
+		s.ErrorHandler()(ctx, err, message.NewString(""))
+	}
+}
+
+// Flush waits until the spooled messages are delivered or the context
+// is canceled, and flushes the underlying Sender. Since the spool
+// retries failed messages until they are delivered, Flush waits for
+// as long as the underlying Sender fails, so use a context with a
+// deadline unless waiting indefinitely is intended.
+func (s *spoolSender) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		empty := s.closed || s.read.segment == s.segments[len(s.segments)-1] && s.read.offset >= s.sizes[s.read.segment]
+		s.mu.Unlock()
+		if empty {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return s.sender.Flush(ctx)
+}
+
+// Close stops delivering messages and closes the spool. Undelivered
+// messages remain on disk, to be delivered by the next spool with the
+// same directory. This does not close the underlying sender.
+func (s *spoolSender) Close() error {
+	s.cancel()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	errs := []string{}
+	if s.cursorDirty {
+		if err := s.writeCursor(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if s.reader != nil {
+		if err := s.reader.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := s.writer.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
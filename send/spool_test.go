@@ -0,0 +1,217 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolSender(t *testing.T) {
+	newSpool := func(t *testing.T, sender Sender, opts SpoolOptions) Sender {
+		opts.MinRetryDelay = time.Millisecond
+		opts.MaxRetryDelay = 10 * time.Millisecond
+		s, err := NewSpoolSender(t.Context(), sender, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	}
+	drain := func(s *InternalSender) []message.Composer {
+		out := []message.Composer{}
+		for {
+			msg, ok := s.GetMessageSafe()
+			if !ok {
+				return out
+			}
+			out = append(out, msg.Message)
+		}
+	}
+	flush := func(t *testing.T, s Sender) {
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, s.Flush(ctx))
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []SpoolOptions{
+			{},
+			{Directory: t.TempDir(), SegmentSize: -1},
+			{Directory: t.TempDir(), SegmentSize: 1024, MaxDiskUsage: 1024},
+			{Directory: t.TempDir(), Overflow: "drop-everything"},
+		} {
+			s, err := NewSpoolSender(t.Context(), newFlakySender(t, "spool"), opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("DeliversMessages", func(t *testing.T) {
+		sender := newFlakySender(t, "spool")
+		dir := t.TempDir()
+		s := newSpool(t, sender, SpoolOptions{Directory: dir, SegmentSize: 512, MaxDiskUsage: 1024 * 1024})
+		assert.Equal(t, "spool", s.Name())
+
+		for i := 0; i < 20; i++ {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, fmt.Sprintf("message %d", i)))
+		}
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewFields(level.Error, message.Fields{"id": 1}),
+			message.NewFields(level.Error, message.Fields{"id": 2}),
+		))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Trace, "filtered"))
+		flush(t, s)
+
+		msgs := drain(sender.InternalSender)
+		require.Len(t, msgs, 22)
+		for i := 0; i < 20; i++ {
+			assert.Equal(t, fmt.Sprintf("message %d", i), msgs[i].String())
+			assert.Equal(t, level.Info, msgs[i].Priority())
+		}
+		assert.Equal(t, level.Error, msgs[21].Priority())
+		assert.EqualValues(t, 2, msgs[21].Raw().(map[string]interface{})["id"])
+		require.NoError(t, msgs[21].Annotate("extra", true))
+		assert.Error(t, msgs[21].Annotate("id", 3))
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+		require.NoError(t, err)
+		assert.Len(t, segments, 1, "delivered segments are removed")
+	})
+	t.Run("RetriesFailedMessages", func(t *testing.T) {
+		sender := newFlakySender(t, "spool")
+		sender.failing.Store(true)
+		s := newSpool(t, sender, SpoolOptions{Directory: t.TempDir()})
+		var mu sync.Mutex
+		reported := 0
+		require.NoError(t, s.SetErrorHandler(func(context.Context, error, message.Composer) {
+			mu.Lock()
+			reported++
+			mu.Unlock()
+		}))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "first"))
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "second"))
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return reported >= 3
+		}, 5*time.Second, time.Millisecond)
+		assert.Zero(t, sender.Len())
+
+		sender.failing.Store(false)
+		flush(t, s)
+		msgs := drain(sender.InternalSender)
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "first", msgs[0].String())
+		assert.Equal(t, "second", msgs[1].String())
+	})
+	t.Run("ReplaysAfterRestart", func(t *testing.T) {
+		dir := t.TempDir()
+		sender := newFlakySender(t, "spool")
+		s := newSpool(t, sender, SpoolOptions{Directory: dir})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "delivered"))
+		flush(t, s)
+		require.Equal(t, 1, sender.Len())
+
+		sender.failing.Store(true)
+		for i := 0; i < 3; i++ {
+			s.Send(t.Context(), message.NewDefaultMessage(level.Info, fmt.Sprintf("replayed %d", i)))
+		}
+		require.NoError(t, s.Close())
+
+		restarted := newFlakySender(t, "spool")
+		s = newSpool(t, restarted, SpoolOptions{Directory: dir})
+		flush(t, s)
+		msgs := drain(restarted.InternalSender)
+		require.Len(t, msgs, 3)
+		for i, msg := range msgs {
+			assert.Equal(t, fmt.Sprintf("replayed %d", i), msg.String())
+		}
+	})
+	t.Run("IgnoresTornRecords", func(t *testing.T) {
+		dir := t.TempDir()
+		sender := newFlakySender(t, "spool")
+		sender.failing.Store(true)
+		s := newSpool(t, sender, SpoolOptions{Directory: dir})
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "complete"))
+		require.NoError(t, s.Close())
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{0, 0, 1})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		restarted := newFlakySender(t, "spool")
+		s = newSpool(t, restarted, SpoolOptions{Directory: dir})
+		flush(t, s)
+		msgs := drain(restarted.InternalSender)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "complete", msgs[0].String())
+	})
+	t.Run("ErrorHandlerSendsToSpool", func(t *testing.T) {
+		opts := SpoolOptions{Directory: t.TempDir(), SegmentSize: 512, MaxDiskUsage: 1024}
+		sender := newFlakySender(t, "spool")
+		sender.failing.Store(true)
+		s := newSpool(t, sender, opts)
+
+		var reported atomic.Int64
+		require.NoError(t, s.SetErrorHandler(func(ctx context.Context, err error, _ message.Composer) {
+			if reported.Add(1) < 5 {
+				s.Send(ctx, message.NewErrorMessage(level.Error, err))
+			}
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 50; i++ {
+				s.Send(t.Context(), message.NewDefaultMessage(level.Info, fmt.Sprintf("message %d", i)))
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "sending to the spool from its error handler deadlocked")
+		}
+		assert.NotZero(t, reported.Load())
+	})
+	t.Run("Overflow", func(t *testing.T) {
+		for _, policy := range []SpoolOverflowPolicy{SpoolDropOldest, SpoolDropNewest} {
+			t.Run(string(policy), func(t *testing.T) {
+				dir := t.TempDir()
+				opts := SpoolOptions{Directory: dir, SegmentSize: 512, MaxDiskUsage: 1024, Overflow: policy}
+				sender := newFlakySender(t, "spool")
+				sender.failing.Store(true)
+				s := newSpool(t, sender, opts)
+				require.NoError(t, s.SetErrorHandler(func(context.Context, error, message.Composer) {}))
+				for i := 0; i < 50; i++ {
+					s.Send(t.Context(), message.NewDefaultMessage(level.Info, fmt.Sprintf("message %d", i)))
+				}
+				require.NoError(t, s.Close())
+
+				restarted := newFlakySender(t, "spool")
+				s = newSpool(t, restarted, opts)
+				flush(t, s)
+				msgs := drain(restarted.InternalSender)
+				require.NotEmpty(t, msgs)
+				assert.Less(t, len(msgs), 50)
+				if policy == SpoolDropOldest {
+					assert.Equal(t, "message 49", msgs[len(msgs)-1].String())
+				} else {
+					assert.Equal(t, "message 0", msgs[0].String())
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+)
+
+// StandardLogOptions configure the standard library log bridge.
+type StandardLogOptions struct {
+	// Priority is the priority of lines without a level. Defaults
+	// to the default level of the sender.
+	Priority level.Priority
+	// IdleFlush, if positive, is how long a partial line waits for
+	// the rest of the line before it is sent on its own. By default,
+	// partial lines wait until the bridge is closed.
+	IdleFlush time.Duration
+}
+
+func (opts *StandardLogOptions) validate() error {
+	catcher := []string{}
+	if opts.Priority != level.Invalid && !opts.Priority.IsValid() {
+		catcher = append(catcher, "invalid priority")
+	}
+	if opts.IdleFlush < 0 {
+		catcher = append(catcher, "idle flush duration cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	return nil
+}
+
+// StandardLogBridge is an io.Writer for standard library loggers that
+// sends each line that they write to a Sender, with the priority of
+// the level in the line.
+type StandardLogBridge struct {
+	Sender
+	opts  StandardLogOptions
+	lines *lineWriter
+
+	mu      sync.Mutex
+	restore func()
+}
+
+// NewStandardLogBridge returns a bridge that sends the lines written
+// to it, typically by a standard library logger (see Logger and
+// CaptureStandardLogger), to the Sender. Unlike WriterSender, the
+// bridge sends each line as soon as it is complete, and detects the
+// level of lines from prefixes such as "[ERROR]" or "WARN:", "level="
+// logfmt pairs, and the "level" key of JSON objects. Lines that are
+// logfmt or JSON objects are sent as message.Fields, with their "msg"
+// in the "message" field.
+//
+// The bridge does not own the underlying Sender, so users are
+// responsible for closing it. Flushing the bridge sends any partial
+// line before flushing the sender, and closing the bridge sends any
+// partial line and restores the standard logger if it was captured.
+func NewStandardLogBridge(s Sender, opts StandardLogOptions) (*StandardLogBridge, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	b := &StandardLogBridge{
+		Sender: s,
+		opts:   opts,
+	}
+	b.lines = newLineWriter(opts.IdleFlush, func(line []byte) {
+		p := b.opts.Priority
+		if p == level.Invalid {
+			p = b.Level().Default
+		}
+		b.Sender.Send(context.Background(), parseLogLine(p, line))
+	})
+
+	return b, nil
+}
+
+// Write sends the complete lines in p, and buffers the rest until the
+// line is complete, the idle flush duration passes, or the bridge is
+// closed.
+func (b *StandardLogBridge) Write(p []byte) (int, error) { return b.lines.Write(p) }
+
+// Logger returns a standard library logger that writes to the bridge.
+func (b *StandardLogBridge) Logger() *log.Logger { return log.New(b, "", 0) }
+
+// CaptureStandardLogger sets the output of the standard library's
+// default logger, log.Default(), to the bridge, and removes its
+// timestamp and prefix, since senders add their own. Closing the
+// bridge restores the output, flags and prefix of the default logger.
+func (b *StandardLogBridge) CaptureStandardLogger() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.restore != nil {
+		return
+	}
+
+	output, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(b)
+	log.SetFlags(0)
+	log.SetPrefix("")
+
+	b.restore = func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}
+}
+
+// Flush sends any partial line and then flushes the underlying
+// sender.
+func (b *StandardLogBridge) Flush(ctx context.Context) error {
+	b.lines.Flush()
+
+	return b.Sender.Flush(ctx)
+}
+
+// Close restores the standard library's default logger, if the bridge
+// captured it, and sends any partial line. This does not close the
+// underlying sender.
+func (b *StandardLogBridge) Close() error {
+	b.mu.Lock()
+	if b.restore != nil {
+		b.restore()
+		b.restore = nil
+	}
+	b.mu.Unlock()
+
+	b.lines.Close()
+
+	return nil
+}
+
+var (
+	bracketLevelPrefix = regexp.MustCompile(`^\[([A-Za-z]+)\]:?\s*`)
+	colonLevelPrefix   = regexp.MustCompile(`^([A-Za-z]+):\s*`)
+	logfmtLevel        = regexp.MustCompile(`(?:^|\s)(?:level|lvl|severity)="?([A-Za-z]+)`)
+)
+
+// parseLogLine converts a line of log output to a message with the
+// priority of the line's level, or the default priority.
+func parseLogLine(p level.Priority, line []byte) message.Composer {
+	text := strings.TrimSpace(string(line))
+
+	if strings.HasPrefix(text, "{") {
+		if fields, ok := parseJSONLogLine(text); ok {
+			return message.NewFields(logFieldsPriority(p, fields), fields)
+		}
+	}
+
+	if match := bracketLevelPrefix.FindStringSubmatch(text); match != nil {
+		if lp, ok := parseLevelName(match[1]); ok {
+			p, text = lp, text[len(match[0]):]
+		}
+	} else if match := colonLevelPrefix.FindStringSubmatch(text); match != nil {
+		if lp, ok := parseLevelName(match[1]); ok {
+			p, text = lp, text[len(match[0]):]
+		}
+	}
+
+	if fields, ok := parseLogfmt(text); ok {
+		return message.NewFields(logFieldsPriority(p, fields), fields)
+	}
+	if match := logfmtLevel.FindStringSubmatch(text); match != nil {
+		if lp, ok := parseLevelName(match[1]); ok {
+			p = lp
+		}
+	}
+
+	return message.NewDefaultMessage(p, text)
+}
+
+// logFieldsPriority returns the priority of the level field of a parsed
+// line, removing the field, or the default priority. The "msg" field is
+// renamed to "message".
+func logFieldsPriority(p level.Priority, fields message.Fields) level.Priority {
+	for _, key := range []string{"level", "lvl", "severity"} {
+		value, ok := fields[key].(string)
+		if !ok {
+			continue
+		}
+		if lp, ok := parseLevelName(value); ok {
+			p = lp
+			delete(fields, key)
+			break
+		}
+	}
+
+	if msg, ok := fields["msg"]; ok {
+		if _, ok = fields[message.FieldsMsgName]; !ok {
+			fields[message.FieldsMsgName] = msg
+			delete(fields, "msg")
+		}
+	}
+
+	return p
+}
+
+// parseLevelName converts common level names, including abbreviations
+// and slog levels with offsets such as "ERROR+2", to priorities.
+func parseLevelName(name string) (level.Priority, bool) {
+	name = strings.ToLower(name)
+	if idx := strings.IndexAny(name, "+-"); idx > 0 {
+		name = name[:idx]
+	}
+
+	switch name {
+	case "emerg", "fatal", "panic":
+		return level.Emergency, true
+	case "crit":
+		return level.Critical, true
+	case "err":
+		return level.Error, true
+	case "warn":
+		return level.Warning, true
+	case "dbg":
+		return level.Debug, true
+	}
+
+	p := level.FromString(name)
+
+	return p, p != level.Invalid
+}
+
+func parseJSONLogLine(text string) (message.Fields, bool) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+
+	fields := message.Fields{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return fields, true
+}
+
+// parseLogfmt parses a line of logfmt key=value pairs, with optionally
+// quoted values. It returns false if any part of the line is not a
+// pair.
+func parseLogfmt(text string) (message.Fields, bool) {
+	fields := message.Fields{}
+	for i := 0; i < len(text); {
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		if i == len(text) {
+			break
+		}
+
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' && text[i] != '"' {
+			i++
+		}
+		if i == start || i == len(text) || text[i] != '=' {
+			return nil, false
+		}
+		key := text[start:i]
+		i++
+
+		if i < len(text) && text[i] == '"' {
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, false
+			}
+			value, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = value
+			i = end + 1
+			if i < len(text) && text[i] != ' ' {
+				return nil, false
+			}
+			continue
+		}
+
+		start = i
+		for i < len(text) && text[i] != ' ' {
+			i++
+		}
+		fields[key] = text[start:i]
+	}
+
+	return fields, len(fields) > 0
+}
@@ -0,0 +1,170 @@
+package send
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLine(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		priority level.Priority
+		text     string
+		fields   message.Fields
+	}{
+		{line: "plain line", priority: level.Info, text: "plain line"},
+		{line: "[ERROR] connection refused", priority: level.Error, text: "connection refused"},
+		{line: "[warn]: retrying", priority: level.Warning, text: "retrying"},
+		{line: "[main] not a level", priority: level.Info, text: "[main] not a level"},
+		{line: "WARN: disk is filling up", priority: level.Warning, text: "disk is filling up"},
+		{line: "http://example.com", priority: level.Info, text: "http://example.com"},
+		{line: "starting level=debug with some text", priority: level.Debug, text: "starting level=debug with some text"},
+		{
+			line:     `time=2024-01-01 level=debug msg="cache miss" key=users:1`,
+			priority: level.Debug,
+			fields:   message.Fields{"time": "2024-01-01", "message": "cache miss", "key": "users:1"},
+		},
+		{
+			line:     `[CRIT] op=insert err="duplicate \"key\""`,
+			priority: level.Critical,
+			fields:   message.Fields{"op": "insert", "err": `duplicate "key"`},
+		},
+		{
+			line:     `{"time":"2024-01-01T00:00:00Z","level":"ERROR+2","msg":"failed","attempt":3}`,
+			priority: level.Error,
+			fields:   message.Fields{"time": "2024-01-01T00:00:00Z", "message": "failed", "attempt": "3"},
+		},
+		{line: `{"level":"info"} trailing`, priority: level.Info, text: `{"level":"info"} trailing`},
+	} {
+		t.Run(test.line, func(t *testing.T) {
+			m := parseLogLine(level.Info, []byte(test.line))
+			assert.Equal(t, test.priority, m.Priority())
+			if test.fields == nil {
+				assert.Equal(t, test.text, m.String())
+				return
+			}
+
+			fields, ok := m.Raw().(message.Fields)
+			require.True(t, ok)
+			delete(fields, "metadata")
+			for k, v := range test.fields {
+				assert.EqualValues(t, v, fields[k], k)
+			}
+			assert.Len(t, fields, len(test.fields))
+		})
+	}
+}
+
+func TestStandardLogBridge(t *testing.T) {
+	newBridge := func(t *testing.T, opts StandardLogOptions) (*StandardLogBridge, *InternalSender) {
+		sink, err := NewInternalLogger("sink", LevelInfo{level.Notice, level.Trace})
+		require.NoError(t, err)
+		b, err := NewStandardLogBridge(sink, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = b.Close() })
+		return b, sink
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []StandardLogOptions{
+			{Priority: 1},
+			{IdleFlush: -time.Second},
+		} {
+			b, err := NewStandardLogBridge(nil, opts)
+			assert.Error(t, err)
+			assert.Nil(t, b)
+		}
+	})
+	t.Run("Lines", func(t *testing.T) {
+		b, sink := newBridge(t, StandardLogOptions{})
+		logger := b.Logger()
+
+		logger.Print("short")
+		msg := sink.GetMessage()
+		assert.Equal(t, "short", msg.Rendered, "short lines are sent without waiting for more output")
+		assert.Equal(t, level.Notice, msg.Priority)
+
+		_, err := b.Write([]byte("[ERROR] first\n\nsec"))
+		require.NoError(t, err)
+		assert.Equal(t, "first", sink.GetMessage().Rendered)
+		assert.False(t, sink.HasMessage())
+
+		_, err = b.Write([]byte("ond\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "second", sink.GetMessage().Rendered)
+
+		_, err = b.Write([]byte("partial"))
+		require.NoError(t, err)
+		assert.False(t, sink.HasMessage())
+		require.NoError(t, b.Close())
+		assert.Equal(t, "partial", sink.GetMessage().Rendered)
+
+		_, err = b.Write([]byte("closed\n"))
+		assert.Error(t, err)
+	})
+	t.Run("Flush", func(t *testing.T) {
+		b, sink := newBridge(t, StandardLogOptions{})
+
+		_, err := b.Write([]byte("partial"))
+		require.NoError(t, err)
+		assert.False(t, sink.HasMessage())
+		require.NoError(t, b.Flush(t.Context()))
+		assert.Equal(t, "partial", sink.GetMessage().Rendered)
+
+		_, err = b.Write([]byte("next\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "next", sink.GetMessage().Rendered, "the flushed partial line is not repeated")
+		require.NoError(t, b.Flush(t.Context()))
+		assert.False(t, sink.HasMessage())
+	})
+	t.Run("DefaultPriority", func(t *testing.T) {
+		b, sink := newBridge(t, StandardLogOptions{Priority: level.Warning})
+		b.Logger().Print("no level")
+		assert.Equal(t, level.Warning, sink.GetMessage().Priority)
+	})
+	t.Run("IdleFlush", func(t *testing.T) {
+		b, sink := newBridge(t, StandardLogOptions{IdleFlush: 20 * time.Millisecond})
+
+		_, err := b.Write([]byte("progress: 10%"))
+		require.NoError(t, err)
+		assert.False(t, sink.HasMessage())
+		require.Eventually(t, sink.HasMessage, time.Second, time.Millisecond)
+		assert.Equal(t, "progress: 10%", sink.GetMessage().Rendered)
+
+		_, err = b.Write([]byte("next\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "next", sink.GetMessage().Rendered)
+	})
+	t.Run("CaptureStandardLogger", func(t *testing.T) {
+		b, sink := newBridge(t, StandardLogOptions{})
+		output, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+		defer func() {
+			log.SetOutput(output)
+			log.SetFlags(flags)
+			log.SetPrefix(prefix)
+		}()
+		original := &bytes.Buffer{}
+		log.SetOutput(original)
+		log.SetFlags(log.Lmsgprefix)
+		log.SetPrefix("app: ")
+
+		b.CaptureStandardLogger()
+		log.Printf("level=error msg=%q", "captured")
+		msg := sink.GetMessage()
+		assert.Equal(t, level.Error, msg.Priority)
+		assert.Equal(t, "captured", msg.Message.Raw().(message.Fields)[message.FieldsMsgName])
+		assert.Empty(t, original.String())
+
+		require.NoError(t, b.Close())
+		log.Print("restored")
+		assert.Equal(t, "app: restored\n", original.String())
+		assert.False(t, sink.HasMessage())
+	})
+}
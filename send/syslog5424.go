@@ -0,0 +1,481 @@
+package send
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	syslog5424Version            = 1
+	syslog5424Nil                = "-"
+	syslog5424TimeFormat         = "2006-01-02T15:04:05.000000Z07:00"
+	syslog5424BOM                = "\xef\xbb\xbf"
+	defaultSyslog5424SDID        = "fields@32473"
+	defaultSyslogFacility        = "user"
+	maxSyslog5424Hostname        = 255
+	maxSyslog5424AppName         = 48
+	maxSyslog5424ProcID          = 128
+	maxSyslog5424MsgID           = 32
+	maxSyslog5424ParamName       = 32
+	defaultSyslog5424DialTimeout = 5 * time.Second
+)
+
+// syslogFacilities are the codes of the syslog facilities, by the
+// names that Syslog5424Options accepts.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"ntp":      12,
+	"audit":    13,
+	"alert":    14,
+	"clock":    15,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Syslog5424Options configures the RFC 5424 syslog sender.
+type Syslog5424Options struct {
+	// Network is one of "tcp" (the default), "tls" or "udp". Over
+	// TCP and TLS, messages are framed with octet counting as
+	// described in RFC 6587 and RFC 5425.
+	Network string `bson:"network" json:"network" yaml:"network"`
+	// Address is the host and port of the collector.
+	Address string `bson:"address" json:"address" yaml:"address"`
+	// TLSConfig configures the TLS network. Defaults to the
+	// system's root certificates.
+	TLSConfig *tls.Config `bson:"-" json:"-" yaml:"-"`
+
+	// Facility is the name of the syslog facility: "kern", "user",
+	// "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp",
+	// "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	// or "local0" through "local7". Defaults to "user".
+	Facility string `bson:"facility" json:"facility" yaml:"facility"`
+	// Hostname is the HOSTNAME of every message. Defaults to the
+	// hostname of the system.
+	Hostname string `bson:"hostname" json:"hostname" yaml:"hostname"`
+	// MsgIDField, if set, names a field of the message whose
+	// value is used as the MSGID of the message, rather than as
+	// structured data.
+	MsgIDField string `bson:"msgid_field" json:"msgid_field" yaml:"msgid_field"`
+	// SDID is the ID of the structured data element that holds
+	// the fields of messages. Defaults to "fields@32473".
+	SDID string `bson:"sd_id" json:"sd_id" yaml:"sd_id"`
+
+	// DialTimeout is the timeout for establishing connections.
+	// Defaults to 5 seconds.
+	DialTimeout time.Duration `bson:"dial_timeout" json:"dial_timeout" yaml:"dial_timeout"`
+}
+
+// Validate checks the options for required and invalid values and
+// populates defaults.
+func (opts *Syslog5424Options) Validate() error {
+	catcher := []string{}
+	switch opts.Network {
+	case "":
+		opts.Network = "tcp"
+	case "tcp", "tls", "udp":
+	default:
+		catcher = append(catcher, fmt.Sprintf("invalid network '%s'", opts.Network))
+	}
+	if opts.Address == "" {
+		catcher = append(catcher, "must specify an address")
+	}
+	if _, ok := syslogFacilities[opts.Facility]; opts.Facility != "" && !ok {
+		catcher = append(catcher, fmt.Sprintf("invalid facility '%s'", opts.Facility))
+	}
+	if opts.SDID != "" && syslog5424Name(opts.SDID, maxSyslog5424ParamName) != opts.SDID {
+		catcher = append(catcher, fmt.Sprintf("invalid structured data ID '%s'", opts.SDID))
+	}
+	if opts.DialTimeout < 0 {
+		catcher = append(catcher, "dial timeout cannot be negative")
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Facility == "" {
+		opts.Facility = defaultSyslogFacility
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.SDID == "" {
+		opts.SDID = defaultSyslog5424SDID
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = defaultSyslog5424DialTimeout
+	}
+
+	return nil
+}
+
+type syslog5424Sender struct {
+	opts     Syslog5424Options
+	facility int
+	pid      string
+	mu       sync.Mutex
+	conn     net.Conn
+	*Base
+}
+
+// NewSyslog5424Sender constructs a Sender that writes RFC 5424 syslog
+// messages to a collector over TCP, TLS or UDP. See
+// MakeSyslog5424Sender for more information.
+func NewSyslog5424Sender(name string, opts Syslog5424Options, l LevelInfo) (Sender, error) {
+	s, err := MakeSyslog5424Sender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeSyslog5424Sender constructs an unconfigured RFC 5424 syslog
+// Sender. Pass to Journaler.SetSender or call SetName before using.
+//
+// Unlike the senders from NewSyslogLogger, which use the standard
+// library's syslog package, this sender preserves the structure of
+// messages: the APP-NAME is the sender name, the PROCID is the process
+// ID, and the fields and annotations of messages are written as
+// parameters of a single STRUCTURED-DATA element. Nested fields are
+// flattened, so that {"a": {"b": 1}} becomes a.b="1". Parameter names
+// that are longer than 32 characters or contain characters that are
+// not allowed in names are shortened and made unique with a hash of
+// the field name. The MSG is the string form of the message.
+//
+// Stream connections are reestablished when the collector closes
+// them, so that messages are not lost when it restarts.
+func MakeSyslog5424Sender(opts Syslog5424Options) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid syslog options")
+	}
+
+	s := &syslog5424Sender{
+		opts:     opts,
+		facility: syslogFacilities[opts.Facility],
+		pid:      strconv.Itoa(os.Getpid()),
+		Base:     NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	s.closer = func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.conn == nil {
+			return nil
+		}
+
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	return s, nil
+}
+
+func (s *syslog5424Sender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	msgs := []message.Composer{m}
+	if g, ok := m.(*message.GroupComposer); ok {
+		msgs = g.Messages()
+	}
+
+	name := s.Name()
+	for _, c := range msgs {
+		if !lvl.ShouldLog(c) {
+			continue
+		}
+
+		if err := s.write(s.format(name, time.Now(), c)); err != nil {
+			s.ErrorHandler()(ctx, err, c)
+		}
+	}
+}
+
+func (s *syslog5424Sender) Flush(_ context.Context) error { return nil }
+
+// format renders a message as an RFC 5424 syslog message:
+//
+//	<PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslog5424Sender) format(name string, ts time.Time, m message.Composer) string {
+	attrs := messageAttributes(m)
+
+	msgID := syslog5424Nil
+	if s.opts.MsgIDField != "" {
+		if value, ok := attrs[s.opts.MsgIDField]; ok {
+			msgID = syslog5424Header(syslog5424ParamValue(value), maxSyslog5424MsgID)
+			delete(attrs, s.opts.MsgIDField)
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "<%d>%d %s %s %s %s %s ",
+		s.facility*8+syslogSeverity(m.Priority()),
+		syslog5424Version,
+		ts.Format(syslog5424TimeFormat),
+		syslog5424Header(s.opts.Hostname, maxSyslog5424Hostname),
+		syslog5424Header(name, maxSyslog5424AppName),
+		syslog5424Header(s.pid, maxSyslog5424ProcID),
+		msgID,
+	)
+	s.writeStructuredData(&out, attrs)
+
+	if msg := m.String(); msg != "" {
+		out.WriteString(" ")
+		out.WriteString(syslog5424BOM)
+		out.WriteString(msg)
+	}
+
+	return out.String()
+}
+
+func (s *syslog5424Sender) writeStructuredData(out *strings.Builder, attrs map[string]interface{}) {
+	params := map[string]string{}
+	for k, v := range attrs {
+		flattenSyslog5424Param(params, k, v)
+	}
+	if len(params) == 0 {
+		out.WriteString(syslog5424Nil)
+		return
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out.WriteString("[")
+	out.WriteString(s.opts.SDID)
+	for _, name := range names {
+		out.WriteString(" ")
+		out.WriteString(name)
+		out.WriteString(`="`)
+		out.WriteString(syslog5424EscapeParamValue(params[name]))
+		out.WriteString(`"`)
+	}
+	out.WriteString("]")
+}
+
+func (s *syslog5424Sender) write(msg string) error {
+	if s.opts.Network == "udp" {
+		return s.writeDatagram(msg)
+	}
+
+	// Octet counting: the length of the message, a space and the
+	// message.
+	frame := strconv.Itoa(len(msg)) + " " + msg
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && streamClosedByPeer(s.conn) {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.dial(); err != nil {
+				continue
+			}
+		}
+
+		if _, err = s.conn.Write([]byte(frame)); err == nil {
+			return nil
+		}
+
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	return errors.Wrap(err, "writing syslog message")
+}
+
+func (s *syslog5424Sender) writeDatagram(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.conn.Write([]byte(msg))
+	return errors.Wrap(err, "writing syslog message")
+}
+
+func (s *syslog5424Sender) dial() error {
+	dialer := &net.Dialer{Timeout: s.opts.DialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch s.opts.Network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.opts.Address, s.opts.TLSConfig)
+	default:
+		conn, err = dialer.Dial(s.opts.Network, s.opts.Address)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "dialing '%s'", s.opts.Address)
+	}
+
+	if s.opts.Network == "udp" {
+		s.conn = conn
+	} else {
+		s.conn = watchPeer(conn)
+	}
+	return nil
+}
+
+func flattenSyslog5424Param(params map[string]string, key string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, nested := range v {
+			flattenSyslog5424Param(params, key+"."+k, nested)
+		}
+	default:
+		params[syslog5424ParamName(key)] = syslog5424ParamValue(v)
+	}
+}
+
+// syslog5424ParamName returns the structured data parameter name for
+// a field. Fields that are not valid names are sanitized and
+// shortened, with a hash of the field name appended, so that distinct
+// fields do not share a name.
+func syslog5424ParamName(key string) string {
+	name := syslog5424Name(key, len(key))
+	if name == key && name != "" && len(name) <= maxSyslog5424ParamName {
+		return name
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	suffix := fmt.Sprintf("~%08x", h.Sum32())
+	if len(name) > maxSyslog5424ParamName-len(suffix) {
+		name = name[:maxSyslog5424ParamName-len(suffix)]
+	}
+
+	return name + suffix
+}
+
+func syslog5424ParamValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// syslog5424EscapeParamValue escapes the characters that must be
+// escaped in structured data parameter values: '"', '\' and ']'.
+func syslog5424EscapeParamValue(value string) string {
+	if !strings.ContainsAny(value, `"\]`) {
+		return value
+	}
+
+	var out strings.Builder
+	for _, r := range value {
+		switch r {
+		case '"', '\\', ']':
+			out.WriteByte('\\')
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// syslog5424Header returns a header field value, which must be
+// printable US-ASCII characters without spaces, or the nil value when
+// the value is empty.
+func syslog5424Header(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return syslog5424Nil
+	}
+
+	return value
+}
+
+// syslog5424Name returns a structured data ID or parameter name, which
+// is a header value that also cannot contain '=', ']' or '"'.
+func syslog5424Name(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if len(value) > max {
+		value = value[:max]
+	}
+
+	return value
+}
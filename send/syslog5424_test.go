@@ -0,0 +1,192 @@
+package send
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readOctetCountedFrames reads octet counted syslog messages from
+// every connection accepted by the listener.
+func readOctetCountedFrames(t *testing.T, ln net.Listener) (<-chan string, <-chan net.Conn) {
+	frames := make(chan string, 10)
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					size, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+					require.NoError(t, err)
+					frame := make([]byte, n)
+					_, err = io.ReadFull(r, frame)
+					require.NoError(t, err)
+					frames <- string(frame)
+				}
+			}()
+		}
+	}()
+
+	return frames, accepted
+}
+
+func receiveFrame(t *testing.T, frames <-chan string) string {
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for syslog message")
+		return ""
+	}
+}
+
+func TestSyslog5424Sender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+	pid := strconv.Itoa(os.Getpid())
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []Syslog5424Options{
+			{},
+			{Network: "unix", Address: "localhost:6514"},
+			{Address: "localhost:6514", Facility: "local8"},
+			{Address: "localhost:6514", SDID: "bad id"},
+		} {
+			s, err := MakeSyslog5424Sender(opts)
+			assert.Error(t, err)
+			assert.Nil(t, s)
+		}
+	})
+	t.Run("Format", func(t *testing.T) {
+		s, err := NewSyslog5424Sender("my app", Syslog5424Options{
+			Address:    "localhost:6514",
+			Hostname:   "host",
+			Facility:   "local0",
+			MsgIDField: "event",
+		}, lvl)
+		require.NoError(t, err)
+
+		ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+		impl := s.(*syslog5424Sender)
+
+		assert.Equal(t, "<134>1 2024-01-02T03:04:05.000006Z host my_app "+pid+" - - "+syslog5424BOM+"hello",
+			impl.format("my app", ts, message.NewDefaultMessage(level.Info, "hello")))
+
+		msg := message.NewSimpleFields(level.Error, message.Fields{
+			"event":  "login",
+			"user":   `a "quoted" \ name]`,
+			"nested": message.Fields{"count": 2},
+		})
+		assert.Equal(t,
+			`<131>1 2024-01-02T03:04:05.000006Z host my_app `+pid+` login [fields@32473 nested.count="2" user="a \"quoted\" \\ name\]"] `+syslog5424BOM+msg.String(),
+			impl.format("my app", ts, msg))
+	})
+	t.Run("KernelFacility", func(t *testing.T) {
+		s, err := MakeSyslog5424Sender(Syslog5424Options{Address: "localhost:6514", Hostname: "host", Facility: "kern"})
+		require.NoError(t, err)
+
+		out := s.(*syslog5424Sender).format("app", time.Now(), message.NewDefaultMessage(level.Error, "panic"))
+		assert.True(t, strings.HasPrefix(out, "<3>1 "), out)
+	})
+	t.Run("ParamNames", func(t *testing.T) {
+		long := strings.Repeat("a", maxSyslog5424ParamName)
+		for _, key := range []string{"short", "request.id", long} {
+			assert.Equal(t, key, syslog5424ParamName(key))
+		}
+
+		names := map[string]string{}
+		for _, key := range []string{"a=b", "a]b", "a_b", "", long + "1", long + "2"} {
+			name := syslog5424ParamName(key)
+			assert.LessOrEqual(t, len(name), maxSyslog5424ParamName, key)
+			assert.Equal(t, syslog5424Name(name, maxSyslog5424ParamName), name, key)
+			assert.NotContains(t, names, name, key)
+			names[name] = key
+		}
+	})
+	t.Run("TCPReconnects", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		frames, accepted := readOctetCountedFrames(t, ln)
+
+		s, err := NewSyslog5424Sender("app", Syslog5424Options{Address: ln.Addr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Warning, "one"))
+		frame := receiveFrame(t, frames)
+		assert.True(t, strings.HasPrefix(frame, "<12>1 "), frame)
+		assert.True(t, strings.HasSuffix(frame, " "+syslog5424BOM+"one"), frame)
+
+		(<-accepted).Close()
+		time.Sleep(10 * time.Millisecond)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "two"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+		))
+		assert.True(t, strings.HasSuffix(receiveFrame(t, frames), "two"))
+	})
+	t.Run("TLS", func(t *testing.T) {
+		// Borrow the test certificate of an httptest server.
+		srv := httptest.NewTLSServer(nil)
+		srv.Close()
+
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: srv.TLS.Certificates})
+		require.NoError(t, err)
+		defer ln.Close()
+		frames, _ := readOctetCountedFrames(t, ln)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+		s, err := NewSyslog5424Sender("app", Syslog5424Options{
+			Network:   "tls",
+			Address:   ln.Addr().String(),
+			TLSConfig: &tls.Config{RootCAs: pool, ServerName: "example.com"},
+		}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "secure"))
+		assert.True(t, strings.HasSuffix(receiveFrame(t, frames), "secure"))
+	})
+	t.Run("UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		s, err := NewSyslog5424Sender("app", Syslog5424Options{Network: "udp", Address: conn.LocalAddr().String()}, lvl)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "datagram"))
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 2048)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(buf[:n]), "<14>1 "))
+		assert.True(t, strings.HasSuffix(string(buf[:n]), syslog5424BOM+"datagram"))
+	})
+}
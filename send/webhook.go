@@ -0,0 +1,271 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const defaultWebhookContentType = "application/json"
+
+// WebhookAuth configures the credentials that the webhook sender
+// attaches to each request. Specify either a username and password
+// for basic authentication or a bearer token, but not both.
+type WebhookAuth struct {
+	Username    string `bson:"username" json:"username" yaml:"username"`
+	Password    string `bson:"password" json:"password" yaml:"password" secret:"true"`
+	BearerToken string `bson:"bearer_token" json:"bearer_token" yaml:"bearer_token" secret:"true"`
+}
+
+// WebhookOptions configures the webhook sender.
+type WebhookOptions struct {
+	// URL is the endpoint that receives the requests.
+	URL string `bson:"url" json:"url" yaml:"url"`
+	// Method is the HTTP method used for requests. Defaults to
+	// POST.
+	Method string `bson:"method" json:"method" yaml:"method"`
+	// Headers are added to every request.
+	Headers map[string]string `bson:"headers" json:"headers" yaml:"headers"`
+	// ContentType sets the Content-Type header of every
+	// request. Defaults to "application/json".
+	ContentType string      `bson:"content_type" json:"content_type" yaml:"content_type"`
+	Auth        WebhookAuth `bson:"auth" json:"auth" yaml:"auth"`
+
+	// Template is a text/template used to render the request
+	// body. The template is executed with a WebhookPayload and
+	// has access to a "json" function which renders its argument
+	// as a JSON value, which makes it possible to safely embed
+	// strings in JSON documents, for example:
+	//
+	//	{"text": {{ json .Message.String }}}
+	Template string `bson:"template" json:"template" yaml:"template"`
+	// Render, if specified, renders the request body from a
+	// message and takes precedence over Template. When batching,
+	// the message is a *message.GroupComposer.
+	Render func(message.Composer) ([]byte, error) `bson:"-" json:"-" yaml:"-"`
+	// If neither Template nor Render are specified, the request
+	// body is the JSON form of the message's Raw method.
+
+	// DisableBatching sends every message of a
+	// message.GroupComposer in its own request, rather than in a
+	// single request.
+	DisableBatching bool `bson:"disable_batching" json:"disable_batching" yaml:"disable_batching"`
+
+	// Client is the HTTP client used for requests. Defaults to a
+	// client with a 10 second timeout.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+
+	HTTPRetryOptions `bson:"retry" json:"retry" yaml:"retry"`
+
+	tmpl *template.Template
+}
+
+// WebhookPayload is the data passed to the webhook sender's Template.
+type WebhookPayload struct {
+	// Name is the name of the sender.
+	Name string
+	// Message is the message being sent. When batching, this is
+	// a *message.GroupComposer holding all of the messages.
+	Message message.Composer
+	// Messages holds the individual messages in the request,
+	// which is a single message unless batching.
+	Messages []message.Composer
+}
+
+// Validate checks the options for required and conflicting values and
+// populates defaults.
+func (opts *WebhookOptions) Validate() error {
+	catcher := []string{}
+	if opts.URL == "" {
+		catcher = append(catcher, "must specify a URL")
+	}
+	if opts.Auth.BearerToken != "" && (opts.Auth.Username != "" || opts.Auth.Password != "") {
+		catcher = append(catcher, "cannot specify both basic authentication and a bearer token")
+	}
+	if err := opts.HTTPRetryOptions.validate(); err != nil {
+		catcher = append(catcher, err.Error())
+	}
+
+	if opts.Template != "" && opts.tmpl == nil {
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(opts.Template)
+		if err != nil {
+			catcher = append(catcher, errors.Wrap(err, "parsing template").Error())
+		}
+		opts.tmpl = tmpl
+	}
+
+	if len(catcher) > 0 {
+		return errors.New(strings.Join(catcher, "; "))
+	}
+
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = defaultWebhookContentType
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return nil
+}
+
+func webhookJSON(v interface{}) (string, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+type webhookSender struct {
+	opts WebhookOptions
+	*Base
+}
+
+// NewWebhookSender constructs a Sender that sends each message to an
+// HTTP endpoint, rendering the request body with the template or
+// render function in the options. Use this sender with services such
+// as Mattermost, Microsoft Teams, or chat-ops bots that accept
+// messages as simple HTTP requests.
+//
+// Requests that fail with a 5xx or 429 status are retried with
+// exponential backoff, honoring the Retry-After header. Groups of
+// messages (e.g. from the buffered senders) are sent as a single
+// request unless batching is disabled.
+func NewWebhookSender(name string, opts WebhookOptions, l LevelInfo) (Sender, error) {
+	s, err := MakeWebhookSender(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return setup(s, name, l)
+}
+
+// MakeWebhookSender constructs an unconfigured webhook Sender. Pass
+// to Journaler.SetSender or call SetName before using.
+func MakeWebhookSender(opts WebhookOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid webhook options")
+	}
+
+	s := &webhookSender{
+		opts: opts,
+		Base: NewBase(""),
+	}
+
+	s.level = LevelInfo{level.Trace, level.Trace}
+
+	fallback := log.New(os.Stdout, "", log.LstdFlags)
+	_ = s.SetErrorHandler(ErrorHandlerFromLogger(fallback))
+
+	s.reset = func() {
+		fallback.SetPrefix(fmt.Sprintf("[%s] ", s.Name()))
+	}
+
+	return s, nil
+}
+
+func (s *webhookSender) Send(ctx context.Context, m message.Composer) {
+	lvl := s.Level()
+	if !lvl.ShouldLog(m) {
+		return
+	}
+
+	g, ok := m.(*message.GroupComposer)
+	if !ok {
+		s.send(ctx, m, []message.Composer{m})
+		return
+	}
+
+	msgs := []message.Composer{}
+	for _, c := range g.Messages() {
+		if lvl.ShouldLog(c) {
+			msgs = append(msgs, c)
+		}
+	}
+
+	if s.opts.DisableBatching {
+		for _, c := range msgs {
+			s.send(ctx, c, []message.Composer{c})
+		}
+		return
+	}
+
+	if len(msgs) > 0 {
+		s.send(ctx, message.NewGroupComposer(msgs), msgs)
+	}
+}
+
+func (s *webhookSender) send(ctx context.Context, m message.Composer, msgs []message.Composer) {
+	body, err := s.render(m, msgs)
+	if err != nil {
+		s.ErrorHandler()(ctx, errors.Wrap(err, "rendering webhook payload"), m)
+		return
+	}
+
+	resp, err := doHTTPWithRetry(ctx, s.opts.Client, s.opts.HTTPRetryOptions, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, s.opts.Method, s.opts.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", s.opts.ContentType)
+		for k, v := range s.opts.Headers {
+			req.Header.Set(k, v)
+		}
+
+		switch {
+		case s.opts.Auth.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+s.opts.Auth.BearerToken)
+		case s.opts.Auth.Username != "":
+			req.SetBasicAuth(s.opts.Auth.Username, s.opts.Auth.Password)
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		s.ErrorHandler()(ctx, err, m)
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
+
+func (s *webhookSender) render(m message.Composer, msgs []message.Composer) ([]byte, error) {
+	switch {
+	case s.opts.Render != nil:
+		return s.opts.Render(m)
+	case s.opts.tmpl != nil:
+		buf := &bytes.Buffer{}
+		err := s.opts.tmpl.Execute(buf, WebhookPayload{
+			Name:     s.Name(),
+			Message:  m,
+			Messages: msgs,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return json.Marshal(m.Raw())
+	}
+}
+
+func (s *webhookSender) Flush(_ context.Context) error { return nil }
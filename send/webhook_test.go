@@ -0,0 +1,236 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []webhookRequest
+	statuses []int
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	srv := &webhookServer{statuses: statuses}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.requests = append(srv.requests, webhookRequest{header: r.Header, body: string(body)})
+
+		status := http.StatusOK
+		if len(srv.statuses) > 0 {
+			status = srv.statuses[0]
+			srv.statuses = srv.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("response"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func (srv *webhookServer) getRequests() []webhookRequest {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]webhookRequest{}, srv.requests...)
+}
+
+func TestWebhookSender(t *testing.T) {
+	lvl := LevelInfo{Default: level.Info, Threshold: level.Info}
+	retry := HTTPRetryOptions{MinRetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]WebhookOptions{
+			"MissingURL":      {},
+			"ConflictingAuth": {URL: "http://localhost", Auth: WebhookAuth{Username: "u", BearerToken: "t"}},
+			"BadTemplate":     {URL: "http://localhost", Template: "{{ .Message"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := MakeWebhookSender(opts)
+				assert.Error(t, err)
+				assert.Nil(t, s)
+			})
+		}
+	})
+	t.Run("DefaultsToRawJSON", func(t *testing.T) {
+		srv := newWebhookServer(t)
+		s, err := NewWebhookSender("hook", WebhookOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewSimpleFields(level.Error, message.Fields{"a": "b"}))
+		s.Send(t.Context(), message.NewSimpleFields(level.Debug, message.Fields{"filtered": true}))
+
+		reqs := srv.getRequests()
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "application/json", reqs[0].header.Get("Content-Type"))
+		assert.JSONEq(t, `{"a": "b"}`, reqs[0].body)
+	})
+	t.Run("RendersTemplate", func(t *testing.T) {
+		srv := newWebhookServer(t)
+		s, err := NewWebhookSender("hook", WebhookOptions{
+			URL:              srv.URL,
+			Template:         `{"username": {{ json .Name }}, "text": {{ json .Message.String }}}`,
+			Headers:          map[string]string{"X-Test": "value"},
+			Auth:             WebhookAuth{BearerToken: "token"},
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, `say "hi"`))
+
+		reqs := srv.getRequests()
+		require.Len(t, reqs, 1)
+		assert.JSONEq(t, `{"username": "hook", "text": "say \"hi\""}`, reqs[0].body)
+		assert.Equal(t, "value", reqs[0].header.Get("X-Test"))
+		assert.Equal(t, "Bearer token", reqs[0].header.Get("Authorization"))
+	})
+	t.Run("RendersFunction", func(t *testing.T) {
+		srv := newWebhookServer(t)
+		s, err := NewWebhookSender("hook", WebhookOptions{
+			URL:              srv.URL,
+			ContentType:      "text/plain",
+			Auth:             WebhookAuth{Username: "user", Password: "pass"},
+			Render:           func(m message.Composer) ([]byte, error) { return []byte(strings.ToUpper(m.String())), nil },
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "hello"))
+
+		reqs := srv.getRequests()
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "HELLO", reqs[0].body)
+		assert.Equal(t, "text/plain", reqs[0].header.Get("Content-Type"))
+		assert.Contains(t, reqs[0].header.Get("Authorization"), "Basic ")
+	})
+	t.Run("BatchesGroups", func(t *testing.T) {
+		srv := newWebhookServer(t)
+		s, err := NewWebhookSender("hook", WebhookOptions{
+			URL:              srv.URL,
+			Template:         `{{ range .Messages }}{{ .String }};{{ end }}`,
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Debug, "filtered"),
+			message.NewDefaultMessage(level.Info, "two"),
+		))
+
+		reqs := srv.getRequests()
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "one;two;", reqs[0].body)
+	})
+	t.Run("DisableBatching", func(t *testing.T) {
+		srv := newWebhookServer(t)
+		s, err := NewWebhookSender("hook", WebhookOptions{
+			URL:              srv.URL,
+			Template:         `{{ .Message.String }}`,
+			DisableBatching:  true,
+			HTTPRetryOptions: retry,
+		}, lvl)
+		require.NoError(t, err)
+
+		s.Send(t.Context(), message.MakeGroupComposer(
+			message.NewDefaultMessage(level.Info, "one"),
+			message.NewDefaultMessage(level.Info, "two"),
+		))
+
+		reqs := srv.getRequests()
+		require.Len(t, reqs, 2)
+		assert.Equal(t, "one", reqs[0].body)
+		assert.Equal(t, "two", reqs[1].body)
+	})
+	t.Run("RetriesServerErrors", func(t *testing.T) {
+		srv := newWebhookServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+		s, err := NewWebhookSender("hook", WebhookOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+		var handled error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = err }))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "hello"))
+
+		assert.NoError(t, handled)
+		assert.Len(t, srv.getRequests(), 3)
+	})
+	t.Run("ReportsFailures", func(t *testing.T) {
+		srv := newWebhookServer(t, http.StatusBadGateway, http.StatusBadGateway)
+		s, err := NewWebhookSender("hook", WebhookOptions{
+			URL:              srv.URL,
+			HTTPRetryOptions: HTTPRetryOptions{MaxRetries: 1, MinRetryDelay: time.Millisecond},
+		}, lvl)
+		require.NoError(t, err)
+		var handled error
+		var handledMsg message.Composer
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, m message.Composer) {
+			handled = err
+			handledMsg = m
+		}))
+
+		msg := message.NewDefaultMessage(level.Info, "hello")
+		s.Send(t.Context(), msg)
+
+		require.Error(t, handled)
+		assert.Contains(t, handled.Error(), "502")
+		assert.Contains(t, handled.Error(), "response")
+		assert.Equal(t, msg, handledMsg)
+		assert.Len(t, srv.getRequests(), 2)
+	})
+	t.Run("DoesNotRetryClientErrors", func(t *testing.T) {
+		srv := newWebhookServer(t, http.StatusBadRequest)
+		s, err := NewWebhookSender("hook", WebhookOptions{URL: srv.URL, HTTPRetryOptions: retry}, lvl)
+		require.NoError(t, err)
+		var handled error
+		require.NoError(t, s.SetErrorHandler(func(_ context.Context, err error, _ message.Composer) { handled = err }))
+
+		s.Send(t.Context(), message.NewDefaultMessage(level.Info, "hello"))
+
+		assert.Error(t, handled)
+		assert.Len(t, srv.getRequests(), 1)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Second, retryAfter("", time.Second))
+	assert.Equal(t, time.Second, retryAfter("invalid", time.Second))
+	assert.Equal(t, 5*time.Second, retryAfter("5", time.Second))
+	assert.Zero(t, retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), time.Second))
+
+	wait := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Second)
+	assert.True(t, wait > 59*time.Minute)
+}
+
+func TestWebhookJSONHelper(t *testing.T) {
+	out, err := webhookJSON(map[string]string{"a": "b"})
+	require.NoError(t, err)
+	doc := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(out), &doc))
+	assert.Equal(t, "b", doc["a"])
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"io"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/mongodb/grip/level"
@@ -108,3 +109,110 @@ func (s *WriterSender) Close() error {
 	s.writer.Reset(s.buffer)
 	return nil
 }
+
+// lineWriter splits the bytes written to it into lines, without their
+// trailing whitespace, and passes each line that is not blank to its
+// emit function. If the idle duration is positive, a partial line is
+// passed to emit once no bytes have been written for that long.
+type lineWriter struct {
+	emit      func([]byte)
+	idle      time.Duration
+	mu        sync.Mutex
+	buffer    []byte
+	lastWrite time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+func newLineWriter(idle time.Duration, emit func([]byte)) *lineWriter {
+	return &lineWriter{emit: emit, idle: idle}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	w.buffer = append(w.buffer, p...)
+	for {
+		idx := bytes.IndexByte(w.buffer, '\n')
+		if idx < 0 {
+			break
+		}
+		w.send(w.buffer[:idx])
+		w.buffer = w.buffer[idx+1:]
+	}
+
+	if len(w.buffer) == 0 {
+		// release the memory of long lines.
+		w.buffer = nil
+	} else if w.idle > 0 {
+		w.lastWrite = time.Now()
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.idle, w.flushIdle)
+		} else {
+			w.timer.Reset(w.idle)
+		}
+	}
+
+	return len(p), nil
+}
+
+// send passes a line to emit if it is not blank. The caller must hold
+// the lock.
+func (w *lineWriter) send(line []byte) {
+	line = bytes.TrimRightFunc(line, unicode.IsSpace)
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	lncp := make([]byte, len(line))
+	copy(lncp, line)
+	w.emit(lncp)
+}
+
+// flushIdle sends the partial line if there have been no writes for the
+// idle duration, and otherwise waits for the rest of it.
+func (w *lineWriter) flushIdle() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || len(w.buffer) == 0 {
+		return
+	}
+	if wait := w.idle - time.Since(w.lastWrite); wait > 0 {
+		w.timer.Reset(wait)
+		return
+	}
+
+	w.send(w.buffer)
+	w.buffer = nil
+}
+
+// Flush sends the partial line, if any.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.send(w.buffer)
+	w.buffer = nil
+}
+
+// Close sends the partial line, if any, and stops accepting writes.
+func (w *lineWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.send(w.buffer)
+	w.buffer = nil
+}
@@ -1,6 +1,7 @@
 package sometimes
 
 import (
+	"hash/fnv"
 	"math/rand"
 	"time"
 )
@@ -57,3 +58,25 @@ func Percent(p int) bool {
 
 	return getRandNumber() > (100 - p)
 }
+
+// KeyedPercent takes a key and a number (p) and returns true for p
+// percent of keys. Unlike Percent, the result depends only on the key,
+// so all decisions for the same key are the same, which makes it
+// possible to keep or drop related events (e.g. all of the events of
+// a request) together. If p is greater than or equal to 100,
+// KeyedPercent always returns true. If p is less than or equal to 0,
+// KeyedPercent always returns false.
+func KeyedPercent(key string, p int) bool {
+	if p >= 100 {
+		return true
+	}
+
+	if p <= 0 {
+		return false
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32()%100) < p
+}